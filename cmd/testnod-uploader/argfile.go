@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandArgFiles replaces every @file argument with the lines of file, one
+// argument per line, so argument lists too long for the command line can be
+// passed in a response file. Blank lines are skipped and lines are used
+// verbatim otherwise, without shell quoting. Response files are not expanded
+// recursively.
+func expandArgFiles(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		data, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			expanded = append(expanded, line)
+		}
+	}
+	return expanded, nil
+}
+
+// readInputList returns the file paths listed in an -input-list file, one
+// per line. Surrounding whitespace, blank lines and lines starting with #
+// are ignored.
+func readInputList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input list: %w", err)
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, nil
+}
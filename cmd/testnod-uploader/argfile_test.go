@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandArgFiles(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args.txt")
+	content := "-branch\r\nmain\r\n\r\n-tag=two words\n../../testdata/valid_junit.xml\n"
+	if err := os.WriteFile(argsFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write response file: %v", err)
+	}
+
+	got, err := expandArgFiles([]string{"-validate", "@" + argsFile, "../../testdata/pytest_junit.xml", "@"})
+	if err != nil {
+		t.Fatalf("expandArgFiles() error = %v", err)
+	}
+	want := []string{"-validate", "-branch", "main", "-tag=two words", "../../testdata/valid_junit.xml", "../../testdata/pytest_junit.xml", "@"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expandArgFiles() = %q, want %q", got, want)
+	}
+
+	if _, err := expandArgFiles([]string{"@" + filepath.Join(dir, "missing.txt")}); err == nil {
+		t.Error("Expected an error for a missing response file")
+	}
+}
+
+func TestParseFlagsArgFile(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	argsFile := filepath.Join(t.TempDir(), "args.txt")
+	content := "-token\nsecret\n-build-id=42\n-tag=nightly\n../../testdata/valid_junit.xml\n../../testdata/pytest_junit.xml\n"
+	if err := os.WriteFile(argsFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write response file: %v", err)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-branch", "main", "@" + argsFile}
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if config.Token != "secret" || config.BuildID != "42" || config.Branch != "main" {
+		t.Errorf("parseFlags() token=%q build-id=%q branch=%q, want flags from the command line and response file", config.Token, config.BuildID, config.Branch)
+	}
+	if len(config.Tags) != 1 || config.Tags[0].Value != "nightly" {
+		t.Errorf("parseFlags() tags = %v, want [nightly]", config.Tags)
+	}
+	if len(config.FilePaths) != 2 || config.FilePaths[1] != "../../testdata/pytest_junit.xml" {
+		t.Errorf("parseFlags() FilePaths = %v, want both files from the response file", config.FilePaths)
+	}
+}
+
+func TestReadInputList(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "files.txt")
+	content := "# unit results\n../../testdata/valid_junit.xml\r\n\n   \n  ../../testdata/pytest_junit.xml  \n#../../testdata/skipped.xml\n"
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write input list: %v", err)
+	}
+
+	got, err := readInputList(list)
+	if err != nil {
+		t.Fatalf("readInputList() error = %v", err)
+	}
+	want := []string{"../../testdata/valid_junit.xml", "../../testdata/pytest_junit.xml"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("readInputList() = %q, want %q", got, want)
+	}
+
+	if _, err := readInputList(list + ".missing"); err == nil || !strings.Contains(err.Error(), "failed to read input list") {
+		t.Errorf("readInputList() error = %v, expected a read error", err)
+	}
+}
+
+func TestParseFlagsInputList(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.xml")
+	list := filepath.Join(dir, "files.txt")
+	content := "../../testdata/valid_junit.xml\n" + missing + "\n"
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write input list: %v", err)
+	}
+
+	parse := func(args ...string) (Config, error) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd", "-validate"}, args...)
+		return parseFlags()
+	}
+
+	t.Run("missing file fails", func(t *testing.T) {
+		if _, err := parse("-input-list", list); err == nil || !strings.Contains(err.Error(), "file not found: "+missing) {
+			t.Errorf("parseFlags() error = %v, expected the missing file to be reported", err)
+		}
+	})
+
+	t.Run("skip missing", func(t *testing.T) {
+		config, err := parse("-input-list", list, "-skip-missing", "../../testdata/pytest_junit.xml")
+		if err != nil {
+			t.Fatalf("parseFlags() error = %v", err)
+		}
+		want := []string{"../../testdata/pytest_junit.xml", "../../testdata/valid_junit.xml"}
+		if strings.Join(config.FilePaths, "|") != strings.Join(want, "|") || config.FilePath != want[0] {
+			t.Errorf("FilePaths = %q, FilePath = %q, want positional files first, then the list, without the missing one", config.FilePaths, config.FilePath)
+		}
+	})
+
+	t.Run("nothing left", func(t *testing.T) {
+		if _, err := parse("-skip-missing", missing); err == nil || !strings.Contains(err.Error(), "none of the files exist") {
+			t.Errorf("parseFlags() error = %v, expected an error when every file is missing", err)
+		}
+	})
+}
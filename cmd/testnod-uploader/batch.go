@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"testnod-uploader/internal/download"
+)
+
+// uploadsBatch reports whether -validate-only-first applies: several files
+// are uploaded, so each can be validated before the first upload starts.
+func uploadsBatch(config Config) bool {
+	return config.ValidateOnlyFirst && len(inputFiles(config)) > 1 &&
+		!config.ValidateFile && !config.CheckOnly && config.Export == ""
+}
+
+// validatedUpFront reports whether validateAll validates path. Standard input
+// and URLs are only read once, when the file is processed.
+func validatedUpFront(path string) bool {
+	return path != stdinPath && !download.IsURL(path)
+}
+
+// validateAll validates every file of the batch before any is uploaded and
+// reports whether they all passed. Otherwise every failure is listed, the
+// invalid files are counted as failed and the rest as skipped, since none is
+// uploaded. Files -resume will skip aren't validated.
+func validateAll(config Config, w io.Writer, summary *runSummary) bool {
+	files := inputFiles(config)
+	fmt.Fprintf(w, "Validating %d files before uploading any (-validate-only-first)...\n", len(files))
+
+	type failure struct {
+		path string
+		err  error
+	}
+	var failures []failure
+	for _, path := range files {
+		if !validatedUpFront(path) {
+			continue
+		}
+		if _, skip := checkResume(config, path); skip {
+			continue
+		}
+		fileConfig := config
+		fileConfig.FilePath = path
+		if err := validateFile(fileConfig); err != nil {
+			failures = append(failures, failure{path, err})
+		}
+	}
+	if len(failures) == 0 {
+		return true
+	}
+
+	fmt.Fprintf(w, "%d of %d files failed validation, so none were uploaded (-validate-only-first=false uploads the valid ones):\n", len(failures), len(files))
+	for _, f := range failures {
+		fmt.Fprintf(w, "  %s: %s\n", f.path, formatError(config, f.err))
+		annotate(config, messages(config), f.path, nil, f.err)
+		summary.Add(nil, f.err)
+	}
+	for range len(files) - len(failures) {
+		summary.Skip()
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateOnlyFirst(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	valid := write("valid.xml", `<testsuite name="s"><testcase name="a"/></testsuite>`)
+	truncated := write("truncated.xml", "<testsuite>")
+	notJUnit := write("not-junit.xml", "<html></html>")
+
+	t.Run("every invalid file is reported before any upload", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(valid)
+		config.FilePaths = []string{valid, truncated, notJUnit}
+		config.ValidateOnlyFirst = true
+
+		var out bytes.Buffer
+		var summary runSummary
+		if validateAll(config, &out, &summary) {
+			t.Fatal("validateAll() = true, want false with invalid files")
+		}
+		for _, want := range []string{"2 of 3 files failed validation", truncated + ": ", notJUnit + ": "} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("validateAll() output %q, want it to contain %q", out.String(), want)
+			}
+		}
+		if strings.Contains(out.String(), valid+": ") {
+			t.Errorf("validateAll() output %q lists the valid file", out.String())
+		}
+		if summary.Failed != 2 || summary.Skipped != 1 {
+			t.Errorf("validateAll() summary = %+v, want 2 failed and 1 skipped", summary)
+		}
+
+		summary = run(config)
+		if server.Creates != 0 || summary.Succeeded != 0 || summary.Failed != 2 {
+			t.Errorf("run() summary = %+v with %d create(s), want nothing uploaded", summary, server.Creates)
+		}
+	})
+
+	t.Run("valid batch is uploaded", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(valid)
+		config.FilePaths = []string{valid, valid}
+		config.ValidateOnlyFirst = true
+
+		summary := run(config)
+		if server.Creates != 2 || summary.Succeeded != 2 || summary.Failed != 0 {
+			t.Errorf("run() summary = %+v with %d create(s), want both uploaded", summary, server.Creates)
+		}
+	})
+
+	t.Run("disabled interleaves validation and upload", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(valid)
+		config.FilePaths = []string{valid, truncated, notJUnit}
+
+		summary := run(config)
+		if server.Creates != 1 || summary.Succeeded != 1 || summary.Failed != 2 {
+			t.Errorf("run() summary = %+v with %d create(s), want the valid file uploaded", summary, server.Creates)
+		}
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		if uploadsBatch(Config{ValidateOnlyFirst: true, FilePath: valid}) {
+			t.Error("uploadsBatch() = true for a single file")
+		}
+		if uploadsBatch(Config{ValidateOnlyFirst: true, ValidateFile: true, FilePaths: []string{valid, truncated}}) {
+			t.Error("uploadsBatch() = true with -validate")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"testnod-uploader/internal/errcode"
+)
+
+// attemptBudget is the -max-attempts-total budget of create and upload
+// attempts shared by every file of the invocation. A nil *attemptBudget is
+// unlimited.
+type attemptBudget struct {
+	mu    sync.Mutex
+	total int
+	used  int
+}
+
+func newAttemptBudget(total int) *attemptBudget {
+	if total <= 0 {
+		return nil
+	}
+	return &attemptBudget{total: total}
+}
+
+// use counts an attempt against the budget.
+func (b *attemptBudget) use() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used++
+}
+
+// remaining is how many attempts are left, or -1 without a budget.
+func (b *attemptBudget) remaining() int {
+	if b == nil {
+		return -1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total - b.used
+}
+
+// retryIf is the RetryIf predicate for the create and upload retry loops: a
+// failed attempt is only retried while the budget has attempts left.
+func (b *attemptBudget) retryIf(error) bool {
+	return b.remaining() != 0
+}
+
+// retryPredicate is the RetryIf predicate for the create and upload retry
+// loops: retries stop once the -max-attempts-total budget is used up, and
+// with -retry-on-timeout=false after an attempt that timed out, since a CI
+// job that missed its window gains nothing from waiting again. It's nil,
+// retrying every error, without either.
+func retryPredicate(config Config) func(err error) bool {
+	if config.attemptBudget == nil && config.RetryOnTimeout {
+		return nil
+	}
+	return func(err error) bool {
+		if !config.RetryOnTimeout && errcode.IsTimeout(err) {
+			return false
+		}
+		return config.attemptBudget.retryIf(err)
+	}
+}
+
+// check fails before a step starts once the budget is used up, so no
+// request is sent.
+func (b *attemptBudget) check(step string) error {
+	if b.remaining() != 0 {
+		return nil
+	}
+	return fmt.Errorf("not %s: all %d attempts used (-max-attempts-total)", step, b.total)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"testnod-uploader/internal/junit"
+)
+
+// countSkipped returns the number of skipped testcases and of all testcases
+// in doc.
+func countSkipped(doc *junit.Document) (skipped, total int) {
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		total++
+		if tc.Status() == junit.StatusSkipped {
+			skipped++
+		}
+	})
+	return skipped, total
+}
+
+// checksNeedDocument reports whether any of the checks on the file's
+// testcases is enabled. The file is then parsed once, and the document passed
+// to each of them.
+func checksNeedDocument(config Config) bool {
+	return config.SkippedThreshold > 0 || config.MinTests > 0 || config.RequireFailureMessages || config.NoUploadOnFailure
+}
+
+// checkSkippedThreshold fails if more than threshold of the document's
+// testcases were skipped. A threshold of 0 disables the check, and a document
+// without testcases passes.
+func checkSkippedThreshold(doc *junit.Document, threshold float64) error {
+	if threshold <= 0 {
+		return nil
+	}
+
+	skipped, total := countSkipped(doc)
+	if total == 0 {
+		return nil
+	}
+	if ratio := float64(skipped) / float64(total); ratio > threshold {
+		return fmt.Errorf("%d of %d tests (%.0f%%) were skipped, more than the -fail-on-skipped-threshold of %.0f%%", skipped, total, ratio*100, threshold*100)
+	}
+	return nil
+}
+
+// checkMinTests fails if the file has fewer than minTests testcases, which
+// usually means the test runner silently collected next to nothing. A
+// minimum of 0 disables the check.
+func checkMinTests(doc *junit.Document, filePath string, minTests int) error {
+	if minTests <= 0 {
+		return nil
+	}
+
+	if len(doc.Suites) == 0 {
+		return fmt.Errorf("%s has no test suites, expected at least %d tests (-min-tests)", filePath, minTests)
+	}
+	_, total := countSkipped(doc)
+	if total < minTests {
+		return fmt.Errorf("%s has %d tests, fewer than the -min-tests of %d", filePath, total, minTests)
+	}
+	return nil
+}
+
+// errFailingNotUploaded marks a file -no-upload-on-failure kept back. It's
+// counted as skipped rather than failed.
+var errFailingNotUploaded = errors.New("not uploading it (-no-upload-on-failure)")
+
+// checkNoFailures returns an error wrapping errFailingNotUploaded if any of
+// the file's testcases failed or errored.
+func checkNoFailures(doc *junit.Document, filePath string) error {
+	failing := 0
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		if status := tc.Status(); status == junit.StatusFailed || status == junit.StatusErrored {
+			failing++
+		}
+	})
+	if failing > 0 {
+		return fmt.Errorf("%s has %d failed or errored tests, %w", filePath, failing, errFailingNotUploaded)
+	}
+	return nil
+}
+
+// maxListedMissingMessages caps how many testcases a
+// -require-failure-messages error lists.
+const maxListedMissingMessages = 10
+
+// checkFailureMessages fails if any <failure> or <error> element has
+// neither a message attribute nor any text, listing the testcases it belongs
+// to, since such a failure can't be triaged from TestNod.
+func checkFailureMessages(doc *junit.Document, filePath string) error {
+	var offenders []string
+	check := func(tc *junit.Testcase, element string, results []junit.Result) {
+		for _, result := range results {
+			if strings.TrimSpace(result.Message) == "" && strings.TrimSpace(result.Text) == "" {
+				offenders = append(offenders, fmt.Sprintf("%s %s: <%s> without a message", tc.Classname, tc.Name, element))
+			}
+		}
+	}
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		check(tc, "failure", tc.Failures)
+		check(tc, "error", tc.Errors)
+	})
+	if len(offenders) == 0 {
+		return nil
+	}
+
+	listed := offenders[:min(len(offenders), maxListedMissingMessages)]
+	msg := fmt.Sprintf("%s has %d failure(s) or error(s) without a message (-require-failure-messages):\n  %s", filePath, len(offenders), strings.Join(listed, "\n  "))
+	if more := len(offenders) - len(listed); more > 0 {
+		msg += fmt.Sprintf("\n  ... and %d more", more)
+	}
+	return errors.New(msg)
+}
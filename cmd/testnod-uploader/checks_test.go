@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+// writeSkippedFixture writes a file with total testcases, skipped of them
+// skipped.
+func writeSkippedFixture(t *testing.T, skipped, total int) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString(`<testsuite name="s">`)
+	for i := range total {
+		if i < skipped {
+			fmt.Fprintf(&b, `<testcase name="t%d"><skipped/></testcase>`, i)
+		} else {
+			fmt.Fprintf(&b, `<testcase name="t%d"/>`, i)
+		}
+	}
+	b.WriteString(`</testsuite>`)
+
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	return path
+}
+
+// parseFixture parses the file at path for the checks.
+func parseFixture(t *testing.T, path string) *junit.Document {
+	t.Helper()
+	doc, err := junit.ParseFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	return doc
+}
+
+func TestCheckSkippedThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		skipped   int
+		total     int
+		threshold float64
+		wantErr   bool
+	}{
+		{name: "below", skipped: 1, total: 20, threshold: 0.1},
+		{name: "at", skipped: 2, total: 20, threshold: 0.1},
+		{name: "above", skipped: 3, total: 20, threshold: 0.1, wantErr: true},
+		{name: "mass skipped", skipped: 18, total: 20, threshold: 0.1, wantErr: true},
+		{name: "no testcases", skipped: 0, total: 0, threshold: 0.1},
+		{name: "disabled", skipped: 20, total: 20, threshold: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSkippedThreshold(parseFixture(t, writeSkippedFixture(t, tt.skipped, tt.total)), tt.threshold)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSkippedThreshold() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "-fail-on-skipped-threshold") {
+				t.Errorf("checkSkippedThreshold() error = %v, want it to name the flag", err)
+			}
+		})
+	}
+}
+
+func TestUploadToTestNodSkippedThreshold(t *testing.T) {
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(writeSkippedFixture(t, 9, 10))
+	config.SkippedThreshold = 0.5
+
+	if _, err := uploadToTestNod(config); err == nil {
+		t.Fatal("Expected the upload to fail above the skipped threshold")
+	}
+	if server.Creates != 0 {
+		t.Errorf("Expected no test run to be created, got %d", server.Creates)
+	}
+}
+
+func TestCheckMinTests(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		minTests int
+		wantErr  bool
+	}{
+		{name: "below", total: 4, minTests: 5, wantErr: true},
+		{name: "at", total: 5, minTests: 5},
+		{name: "above", total: 6, minTests: 5},
+		{name: "no testcases", total: 0, minTests: 1, wantErr: true},
+		{name: "disabled", total: 0, minTests: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSkippedFixture(t, 0, tt.total)
+			err := checkMinTests(parseFixture(t, path), path, tt.minTests)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMinTests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "-min-tests") {
+				t.Errorf("checkMinTests() error = %v, want it to name the flag", err)
+			}
+		})
+	}
+
+	t.Run("no suites", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.xml")
+		if err := os.WriteFile(path, []byte(`<testsuites/>`), 0o644); err != nil {
+			t.Fatalf("Failed to write fixture: %v", err)
+		}
+		if err := checkMinTests(parseFixture(t, path), path, 1); err == nil || !strings.Contains(err.Error(), "no test suites") {
+			t.Errorf("checkMinTests() error = %v, want a no test suites error", err)
+		}
+	})
+}
+
+func TestUploadToTestNodMinTests(t *testing.T) {
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(writeSkippedFixture(t, 0, 2))
+	config.MinTests = 3
+
+	if _, err := uploadToTestNod(config); err == nil {
+		t.Fatal("Expected the upload to fail below -min-tests")
+	}
+	if server.Creates != 0 {
+		t.Errorf("Expected no test run to be created, got %d", server.Creates)
+	}
+}
+
+func TestNoUploadOnFailure(t *testing.T) {
+	failing := filepath.Join(t.TempDir(), "failing.xml")
+	content := `<testsuite name="s"><testcase name="a"/><testcase name="b"><failure/></testcase><testcase name="c"><error/></testcase></testsuite>`
+	if err := os.WriteFile(failing, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	passing := writeSkippedFixture(t, 1, 3)
+
+	t.Run("failing suite is not uploaded", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(failing)
+		config.NoUploadOnFailure = true
+
+		_, err := uploadToTestNod(config)
+		if !errors.Is(err, errFailingNotUploaded) || !strings.Contains(err.Error(), "2 failed or errored tests") {
+			t.Errorf("uploadToTestNod() error = %v, want 2 failing tests kept back", err)
+		}
+		if server.Creates != 0 || server.Uploaded != nil {
+			t.Errorf("Created %d test run(s) for a failing suite, want none", server.Creates)
+		}
+	})
+
+	t.Run("passing suite is uploaded", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(passing)
+		config.NoUploadOnFailure = true
+
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if server.Creates != 1 || server.Uploaded == nil {
+			t.Errorf("Created %d test run(s) for a passing suite, want it uploaded", server.Creates)
+		}
+	})
+
+	t.Run("counted as skipped", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(failing)
+		config.FilePaths = []string{failing, passing}
+		config.NoUploadOnFailure = true
+
+		summary := run(config)
+		if summary.Succeeded != 1 || summary.Failed != 0 || summary.Skipped != 1 || summary.NotUploaded != 1 {
+			t.Errorf("run() summary = %+v, want the passing file uploaded and the failing one skipped", summary)
+		}
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+
+		for _, tt := range []struct {
+			args    []string
+			wantErr string
+		}{
+			{args: []string{"-no-upload-exit-code", "256"}, wantErr: "-no-upload-exit-code must be between 0 and 255"},
+			{args: []string{"-validate", "-no-upload-on-failure"}, wantErr: "-no-upload-on-failure only works when uploading"},
+		} {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "token", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags(%v) error = %v, want it to contain %q", tt.args, err, tt.wantErr)
+			}
+		}
+	})
+}
+
+func TestCheckFailureMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantCount int
+		wantList  []string
+	}{
+		{"passing", `<testsuite name="s"><testcase classname="c" name="a"/></testsuite>`, 0, nil},
+		{"messaged failures", `<testsuite name="s">
+<testcase classname="c" name="attr"><failure message="expected 1, got 2"/></testcase>
+<testcase classname="c" name="body"><error>panic: boom</error></testcase>
+</testsuite>`, 0, nil},
+		{"message-less", `<testsuite name="s">
+<testcase classname="c" name="ok"><failure message="expected 1, got 2"/></testcase>
+<testcase classname="c" name="bare"><failure/></testcase>
+<testcase classname="c" name="blank"><error message="  ">
+</error></testcase>
+</testsuite>`, 2, []string{"c bare: <failure> without a message", "c blank: <error> without a message"}},
+		{"long lists are capped", "<testsuite>" + strings.Repeat(`<testcase name="x"><failure/></testcase>`, 12) + "</testsuite>", 12, []string{"and 2 more"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results.xml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("Failed to write fixture: %v", err)
+			}
+
+			err := checkFailureMessages(parseFixture(t, path), path)
+			if tt.wantCount == 0 {
+				if err != nil {
+					t.Errorf("checkFailureMessages() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("has %d failure(s)", tt.wantCount)) {
+				t.Fatalf("checkFailureMessages() error = %v, want %d offenders", err, tt.wantCount)
+			}
+			for _, offender := range tt.wantList {
+				if !strings.Contains(err.Error(), offender) {
+					t.Errorf("error = %v, want it to list %q", err, offender)
+				}
+			}
+			if strings.Contains(err.Error(), " ok:") {
+				t.Errorf("error = %v, want only the offenders listed", err)
+			}
+		})
+	}
+}
+
+func TestUploadToTestNodRequireFailureMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(`<testsuite name="s"><testcase name="a"><failure/></testcase></testsuite>`), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.RequireFailureMessages = true
+
+	if _, err := uploadToTestNod(config); err == nil {
+		t.Fatal("Expected the upload to fail with -require-failure-messages")
+	}
+	if server.Creates != 0 {
+		t.Errorf("Expected no test run to be created, got %d", server.Creates)
+	}
+
+	config.RequireFailureMessages = false
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Errorf("uploadToTestNod() without the flag error = %v", err)
+	}
+}
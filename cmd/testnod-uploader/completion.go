@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const programName = "testnod-uploader"
+
+// hiddenFlags are left out of -help.
+var hiddenFlags = map[string]bool{"completion": true}
+
+// usage prints -help like flag.PrintDefaults, without the hidden flags.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", flag.CommandLine.Name())
+
+	visible := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+	visible.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		visible.Var(f.Value, f.Name, f.Usage)
+		visible.Lookup(f.Name).DefValue = f.DefValue
+	})
+	visible.PrintDefaults()
+}
+
+// completionFlag is a flag offered for completion. Value flags take an
+// argument; boolean flags don't.
+type completionFlag struct {
+	Name  string
+	Usage string
+	Value bool
+}
+
+// completionFlags lists the visible flags in flag.CommandLine, so the scripts
+// stay in step with the flag definitions.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		isBool := false
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			isBool = b.IsBoolFlag()
+		}
+		flags = append(flags, completionFlag{Name: f.Name, Usage: f.Usage, Value: !isBool})
+	})
+	return flags
+}
+
+// writeCompletion writes the completion script for shell (bash, zsh or
+// fish) to w.
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	var b strings.Builder
+
+	switch shell {
+	case "bash":
+		names := make([]string, len(flags))
+		for i, f := range flags {
+			names[i] = "-" + f.Name
+		}
+		fmt.Fprintf(&b, "_testnod_uploader() {\n")
+		fmt.Fprintf(&b, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+		fmt.Fprintf(&b, "\tif [[ \"$cur\" == -* ]]; then\n")
+		fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+		fmt.Fprintf(&b, "\telse\n")
+		fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		fmt.Fprintf(&b, "\tfi\n")
+		fmt.Fprintf(&b, "}\n")
+		fmt.Fprintf(&b, "complete -o filenames -F _testnod_uploader %s\n", programName)
+	case "zsh":
+		fmt.Fprintf(&b, "#compdef %s\n\n_arguments \\\n", programName)
+		for _, f := range flags {
+			spec := fmt.Sprintf("-%s[%s]", f.Name, zshEscape(firstSentence(f.Usage)))
+			if f.Value {
+				spec += ":" + f.Name + ":"
+			}
+			fmt.Fprintf(&b, "\t%s \\\n", shellQuote(spec))
+		}
+		fmt.Fprintf(&b, "\t'*:file:_files'\n")
+	case "fish":
+		for _, f := range flags {
+			fmt.Fprintf(&b, "complete -c %s -o %s -d %s", programName, f.Name, shellQuote(firstSentence(f.Usage)))
+			if f.Value {
+				fmt.Fprintf(&b, " -r")
+			}
+			fmt.Fprintf(&b, "\n")
+		}
+	default:
+		return fmt.Errorf("unsupported -completion shell %q: must be bash, zsh or fish", shell)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printCompletion handles -completion for main.
+func printCompletion(shell string) {
+	if err := writeCompletion(os.Stdout, shell); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// firstSentence trims a flag's usage to fit on a completion menu line.
+func firstSentence(usage string) string {
+	if i := strings.Index(usage, ". "); i >= 0 {
+		return usage[:i]
+	}
+	return usage
+}
+
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// shellQuote single-quotes s for bash, zsh and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-completion", "bash"}
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v, want -completion to need no file or token", err)
+	}
+	if config.Completion != "bash" {
+		t.Fatalf("Completion = %q, want bash", config.Completion)
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeCompletion(&out, shell); err != nil {
+				t.Fatalf("writeCompletion() error = %v", err)
+			}
+			script := out.String()
+			if script == "" {
+				t.Fatal("Expected a non-empty script")
+			}
+			option := func(name string) string {
+				if shell == "fish" {
+					return "-o " + name + " "
+				}
+				return "-" + name
+			}
+			for _, name := range []string{"token", "validate", "suite-filter"} {
+				if !strings.Contains(script, option(name)) {
+					t.Errorf("Script is missing -%s", name)
+				}
+			}
+			if strings.Contains(script, option("completion")) {
+				t.Error("Script offers the hidden -completion flag")
+			}
+		})
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
+
+func TestUsageHidesCompletion(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-completion", "zsh"}
+	parseFlags()
+
+	var out bytes.Buffer
+	flag.CommandLine.SetOutput(&out)
+	usage()
+
+	if !strings.Contains(out.String(), "-token") {
+		t.Errorf("usage() output is missing -token:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "-completion") {
+		t.Errorf("usage() output shows the hidden -completion flag:\n%s", out.String())
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/testnod"
+	"testnod-uploader/internal/upload"
+)
+
+// validateCoverage checks that the -coverage file is well-formed XML. Its
+// schema isn't checked, since Cobertura, JaCoCo and Clover reports all
+// differ.
+func validateCoverage(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errcode.Errorf(errcode.CoverageInvalid, "failed to open coverage file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	root := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errcode.Errorf(errcode.CoverageInvalid, "coverage file %s is not valid XML: %w", path, err)
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			root = true
+		}
+	}
+	if !root {
+		return errcode.Errorf(errcode.CoverageInvalid, "coverage file %s has no root element", path)
+	}
+	return nil
+}
+
+// uploadCoverage uploads the -coverage file to the coverage presigned URL of
+// the test run.
+func uploadCoverage(config Config, serverResponse testnod.SuccessfulServerResponse) error {
+	coverageURL := serverResponse.CoveragePresignedURL
+	if coverageURL == "" {
+		return errcode.Errorf(errcode.NoCoverageURL, "server did not return a coverage presigned URL; it may not support -coverage")
+	}
+	if parsed, err := url.Parse(coverageURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errcode.Errorf(errcode.NoCoverageURL, "server returned an invalid coverage presigned URL")
+	}
+
+	fmt.Println("Uploading coverage report...")
+	// The attempt and progress observers track the test results upload.
+	upload.SetAttemptObserver(nil)
+	upload.SetProgressObserver(nil)
+	if err := upload.UploadCoverageFile(config.Coverage, coverageURL); err != nil {
+		return fmt.Errorf("failed to upload coverage report: %w", err)
+	}
+	fmt.Println("Coverage report uploaded successfully!")
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/testnod"
+	"testnod-uploader/internal/upload"
+)
+
+const coberturaXML = `<?xml version="1.0"?>
+<coverage line-rate="0.8" branch-rate="0.5" version="1.9"><packages/></coverage>`
+
+func writeCoverage(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "coverage.xml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write coverage: %v", err)
+	}
+	return path
+}
+
+func TestCoverage(t *testing.T) {
+	t.Run("uploaded to the coverage URL", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.Coverage = writeCoverage(t, coberturaXML)
+
+		result, err := uploadToTestNod(config)
+		if err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if result.TestRunURL == "" || len(server.Uploaded) == 0 {
+			t.Errorf("uploadToTestNod() = %+v, want the test results uploaded too", result)
+		}
+		if string(server.CoverageUploaded) != coberturaXML {
+			t.Errorf("Coverage upload = %q, want %q", server.CoverageUploaded, coberturaXML)
+		}
+		if server.CoverageType != upload.CoverageContentType {
+			t.Errorf("Coverage Content-Type = %q, want %q", server.CoverageType, upload.CoverageContentType)
+		}
+	})
+
+	t.Run("not requested without -coverage", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		if _, err := uploadToTestNod(server.uploadConfig("../../testdata/valid_junit.xml")); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if server.CoverageUploaded != nil {
+			t.Errorf("Coverage uploaded without -coverage: %q", server.CoverageUploaded)
+		}
+	})
+
+	t.Run("invalid coverage fails before creating a run", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.Coverage = writeCoverage(t, "<coverage><packages></coverage>")
+
+		_, err := uploadToTestNod(config)
+		if errcode.Code(err) != errcode.CoverageInvalid {
+			t.Errorf("uploadToTestNod() error = %v, want %s", err, errcode.CoverageInvalid)
+		}
+		if server.Creates != 0 {
+			t.Errorf("Created %d test run(s) for an invalid coverage file", server.Creates)
+		}
+	})
+
+	t.Run("server without coverage support", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/storage/key" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(testnod.SuccessfulServerResponse{
+				TestRunURL:   "https://testnod.example/runs/1",
+				PresignedURL: "http://" + r.Host + "/storage/key",
+			})
+		}))
+		defer server.Close()
+
+		config := (&fakeTestNod{Server: server}).uploadConfig("../../testdata/valid_junit.xml")
+		config.Coverage = writeCoverage(t, coberturaXML)
+
+		if _, err := uploadToTestNod(config); errcode.Code(err) != errcode.NoCoverageURL {
+			t.Errorf("uploadToTestNod() error = %v, want %s", err, errcode.NoCoverageURL)
+		}
+	})
+}
+
+func TestValidateCoverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "cobertura", content: coberturaXML},
+		{name: "malformed", content: "<coverage>", wantErr: true},
+		{name: "not xml", content: "mode: set\nfoo.go:1.1,2.2 1 1\n", wantErr: true},
+		{name: "empty", content: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoverage(writeCoverage(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCoverage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFlagsCoverage(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	coverage := writeCoverage(t, coberturaXML)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "upload", args: []string{"-coverage", coverage}},
+		{name: "missing file", args: []string{"-coverage", coverage + ".missing"}, wantErr: "coverage file not found"},
+		{name: "validate", args: []string{"-validate", "-coverage", coverage}, wantErr: "-coverage only works when uploading"},
+		{name: "several files", args: []string{"-coverage", coverage, "../../testdata/pytest_junit.xml"}, wantErr: "-coverage uploads with a single file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "token", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+
+			_, err := parseFlags()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseFlags() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"testnod-uploader/internal/junit"
+)
+
+// maxFailureMessageLength is how many characters of a failure message
+// -report-failures prints before truncating it.
+const maxFailureMessageLength = 200
+
+// failedTestcase is one entry of the -report-failures list.
+type failedTestcase struct {
+	Classname string
+	Name      string
+	Message   string
+}
+
+// failingTestcases returns up to max failed or errored testcases of doc, in
+// document order, and the total number of them. A max of 0 means no limit.
+func failingTestcases(doc *junit.Document, max int) ([]failedTestcase, int) {
+	var failed []failedTestcase
+	total := 0
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		var results []junit.Result
+		switch tc.Status() {
+		case junit.StatusFailed:
+			results = tc.Failures
+		case junit.StatusErrored:
+			results = tc.Errors
+		default:
+			return
+		}
+		total++
+		if max > 0 && len(failed) >= max {
+			return
+		}
+		failed = append(failed, failedTestcase{Classname: tc.Classname, Name: tc.Name, Message: failureMessage(results)})
+	})
+	return failed, total
+}
+
+// failureMessage returns the first non-empty line of the first result's
+// message, or of its text when there is no message, truncated to
+// maxFailureMessageLength characters.
+func failureMessage(results []junit.Result) string {
+	if len(results) == 0 {
+		return ""
+	}
+	message := results[0].Message
+	if strings.TrimSpace(message) == "" {
+		message = results[0].Text
+	}
+
+	var line string
+	for _, l := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(l); line != "" {
+			break
+		}
+	}
+	if runes := []rune(line); len(runes) > maxFailureMessageLength {
+		line = string(runes[:maxFailureMessageLength]) + "..."
+	}
+	return line
+}
+
+// printFailures writes the -report-failures list. total is the number of
+// failing testcases, which is more than len(failed) when the list was capped.
+func printFailures(w io.Writer, failed []failedTestcase, total int) {
+	if total == 0 {
+		fmt.Fprintln(w, "No failing testcases.")
+		return
+	}
+
+	fmt.Fprintf(w, "%d failing testcase(s):\n", total)
+	for _, tc := range failed {
+		fmt.Fprintf(w, "  %s  %s\n", tc.Classname, tc.Name)
+		if tc.Message != "" {
+			fmt.Fprintf(w, "      %s\n", tc.Message)
+		}
+	}
+	if more := total - len(failed); more > 0 {
+		fmt.Fprintf(w, "  ... and %d more (-max-reported-failures)\n", more)
+	}
+}
+
+// reportFailures prints the failing testcases of the uploaded document for
+// -report-failures. A nil doc, for a file uploaded unchanged, is read from
+// the file; one that can't be parsed only warns, since the upload already
+// succeeded.
+func reportFailures(config Config, doc *junit.Document, w io.Writer) {
+	if doc == nil {
+		var err error
+		if doc, err = junit.ParseFile(config.FilePath); err != nil {
+			fmt.Fprintf(w, "Warning: can't report failures: %v\n", err)
+			return
+		}
+	}
+	failed, total := failingTestcases(doc, config.MaxReportedFailures)
+	printFailures(w, failed, total)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+var failuresInput = `<testsuites>
+  <testsuite name="api">
+    <testcase classname="api.Users" name="create"><failure message="expected 201, got 500">stack trace</failure></testcase>
+    <testcase classname="api.Users" name="delete"/>
+    <testcase classname="api.Users" name="update"><error type="panic">
+runtime error: nil pointer dereference
+goroutine 1 [running]:
+</error></testcase>
+    <testcase classname="api.Users" name="skipped"><skipped/></testcase>
+  </testsuite>
+  <testsuite name="db">
+    <testcase classname="db.Migrate" name="up"><failure message="` + strings.Repeat("x", 250) + `"/></testcase>
+    <testcase classname="db.Migrate" name="down"><failure/></testcase>
+  </testsuite>
+</testsuites>`
+
+func TestFailingTestcases(t *testing.T) {
+	doc, err := junit.Parse(strings.NewReader(failuresInput))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	failed, total := failingTestcases(doc, 0)
+	if total != 4 || len(failed) != 4 {
+		t.Fatalf("failingTestcases() = %d of %d, want 4 of 4", len(failed), total)
+	}
+
+	want := []failedTestcase{
+		{Classname: "api.Users", Name: "create", Message: "expected 201, got 500"},
+		{Classname: "api.Users", Name: "update", Message: "runtime error: nil pointer dereference"},
+		{Classname: "db.Migrate", Name: "up", Message: strings.Repeat("x", maxFailureMessageLength) + "..."},
+		{Classname: "db.Migrate", Name: "down"},
+	}
+	for i := range want {
+		if failed[i] != want[i] {
+			t.Errorf("failed[%d] = %+v, want %+v", i, failed[i], want[i])
+		}
+	}
+
+	t.Run("capped", func(t *testing.T) {
+		failed, total := failingTestcases(doc, 2)
+		if total != 4 || len(failed) != 2 || failed[1].Name != "update" {
+			t.Errorf("failingTestcases(2) = %+v of %d, want create and update of 4", failed, total)
+		}
+
+		var out bytes.Buffer
+		printFailures(&out, failed, total)
+		if !strings.HasPrefix(out.String(), "4 failing testcase(s):") || !strings.Contains(out.String(), "... and 2 more") {
+			t.Errorf("printFailures() = %q, want the total and a note about the 2 not printed", out.String())
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		var out bytes.Buffer
+		printFailures(&out, nil, 0)
+		if out.String() != "No failing testcases.\n" {
+			t.Errorf("printFailures() = %q", out.String())
+		}
+	})
+}
+
+func TestReportFailuresAfterUpload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(failuresInput), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.ReportFailures = true
+	config.MaxReportedFailures = 3
+
+	result, err := uploadToTestNod(config)
+	if err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+	var buf bytes.Buffer
+	reportFailures(config, result.Document, &buf)
+
+	out := buf.String()
+	for _, want := range []string{"4 failing testcase(s):", "api.Users  create", "expected 201, got 500", "db.Migrate  up", "... and 1 more"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output = %q, want it to contain %q", out, want)
+		}
+	}
+}
+
+func TestReportFailuresRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(failuresInput), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.ReportFailures = true
+	config.redactRegexps = []*regexp.Regexp{regexp.MustCompile(`got \d+`)}
+	config.suiteFilterRegexp = regexp.MustCompile(`^api$`)
+
+	result, err := uploadToTestNod(config)
+	if err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+	var buf bytes.Buffer
+	reportFailures(config, result.Document, &buf)
+
+	out := buf.String()
+	if !strings.Contains(out, "expected 201, ***") || strings.Contains(out, "got 500") {
+		t.Errorf("Output = %q, want the failure message as redacted for the upload", out)
+	}
+	if strings.Contains(out, "db.Migrate") {
+		t.Errorf("Output = %q, want the suites -suite-filter dropped left out", out)
+	}
+}
+
+func TestParseFlagsMaxReportedFailures(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-max-reported-failures", "-1", "../../testdata/valid_junit.xml"}
+
+	if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-max-reported-failures must not be negative") {
+		t.Errorf("parseFlags() error = %v, want a negative limit error", err)
+	}
+}
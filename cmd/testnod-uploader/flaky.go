@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"testnod-uploader/internal/download"
+	"testnod-uploader/internal/junit"
+)
+
+// flakyTestcase is a testcase that passed in some of the -detect-flaky input
+// and failed in the rest.
+type flakyTestcase struct {
+	Classname string
+	Name      string
+
+	// PassedIn and FailedIn are the files with each outcome, in input order.
+	// A file appears in both when it reruns the testcase.
+	PassedIn []string
+	FailedIn []string
+}
+
+// detectFlaky parses every file in paths and returns the testcases,
+// identified by classname and name, that both passed and failed or errored,
+// in the order they first appear. Skipped runs are ignored. Files that can't
+// be parsed are returned in unreadable so the caller can report them.
+func detectFlaky(paths []string) (flaky []flakyTestcase, unreadable []error) {
+	type key struct{ classname, name string }
+	var order []key
+	outcomes := make(map[key]*flakyTestcase)
+
+	for _, path := range paths {
+		doc, err := junit.ParseFile(path)
+		if err != nil {
+			unreadable = append(unreadable, err)
+			continue
+		}
+		doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+			k := key{tc.Classname, tc.Name}
+			entry, ok := outcomes[k]
+			if !ok {
+				entry = &flakyTestcase{Classname: tc.Classname, Name: tc.Name}
+				outcomes[k] = entry
+				order = append(order, k)
+			}
+			switch tc.Status() {
+			case junit.StatusPassed:
+				if !slices.Contains(entry.PassedIn, path) {
+					entry.PassedIn = append(entry.PassedIn, path)
+				}
+			case junit.StatusFailed, junit.StatusErrored:
+				if !slices.Contains(entry.FailedIn, path) {
+					entry.FailedIn = append(entry.FailedIn, path)
+				}
+			}
+		})
+	}
+
+	for _, k := range order {
+		if entry := outcomes[k]; len(entry.PassedIn) > 0 && len(entry.FailedIn) > 0 {
+			flaky = append(flaky, *entry)
+		}
+	}
+	return flaky, unreadable
+}
+
+// printFlaky writes the -detect-flaky report.
+func printFlaky(w io.Writer, flaky []flakyTestcase) {
+	if len(flaky) == 0 {
+		fmt.Fprintln(w, "No flaky testcases detected.")
+		return
+	}
+
+	fmt.Fprintf(w, "%d flaky testcase(s) passed in one file and failed in another:\n", len(flaky))
+	for _, tc := range flaky {
+		fmt.Fprintf(w, "  %s  %s\n", tc.Classname, tc.Name)
+		fmt.Fprintf(w, "      passed: %v\n", tc.PassedIn)
+		fmt.Fprintf(w, "      failed: %v\n", tc.FailedIn)
+	}
+}
+
+// reportFlaky runs -detect-flaky over the local input files before they are
+// processed. Files given as URLs or read from standard input aren't
+// analyzed, and unreadable files only warn, since processing them reports
+// the error anyway.
+func reportFlaky(config Config, w io.Writer) {
+	var paths []string
+	for _, path := range inputFiles(config) {
+		if path != stdinPath && !download.IsURL(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	flaky, unreadable := detectFlaky(paths)
+	for _, err := range unreadable {
+		fmt.Fprintf(w, "Warning: -detect-flaky skipped a file: %v\n", err)
+	}
+	printFlaky(w, flaky)
+}
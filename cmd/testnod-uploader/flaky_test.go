@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectFlaky(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	shard1 := write("shard1.xml", `<testsuite name="api">
+  <testcase classname="api.Users" name="create"/>
+  <testcase classname="api.Users" name="delete"><failure message="boom"/></testcase>
+  <testcase classname="api.Users" name="update"><skipped/></testcase>
+  <testcase classname="api.Orders" name="create"/>
+</testsuite>`)
+	shard2 := write("shard2.xml", `<testsuite name="api">
+  <testcase classname="api.Users" name="create"><error message="timeout"/></testcase>
+  <testcase classname="api.Users" name="delete"><failure message="boom"/></testcase>
+  <testcase classname="api.Users" name="update"/>
+  <testcase classname="api.Orders" name="create"/>
+</testsuite>`)
+	broken := write("broken.xml", "<testsuite>")
+
+	flaky, unreadable := detectFlaky([]string{shard1, shard2, broken})
+	if len(unreadable) != 1 {
+		t.Errorf("unreadable = %v, want the broken file", unreadable)
+	}
+	if len(flaky) != 1 {
+		t.Fatalf("detectFlaky() = %+v, want only api.Users create", flaky)
+	}
+	got := flaky[0]
+	if got.Classname != "api.Users" || got.Name != "create" || !slices.Equal(got.PassedIn, []string{shard1}) || !slices.Equal(got.FailedIn, []string{shard2}) {
+		t.Errorf("detectFlaky() = %+v, want create passing in shard1 and failing in shard2", got)
+	}
+
+	t.Run("rerun within one file", func(t *testing.T) {
+		rerun := write("rerun.xml", `<testsuites>
+  <testsuite name="first"><testcase classname="C" name="t"><failure/></testcase></testsuite>
+  <testsuite name="rerun"><testcase classname="C" name="t"/></testsuite>
+</testsuites>`)
+		if flaky, _ := detectFlaky([]string{rerun}); len(flaky) != 1 {
+			t.Errorf("detectFlaky() = %+v, want the rerun testcase reported", flaky)
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		var out bytes.Buffer
+		reportFlaky(Config{FilePaths: []string{shard1, shard2, "https://example.com/results.xml"}}, &out)
+		for _, want := range []string{"1 flaky testcase(s)", "api.Users  create", "passed: [" + shard1 + "]", "failed: [" + shard2 + "]"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("reportFlaky() = %q, want it to contain %q", out.String(), want)
+			}
+		}
+
+		out.Reset()
+		printFlaky(&out, nil)
+		if out.String() != "No flaky testcases detected.\n" {
+			t.Errorf("printFlaky() = %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"testnod-uploader/internal/junit"
+	"testnod-uploader/internal/rewrite"
+	"testnod-uploader/internal/testnod"
+)
+
+// groupByClassnamePrefix is the only -group-by mode: testcases are grouped by
+// their classname up to the first dot.
+const groupByClassnamePrefix = "classname-prefix"
+
+// ungroupedKey names the group of testcases whose classname has no prefix.
+const ungroupedKey = "ungrouped"
+
+// uploadGroups splits the file into one document per -group-by key and
+// uploads each as its own test run, tagged with the key. Every group is
+// attempted even after one fails; the first failure is returned along with
+// the results of the groups that were uploaded.
+func uploadGroups(config Config) ([]uploadResult, error) {
+	if !config.validated {
+		if err := validateFile(config); err != nil {
+			fmt.Printf("File validation failed: %s\n", formatError(config, err))
+			return nil, err
+		}
+	}
+	doc, err := junit.ParseFile(config.FilePath)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	// -min-tests, -require-failure-messages and -no-upload-on-failure apply
+	// to the whole file, not to each group.
+	if err := checkMinTests(doc, config.FilePath, config.MinTests); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	config.MinTests = 0
+	if config.RequireFailureMessages {
+		if err := checkFailureMessages(doc, config.FilePath); err != nil {
+			fmt.Println(err)
+			return nil, err
+		}
+		config.RequireFailureMessages = false
+	}
+	if config.NoUploadOnFailure {
+		if err := checkNoFailures(doc, config.FilePath); err != nil {
+			fmt.Println(err)
+			return nil, err
+		}
+		config.NoUploadOnFailure = false
+	}
+
+	groups := rewrite.Partition(doc, rewrite.ClassnamePrefix)
+	fmt.Printf("Split %s into %d group(s) by %s (-group-by)\n", config.FilePath, len(groups), config.GroupBy)
+
+	var results []uploadResult
+	var firstErr error
+	for _, group := range groups {
+		key := group.Key
+		if key == "" {
+			key = ungroupedKey
+		}
+		result, err := uploadGroup(config, key, group.Doc)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("group %q: %w", key, err)
+			}
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, firstErr
+}
+
+// uploadGroup writes one group's document to a temporary file and uploads it
+// with the group key added to the tags.
+func uploadGroup(config Config, key string, doc *junit.Document) (uploadResult, error) {
+	data, err := junit.Marshal(doc)
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("failed to write group: %w", err)
+	}
+	tmpFile, err := os.CreateTemp("", "testnod-group-*.xml")
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer removeTemp(config, tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("failed to write group: %w", err)
+	}
+
+	fmt.Printf("Uploading group %q...\n", key)
+	groupConfig := config
+	groupConfig.FilePath = tmpFile.Name()
+	groupConfig.Tags = prefixTags(append(slices.Clone(config.Tags), testnod.Tag{Value: key}), config.TagPrefix)
+	result, err := uploadToTestNod(groupConfig)
+	if result.Document == nil {
+		result.Document = doc
+	}
+	return result, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/testnod"
+)
+
+func TestGroupBy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	content := `<testsuites>
+  <testsuite name="api">
+    <testcase name="charge" classname="payments.api.Charges"/>
+    <testcase name="login" classname="identity.api.Sessions"/>
+  </testsuite>
+  <testsuite name="web">
+    <testcase name="checkout" classname="payments.web"><failure message="blank"/></testcase>
+    <testcase name="smoke" classname=""/>
+  </testsuite>
+</testsuites>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	var tags [][]string
+	var uploads []string
+	server.OnRequest = func(r *http.Request) {
+		switch r.URL.Path {
+		case "/integrations/test_runs/upload":
+			var body testnod.CreateTestRunRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			var values []string
+			for _, tag := range body.Tags {
+				values = append(values, tag.Value)
+			}
+			tags = append(tags, values)
+		case "/storage/key":
+			uploads = append(uploads, r.URL.Path)
+		}
+	}
+
+	config := server.uploadConfig(path)
+	config.GroupBy = groupByClassnamePrefix
+	config.Tags = uploadTagsFlag{{Value: "nightly"}}
+	summary := run(config)
+
+	if summary.Files != 1 || summary.Succeeded != 1 || len(summary.RunURLs) != 3 {
+		t.Errorf("summary = %+v, want one file uploaded as 3 runs", summary)
+	}
+	if server.Creates != 3 || len(uploads) != 3 {
+		t.Fatalf("Created %d runs with %d uploads, want 3 of each", server.Creates, len(uploads))
+	}
+	want := [][]string{{"nightly", "payments"}, {"nightly", "identity"}, {"nightly", ungroupedKey}}
+	for i := range want {
+		if !slices.Equal(tags[i], want[i]) {
+			t.Errorf("run %d tags = %v, want %v", i, tags[i], want[i])
+		}
+	}
+	if !strings.Contains(string(server.Uploaded), `name="smoke"`) || strings.Contains(string(server.Uploaded), "payments") {
+		t.Errorf("Last upload = %s, want only the ungrouped testcase", server.Uploaded)
+	}
+}
+
+func TestParseFlagsGroupBy(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"-token", "token", "-build-id", "1", "-group-by", "suite"}, `unsupported -group-by "suite"`},
+		{[]string{"-validate", "-group-by", "classname-prefix"}, "-group-by only works when uploading"},
+	} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append(append([]string{"cmd"}, tt.args...), "../../testdata/valid_junit.xml")
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseFlags(%q) error = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"testnod-uploader/internal/download"
+)
+
+// listFiles prints the files -list-files resolved from the arguments,
+// -input-list and TESTNOD_FILE, after -skip-missing dropped the missing
+// ones, sorted and with their sizes. Files given as URLs have no size until
+// they're downloaded.
+func listFiles(w io.Writer, paths []string) error {
+	sorted := slices.Clone(paths)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	var total int64
+	for _, path := range sorted {
+		if download.IsURL(path) {
+			fmt.Fprintf(w, "%s (URL)\n", path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		total += info.Size()
+		fmt.Fprintf(w, "%s (%d bytes)\n", path, info.Size())
+	}
+	fmt.Fprintf(w, "%d file(s), %d bytes\n", len(sorted), total)
+	return nil
+}
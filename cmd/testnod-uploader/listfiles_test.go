@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListFiles(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	b := write("b.xml", "<testsuite/>")
+	a := write("a.xml", "<testsuites></testsuites>")
+	c := write("c.xml", "<testsuite></testsuite>")
+	list := write("files.txt", c+"\n# not this one\n"+b+"\n")
+	missing := filepath.Join(dir, "missing.xml")
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-list-files", "-skip-missing", "-input-list", list, b, missing, a, "https://ci.example/results.xml"}
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v, want no token or build ID needed", err)
+	}
+
+	var out bytes.Buffer
+	if err := listFiles(&out, config.FilePaths); err != nil {
+		t.Fatalf("listFiles() error = %v", err)
+	}
+	want := strings.Join([]string{
+		a + " (25 bytes)",
+		b + " (12 bytes)",
+		c + " (23 bytes)",
+		"https://ci.example/results.xml (URL)",
+		"4 file(s), 60 bytes",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("listFiles() printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestParseFlagsListFiles(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, args := range [][]string{
+		{"-validate", "-list-files", "-stdin"},
+		{"-list-files", "-watch", "."},
+	} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd"}, args...)
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-list-files can't be combined") {
+			t.Errorf("parseFlags(%v) error = %v, want a combination error", args, err)
+		}
+	}
+}
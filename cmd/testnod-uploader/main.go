@@ -1,41 +1,263 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"testnod-uploader/internal/attemptlog"
+	"testnod-uploader/internal/checkpoint"
+	"testnod-uploader/internal/cimeta"
 	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/dotenv"
+	"testnod-uploader/internal/download"
+	"testnod-uploader/internal/dump"
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/export"
+	"testnod-uploader/internal/ghannotate"
+	"testnod-uploader/internal/gzipsniff"
+	"testnod-uploader/internal/hook"
+	"testnod-uploader/internal/jitter"
+	"testnod-uploader/internal/junit"
+	"testnod-uploader/internal/lint"
+	"testnod-uploader/internal/rewrite"
+	"testnod-uploader/internal/status"
 	"testnod-uploader/internal/testnod"
+	"testnod-uploader/internal/tracing"
+	"testnod-uploader/internal/transport"
 	"testnod-uploader/internal/upload"
 	"testnod-uploader/internal/validation"
+	"testnod-uploader/internal/watch"
+	"testnod-uploader/internal/webhook"
 )
 
 type uploadTagsFlag []testnod.Tag
 
+type stringListFlag []string
+
 const (
 	defaultBaseURL = "https://testnod.com"
+
+	defaultAttempts = 3
+
+	defaultFailureExitCode = 1
+
+	defaultWatchSettle = 5 * time.Second
+
+	defaultPreUploadHookTimeout = time.Minute
+
+	// defaultMaxDepth leaves plenty of room for nested testsuites while
+	// still stopping pathological nesting early.
+	defaultMaxDepth = 100
+
+	defaultMaxReportedFailures = 20
+
+	defaultQuickValidateKB = 64
+
+	defaultMaxDownloadMB = 100
+)
+
+// -on-duplicate-suite modes.
+const (
+	onDuplicateSuiteKeep   = "keep"
+	onDuplicateSuiteRename = "rename"
+	onDuplicateSuiteError  = "error"
 )
 
 type Config struct {
-	Token          string
-	ValidateFile   bool
-	Branch         string
-	CommitSHA      string
-	RunURL         string
-	BuildID        string
-	IgnoreFailures bool
-	BaseURL        string
-	Tags           uploadTagsFlag
-	FilePath       string
+	Token           string
+	TokenStdin      bool
+	BasicUser       string
+	BasicPass       string
+	BasicPassFile   string
+	BasicAuthUpload bool
+	ValidateFile    bool
+	CheckOnly       bool
+	Branch          string
+	CommitSHA       string
+	RunURL          string
+	BuildID         string
+	IgnoreFailures  bool
+	BaseURL         string
+	Tags            uploadTagsFlag
+	FilePath        string
+	FilePaths       []string
+	InputList       string
+	WebhookURL      string
+	SkipMissing     bool
+
+	ValidateOnlyFirst bool
+	// validated is set for a file -validate-only-first already validated.
+	validated bool
+	// downloaded is set for a file given as a URL, once FilePath is the
+	// local copy.
+	downloaded bool
+
+	OnFailureExitCode    int
+	NoUploadOnFailure    bool
+	NoUploadExitCode     int
+	StoreResponseHeaders stringListFlag
+	DumpDir              string
+	APIProxy             string
+	UploadProxy          string
+	ClientCert           string
+	ClientKey            string
+	ClientCertUpload     bool
+	SkipTLSVerifyUpload  bool
+	SkipUpload           bool
+	CreateOnly           string
+	GroupBy              string
+	Coverage             string
+	FailIfNoUploadURL    bool
+	RequestID            string
+	SchemaVersion        string
+	ReuseRun             string
+	Quiet                bool
+	PrintURLOnly         bool
+	ExpandTags           bool
+	ExpandTagsStrict     bool
+	TagPrefix            string
+	Export               string
+	OutputPath           string
+	SummaryMarkdown      string
+	markdown             *markdownSummary
+	MaxTestcases         int
+	MaxDownloadMB        int
+	CreateAttempts       int
+	UploadAttempts       int
+	SequenceRetries      int
+	MaxAttemptsTotal     int
+	RetryOnTimeout       bool
+	attemptBudget        *attemptBudget
+	Timing               bool
+	timings              *phaseTimings
+	Canonicalize         bool
+	SummaryJUnit         bool
+	CollapseRetries      bool
+	NormalizePaths       bool
+	StripDriveLetters    bool
+	ClassnamePrefix      string
+	FillEmptyClassname   string
+	RedactPatterns       stringListFlag
+	PreUploadHook        string
+	PreUploadHookTimeout time.Duration
+	redactRegexps        []*regexp.Regexp
+	SuiteFilter          string
+	suiteFilterRegexp    *regexp.Regexp
+	TagFromFilename      string
+	tagFromFilenameRe    *regexp.Regexp
+	MaxDepth             int
+	ValidateEncoding     string
+	ValidateMaxTime      float64
+	QuickValidate        bool
+	QuickValidateKB      int
+	WatchDir             string
+	WatchSettle          time.Duration
+	FilePatterns         stringListFlag
+	CompressionLevel     string
+	StatusFile           string
+	Resume               string
+	checkpoint           *checkpoint.File
+	AttemptLog           string
+	attemptLog           *attemptlog.Log
+	RequireMetadata      string
+	UploadMethod         string
+	UploadSuccessStatus  string
+	UploadURL            string
+	StorageBackend       string
+	uploadSuccess        []int
+	Output               string
+	KeepTemp             bool
+	OnDuplicateSuite     string
+	HTTP2                bool
+	RateLimit            float64
+	SampleRate           float64
+	SampleSeed           int64
+	sampleSeedSet        bool
+	RetryJitterSeed      uint64
+	retryJitterSeedSet   bool
+	MaxIdleConns         int
+	MaxIdleConnsPerHost  int
+	MaxConnsPerHost      int
+	SkippedThreshold     float64
+	MinTests             int
+	NoColor              bool
+	Stdin                bool
+	Completion           string
+	Environment          string
+	Note                 string
+	NoteFile             string
+	TopSlow              int
+	ReportFailures       bool
+	DetectFlaky          bool
+	GitHubAnnotations    bool
+	MaxReportedFailures  int
+	WarningsAsErrors     bool
+	ExpandCommitSHA      bool
+	CIMetadata           bool
+	EnvFile              string
+	PrintMetadata        bool
+	ListFiles            bool
+	status               *status.File
+
+	// RequireFailureMessages fails files with a <failure> or <error> that
+	// has neither a message nor any text.
+	RequireFailureMessages bool
+}
+
+// uploadResult is what the upload of one file produced. The attempt counts
+// are filled in as far as the upload got, even when it failed.
+type uploadResult struct {
+	TestRunURL     string
+	CreateAttempts int
+	UploadAttempts int
+	// Document is the file as uploaded, after -redact-pattern and the other
+	// rewrites, when it was parsed. Nil means it was uploaded unchanged.
+	Document *junit.Document
 }
 
 func main() {
 	config, err := parseFlags()
+
+	// -print-url-only keeps stdout for the test run URLs; everything else
+	// the run prints goes to stderr.
+	stdout := os.Stdout
+	if config.PrintURLOnly {
+		os.Stdout = os.Stderr
+	}
+
 	if err != nil {
 		fmt.Println(err)
-		exitBasedOnIgnoreFailures(config.IgnoreFailures)
+		exitBasedOnIgnoreFailures(config)
+	}
+
+	if config.Completion != "" {
+		printCompletion(config.Completion)
+	}
+
+	if config.ListFiles {
+		if err := listFiles(os.Stdout, config.FilePaths); err != nil {
+			fmt.Println(err)
+			exitBasedOnIgnoreFailures(config)
+		}
+		os.Exit(0)
 	}
 
 	config.BaseURL = os.Getenv("TESTNOD_BASE_URL")
@@ -43,6 +265,28 @@ func main() {
 		config.BaseURL = defaultBaseURL
 	}
 
+	if !config.ValidateFile && !config.CheckOnly && config.Export == "" && !sampledIn(config) {
+		fmt.Printf("Upload skipped by sampling (-sample-rate %g)\n", config.SampleRate)
+		os.Exit(0)
+	}
+
+	if !config.ValidateFile && !config.CheckOnly && config.Export == "" {
+		if warning := localRunURLWarning(config); warning != "" {
+			fmt.Println("Warning:", warning)
+		}
+		if config.RequestID == "" {
+			config.RequestID = newRequestID()
+			fmt.Printf("Request ID: %s\n", config.RequestID)
+		}
+		debug.SetPrefix("[request-id=" + config.RequestID + "]")
+	}
+
+	if config.PrintMetadata {
+		if err := printMetadata(messages(config), config); err != nil {
+			fmt.Println(err)
+		}
+	}
+
 	redactedToken := ""
 	if len(config.Token) >= 4 {
 		redactedToken = config.Token[:4] + "..."
@@ -50,12 +294,293 @@ func main() {
 	debug.Log("config: file=%s branch=%q commit-sha=%q tags=%s base-url=%s token=%s",
 		config.FilePath, config.Branch, config.CommitSHA, config.Tags.String(), config.BaseURL, redactedToken)
 
-	if config.ValidateFile {
-		validateOnly(config)
+	tracing.InitFromEnv()
+
+	if err := configureTransports(config); err != nil {
+		fmt.Println(err)
+		exitBasedOnIgnoreFailures(config)
+	}
+	if config.retryJitterSeedSet {
+		jitter.Seed(config.RetryJitterSeed)
+	}
+
+	summary := run(config)
+
+	markdownErr := config.markdown.write(messages(config))
+	if markdownErr != nil {
+		fmt.Println(markdownErr)
+	}
+
+	if !config.Quiet {
+		fmt.Println(summary)
+	}
+	if timing := config.timings.String(); timing != "" {
+		fmt.Println("Timing:", timing)
+	}
+
+	if summary.Failed > 0 || markdownErr != nil {
+		exitBasedOnIgnoreFailures(config)
+	}
+	if config.PrintURLOnly {
+		for _, runURL := range summary.RunURLs {
+			fmt.Fprintln(stdout, runURL)
+		}
+	}
+	if summary.NotUploaded > 0 {
+		os.Exit(config.NoUploadExitCode)
+	}
+	os.Exit(0)
+}
+
+// run processes each file argument, or every file written to the -watch directory, in
+// the selected mode.
+func run(config Config) runSummary {
+	summary := runSummary{Action: modeAction(config)}
+
+	if config.WatchDir != "" {
+		if err := watchDirectory(config, &summary); err != nil {
+			fmt.Println(err)
+			summary.Add(nil, err)
+		}
+		return summary
+	}
+
+	if config.CreateOnly != "" {
+		runURL, err := createOnly(config)
+		summary.Add([]string{runURL}, err)
+		return summary
+	}
+
+	if config.DetectFlaky {
+		reportFlaky(config, messages(config))
+	}
+
+	if config.ValidateFile && config.Output == "json" {
+		if err := writeValidationReport(os.Stdout, config, &summary); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			summary.Add(nil, err)
+		}
+		return summary
+	}
+
+	batchValidated := false
+	if uploadsBatch(config) {
+		if !validateAll(config, os.Stdout, &summary) {
+			return summary
+		}
+		batchValidated = true
+	}
+
+	for _, path := range inputFiles(config) {
+		fileConfig := config
+		fileConfig.FilePath = path
+		fileConfig.Tags = fileTags(config, path)
+		fileConfig.validated = batchValidated && validatedUpFront(path)
+
+		hash, skip := checkResume(config, path)
+		if skip {
+			fmt.Printf("Skipping %s: already uploaded according to %s (-resume)\n", path, config.Resume)
+			summary.Skip()
+			continue
+		}
+
+		runURLs, err := processFile(fileConfig)
+		annotate(config, messages(config), path, runURLs, err)
+		if err == nil && hash != "" {
+			if err := config.checkpoint.Record(path, hash, runURLs); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+		summary.Add(runURLs, err)
+	}
+	return summary
+}
+
+// checkResume hashes a local file for -resume and reports whether the
+// checkpoint lists it as uploaded. Files given as URLs aren't checkpointed,
+// and a file that can't be hashed is processed as usual, so its own error
+// is reported.
+func checkResume(config Config, path string) (hash string, skip bool) {
+	if config.checkpoint == nil || download.IsURL(path) {
+		return "", false
+	}
+	hash, err := checkpoint.Hash(path)
+	if err != nil {
+		return "", false
+	}
+	return hash, config.checkpoint.Done(path, hash)
+}
+
+// inputFiles is the files to process outside of -watch, in argument order.
+func inputFiles(config Config) []string {
+	if len(config.FilePaths) == 0 {
+		return []string{config.FilePath}
+	}
+	return config.FilePaths
+}
+
+// processFile handles a single file and returns the URLs of the test runs it
+// created, one per -group-by group or a single one otherwise. A file given as
+// a URL is downloaded first and removed once processing finishes.
+func processFile(config Config) (runURLs []string, err error) {
+	warnStatus(config.status.Start(config.FilePath))
+	defer func() {
+		if err != nil && !errors.Is(err, errFailingNotUploaded) {
+			warnStatus(config.status.Fail(err))
+		} else {
+			warnStatus(config.status.Finish())
+		}
+	}()
+
+	if download.IsURL(config.FilePath) {
+		localPath, err := downloadFile(config)
+		if err != nil {
+			return nil, err
+		}
+		defer removeTemp(config, localPath)
+		config.FilePath = localPath
+		config.downloaded = true
+	}
+	// The documents as uploaded, one per -group-by group, so the Markdown
+	// summary leaves out what the rewrites removed.
+	var uploaded []*junit.Document
+	defer func() { config.markdown.add(config.FilePath, uploaded) }()
+
+	switch {
+	case config.ValidateFile:
+		return nil, validateOnly(config)
+	case config.CheckOnly:
+		return nil, checkOnly(config)
+	case config.Export != "":
+		return nil, exportResults(config, os.Stdout)
+	default:
+		var results []uploadResult
+		if config.GroupBy != "" {
+			results, err = uploadGroups(config)
+		} else {
+			var result uploadResult
+			result, err = uploadToTestNod(config)
+			results = []uploadResult{result}
+		}
+		for _, result := range results {
+			if result.TestRunURL != "" {
+				runURLs = append(runURLs, result.TestRunURL)
+			}
+			uploaded = append(uploaded, result.Document)
+		}
+		// Failures are reported from the documents as uploaded, one per
+		// -group-by group, so they leave out what the rewrites removed.
+		if err == nil && config.ReportFailures {
+			for _, result := range results {
+				reportFailures(config, result.Document, os.Stdout)
+			}
+		}
+		return runURLs, err
+	}
+}
+
+// warnStatus reports a failed -status-file update without failing the run.
+func warnStatus(err error) {
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// annotate writes the -github-annotations workflow command for a processed
+// file: an error attached to the file when processing failed, or a notice
+// for each test run that was created.
+func annotate(config Config, w io.Writer, path string, runURLs []string, err error) {
+	if !config.GitHubAnnotations {
+		return
+	}
+	switch {
+	case errors.Is(err, errFailingNotUploaded):
+	case err != nil:
+		file := path
+		if path == stdinPath || download.IsURL(path) {
+			file = ""
+		}
+		ghannotate.Error(w, file, err.Error())
+	default:
+		for _, runURL := range runURLs {
+			ghannotate.Notice(w, "TestNod test run: "+runURL)
+		}
+	}
+}
+
+// watchDirectory processes each file matching -file-pattern written to the
+// -watch directory once it stops changing, until the process is interrupted.
+func watchDirectory(config Config, summary *runSummary) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watcher := watch.New(config.WatchSettle, func(path string) error {
+		fileConfig := config
+		fileConfig.FilePath = path
+		fileConfig.Tags = fileTags(config, path)
+		runURLs, err := processFile(fileConfig)
+		annotate(config, messages(config), path, runURLs, err)
+		summary.Add(runURLs, err)
+		return err
+	})
+	if len(config.FilePatterns) > 0 {
+		watcher.Patterns = config.FilePatterns
+	}
+
+	fmt.Printf("Watching %s for JUnit XML files, press Ctrl-C to stop...\n", config.WatchDir)
+	return watcher.Run(ctx, config.WatchDir)
+}
+
+// modeAction is the word the summary line uses for a successful file.
+func modeAction(config Config) string {
+	switch {
+	case config.ValidateFile:
+		return "valid"
+	case config.CheckOnly:
+		return "passed"
+	case config.Export != "":
+		return "exported"
+	case config.SkipUpload, config.CreateOnly != "":
+		return "created"
+	default:
+		return "uploaded"
+	}
+}
+
+// messages is where progress messages go: stderr when exported data, a
+// JSON report or -print-url-only's URLs are written to stdout, stdout
+// otherwise.
+func messages(config Config) io.Writer {
+	if (config.Export != "" && config.OutputPath == "") || config.Output == "json" || config.PrintURLOnly {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// removeTemp deletes an intermediate file once it's no longer needed, or
+// with -keep-temp leaves it on disk and prints its path.
+func removeTemp(config Config, path string) {
+	if config.KeepTemp {
+		fmt.Fprintln(messages(config), "Keeping temporary file:", path)
 		return
 	}
+	os.Remove(path)
+}
+
+// downloadFile fetches a file given as a URL into a temporary file.
+func downloadFile(config Config) (string, error) {
+	progress := messages(config)
+
+	fmt.Fprintln(progress, "Downloading file:", config.FilePath)
+	localPath, err := download.Fetch(config.FilePath, int64(config.MaxDownloadMB)<<20)
+	if err != nil {
+		err = fmt.Errorf("failed to download %s: %w", config.FilePath, err)
+		fmt.Fprintln(progress, err)
+		return "", err
+	}
 
-	uploadToTestNod(config)
+	debug.Log("downloaded %s to %s", config.FilePath, localPath)
+	return localPath, nil
 }
 
 func parseFlags() (Config, error) {
@@ -63,125 +588,1442 @@ func parseFlags() (Config, error) {
 	var tags uploadTagsFlag
 
 	flag.StringVar(&config.Token, "token", "", "TestNod project token")
+	flag.BoolVar(&config.TokenStdin, "token-stdin", false, "Read the TestNod project token from the first line of standard input")
+	flag.StringVar(&config.BasicUser, "basic-user", "", "Send HTTP Basic auth with this user on TestNod API requests, for a proxy in front of TestNod")
+	flag.StringVar(&config.BasicPass, "basic-pass", "", "Password for -basic-user (prefer -basic-pass-file or TESTNOD_BASIC_PASS, which keep it out of the process list)")
+	flag.StringVar(&config.BasicPassFile, "basic-pass-file", "", "Read the -basic-user password from the first line of this file")
+	flag.BoolVar(&config.BasicAuthUpload, "basic-auth-upload", false, "Also send the -basic-user credentials with the upload")
 	flag.BoolVar(&config.ValidateFile, "validate", false, "Checks if the file is a valid JUnit XML file, returns without uploading to TestNod")
+	flag.StringVar(&config.InputList, "input-list", "", "Read file paths to process from this file, one per line (# starts a comment), in addition to any file arguments")
+	flag.BoolVar(&config.ValidateOnlyFirst, "validate-only-first", true, "With several files, validate them all before uploading any, and upload none if one is invalid")
+	flag.BoolVar(&config.ListFiles, "list-files", false, "Print the files that would be processed, sorted and with their sizes, and exit without processing them")
+	flag.BoolVar(&config.SkipMissing, "skip-missing", false, "Skip files that don't exist with a warning instead of failing")
+	flag.BoolVar(&config.Stdin, "stdin", false, "With -validate, read the XML from standard input (same as a - file argument) and print a JSON result")
+	flag.BoolVar(&config.WarningsAsErrors, "warnings-as-errors", false, "Fail validation on warnings such as empty testsuites or testcases without a name, not only on errors")
+	flag.IntVar(&config.TopSlow, "top-slow", 0, "With -validate, also print the N slowest testcases by time")
+	flag.BoolVar(&config.GitHubAnnotations, "github-annotations", false, "Print failures as GitHub Actions ::error:: commands and the test run URL as a ::notice:: (on by default when GITHUB_ACTIONS=true)")
+	flag.BoolVar(&config.DetectFlaky, "detect-flaky", false, "Before processing, print testcases that passed in one input file and failed in another")
+	flag.BoolVar(&config.ReportFailures, "report-failures", false, "After a successful upload, print each failing testcase with the first line of its message")
+	flag.IntVar(&config.MaxReportedFailures, "max-reported-failures", defaultMaxReportedFailures, "With -report-failures, print at most this many testcases (0 means no limit)")
+	flag.StringVar(&config.Output, "output", "text", "Output format for -validate: text, or json for a report of every file on stdout")
+	flag.BoolVar(&config.CheckOnly, "check-only", false, "Lints the file for common JUnit mistakes, returns without uploading to TestNod")
+	flag.StringVar(&config.Export, "export", "", "Convert the file to another format (json) and write it to -o instead of uploading to TestNod")
+	flag.StringVar(&config.OutputPath, "o", "", "Output file for -export (defaults to stdout)")
+	flag.StringVar(&config.SummaryMarkdown, "summary-markdown", "", "Write a Markdown table of each suite's counts and a list of the failing tests of every processed file to this path, e.g. for a pull request comment")
 	flag.StringVar(&config.Branch, "branch", "", "The branch name used for this test run")
 	flag.StringVar(&config.CommitSHA, "commit-sha", "", "The commit SHA used for this test run")
+	flag.BoolVar(&config.ExpandCommitSHA, "expand-commit-sha", false, "Resolve a short -commit-sha to the full SHA with git; keeps the given value with a warning if it can't")
+	flag.BoolVar(&config.PrintMetadata, "print-metadata", false, "Print the resolved run metadata (branch, commit SHA, run URL, build ID, environment) as JSON before processing")
+	flag.StringVar(&config.EnvFile, "env-file", "", "Load KEY=VALUE lines from this .env file into the environment, without overriding variables already set, before anything reads it")
+	flag.BoolVar(&config.CIMetadata, "ci-metadata", false, "Fill in branch, commit SHA, run URL, build ID and environment left empty from the detected CI provider (GitHub Actions, GitLab CI)")
 	flag.StringVar(&config.RunURL, "run-url", "", "The URL to the CI/CD run")
 	flag.StringVar(&config.BuildID, "build-id", "", "The build identifier for the CI/CD run")
+	flag.StringVar(&config.Environment, "environment", "", "The environment this test run belongs to, e.g. ci, staging or nightly")
+	flag.StringVar(&config.Note, "note", "", "A free-form note to attach to the test run, e.g. \"re-run after infra fix\"")
+	flag.StringVar(&config.NoteFile, "note-file", "", "Read the -note text from this file")
+	flag.StringVar(&config.RequireMetadata, "require-metadata", "", "Comma-separated metadata fields that must not be empty (branch, commit_sha, run_url, build_id, environment)")
+	flag.IntVar(&config.MaxDownloadMB, "max-download-mb", defaultMaxDownloadMB, "Maximum size in megabytes of a file given as an http(s):// URL")
+	flag.IntVar(&config.MaxTestcases, "max-testcases", 0, "Fail validation if the file contains more than this many testcases (0 means no limit)")
+	flag.BoolVar(&config.RequireFailureMessages, "require-failure-messages", false, "Fail if a failure or error has neither a message attribute nor any text, listing the testcases")
+	flag.IntVar(&config.MinTests, "min-tests", 0, "Fail if a file has fewer than this many tests, e.g. because the test runner collected almost nothing (0 means no minimum)")
+	flag.Float64Var(&config.SkippedThreshold, "fail-on-skipped-threshold", 0, "Fail if more than this fraction of the tests were skipped, e.g. 0.1 (0 means no limit)")
+	flag.IntVar(&config.MaxDepth, "max-depth", defaultMaxDepth, "Fail validation if elements are nested deeper than this (0 means no limit)")
+	flag.Float64Var(&config.ValidateMaxTime, "validate-max-time", 0, "Fail validation if a testsuite or testcase time is negative or more than this many seconds (0 disables the check)")
+	flag.StringVar(&config.ValidateEncoding, "validate-encoding", "", "Fail validation unless the file is encoded in this charset (only utf-8 is supported)")
+	flag.BoolVar(&config.QuickValidate, "quick-validate", false, "Only check that the file starts like JUnit XML: stop at the first testsuite or testsuites element instead of reading to the end, skipping warnings")
+	flag.IntVar(&config.QuickValidateKB, "quick-validate-kb", defaultQuickValidateKB, "With -quick-validate, fail if no testsuite or testsuites element is found in this many kilobytes (0 means no limit)")
+	flag.BoolVar(&config.Canonicalize, "canonicalize", false, "Re-serialize the file with consistent indentation and attribute order before uploading")
+	flag.BoolVar(&config.NormalizePaths, "normalize-paths", false, "Turn backslashes into forward slashes in testcase classnames and names before uploading, so Windows and Unix results match")
+	flag.BoolVar(&config.StripDriveLetters, "strip-drive-letters", false, "With -normalize-paths, also remove leading drive letters such as C: from classnames and names")
+	flag.BoolVar(&config.CollapseRetries, "collapse-retries", false, "Merge repeated testcases (same classname and name) within a suite into one with the last outcome and every attempt's system-out before uploading")
+	flag.BoolVar(&config.SummaryJUnit, "summary-junit", false, "Wrap a bare <testsuite> file in a <testsuites> element with aggregate tests, failures, errors and time before uploading")
+	flag.StringVar(&config.ClassnamePrefix, "classname-prefix", "", "Prepend this to every testcase classname before uploading")
+	flag.StringVar(&config.FillEmptyClassname, "fill-empty-classname", "", "Give testcases without a classname this one (after -classname-prefix) instead of leaving it empty")
+	flag.StringVar(&config.OnDuplicateSuite, "on-duplicate-suite", onDuplicateSuiteKeep, "What to do when testsuites share a name: keep, rename (append a counter) or error")
+	flag.StringVar(&config.SuiteFilter, "suite-filter", "", "Upload only the top-level testsuites whose name matches this regular expression, with the file's totals recomputed")
+	flag.Var(&config.RedactPatterns, "redact-pattern", "Replace matches of this regular expression in failure, error and system output text with *** before uploading (can be repeated)")
+	flag.StringVar(&config.PreUploadHook, "pre-upload-hook", "", "Shell command to run on the file right before upload, with {file} replaced by its path. A non-zero exit aborts the upload")
+	flag.DurationVar(&config.PreUploadHookTimeout, "pre-upload-hook-timeout", defaultPreUploadHookTimeout, "How long -pre-upload-hook may run before it's killed")
+	flag.BoolVar(&config.KeepTemp, "keep-temp", false, "Leave downloaded and rewritten intermediate files on disk and print their paths instead of deleting them")
+	flag.StringVar(&config.SchemaVersion, "schema-version", testnod.SchemaVersion, "Request schema version declared to TestNod in the X-TestNod-Schema-Version header of the create test run request")
+	flag.StringVar(&config.RequestID, "request-id", "", "ID sent as an X-Request-Id header on create and upload requests and included in logs, to match them with TestNod's server logs (default: random)")
+	flag.BoolVar(&config.FailIfNoUploadURL, "fail-if-no-upload-url", true, "Fail when the server's create response has no usable presigned URL; set to false only with an -upload-url {id} template")
+	flag.StringVar(&config.Coverage, "coverage", "", "Upload this coverage XML report alongside the test results, to a coverage upload URL the server returns")
+	flag.StringVar(&config.GroupBy, "group-by", "", "Split each file into groups and upload each group as its own test run, tagged with its key (supported: classname-prefix)")
+	flag.StringVar(&config.CreateOnly, "create-only", "", "Create the test run without a file and save the response, presigned URL included, to this file for a later -reuse-run")
+	flag.StringVar(&config.ReuseRun, "reuse-run", "", "Upload the file to the test run saved by -create-only in this file instead of creating one")
+	flag.BoolVar(&config.SkipUpload, "skip-upload", false, "Create the test run and print the server's response, but don't upload the file (for debugging)")
 	flag.BoolVar(&config.IgnoreFailures, "ignore-failures", false, "Always return an exit code of 0 even if there are errors")
+	flag.BoolVar(&config.NoUploadOnFailure, "no-upload-on-failure", false, "Don't create a test run or upload a file whose tests failed or errored")
+	flag.IntVar(&config.NoUploadExitCode, "no-upload-exit-code", 0, "Exit code to use when -no-upload-on-failure kept a file back (0-255)")
+	flag.IntVar(&config.OnFailureExitCode, "on-failure-exit-code", defaultFailureExitCode, "Exit code to use when the run fails (1-255, ignored with -ignore-failures)")
 
 	flag.Var(&tags, "tag", "Add a tag to this test run (can be repeated)")
+	flag.BoolVar(&config.ExpandTags, "expand-tags", false, "Expand ${VAR} and $VAR in tag values from the environment")
+	flag.StringVar(&config.TagFromFilename, "tag-from-filename", "", "Tag each file's test run with the first capture group of this regular expression matched against the file's name, e.g. 'shard-(\\d+)'")
+	flag.StringVar(&config.TagPrefix, "tag-prefix", "", "Prepend this prefix to every tag that doesn't already start with it, e.g. ci/")
+	flag.BoolVar(&config.ExpandTagsStrict, "expand-tags-strict", false, "With -expand-tags, fail if a tag references an unset variable instead of expanding it to an empty string")
+	flag.IntVar(&config.CreateAttempts, "retries-include-create", defaultAttempts, "Number of attempts for creating the test run (1 disables retries)")
+	flag.IntVar(&config.UploadAttempts, "retries-include-upload", defaultAttempts, "Number of attempts for uploading the file to the presigned URL (1 disables retries)")
+	flag.IntVar(&config.SequenceRetries, "sequence-retries", 0, "When the upload still fails after its retries, create the test run again for a fresh upload URL and retry the upload, up to this many times")
+	flag.BoolVar(&config.Timing, "timing", false, "Print the wall-clock time spent validating, creating test runs and uploading at the end, summed over all files")
+	flag.BoolVar(&config.RetryOnTimeout, "retry-on-timeout", true, "Retry create and upload attempts that timed out; with false, a timeout fails right away instead of using up the remaining attempts")
+	flag.IntVar(&config.MaxAttemptsTotal, "max-attempts-total", 0, "Cap create and upload attempts combined, across all files, at this many; fail fast once they're used up (0 means no limit)")
+	flag.StringVar(&config.UploadMethod, "upload-method", http.MethodPut, "HTTP method for uploading to the presigned URL (PUT or POST)")
+	flag.StringVar(&config.StorageBackend, "storage-backend", upload.BackendS3, "Storage the presigned URL points at, for the headers it requires (s3, azure or gcs)")
+	flag.StringVar(&config.UploadURL, "upload-url", "", "Upload the file to this URL instead of the presigned URL the server returns; {id} is replaced with the created run's ID")
+	flag.StringVar(&config.UploadSuccessStatus, "upload-success-status", "", "Comma-separated 2xx statuses that count as a successful upload, e.g. 200,204 (default any 2xx)")
+	flag.StringVar(&config.CompressionLevel, "compression-level", "", "Gzip the upload at this level (0-9 or a compress/gzip constant name such as BestSpeed); uploads uncompressed if unset")
+	flag.StringVar(&config.DumpDir, "dump-dir", "", "Write request/response payloads to this directory for support tickets (token redacted)")
+	flag.StringVar(&config.APIProxy, "api-proxy", "", "Proxy URL for TestNod API requests, or \"direct\" to bypass proxies (defaults to HTTP_PROXY/HTTPS_PROXY/NO_PROXY)")
+	flag.StringVar(&config.UploadProxy, "upload-proxy", "", "Proxy URL for the presigned URL upload, or \"direct\" to bypass proxies (defaults to HTTP_PROXY/HTTPS_PROXY/NO_PROXY)")
+	flag.StringVar(&config.WatchDir, "watch", "", "Watch this directory and process each JUnit XML file (*.xml, *.junit or *.junit.xml unless -file-pattern is set) once it stops changing, until interrupted")
+	flag.Var(&config.FilePatterns, "file-pattern", "With -watch, process files whose names match this glob instead of the defaults (can be repeated)")
+	flag.DurationVar(&config.WatchSettle, "watch-settle", defaultWatchSettle, "With -watch, how long a file must go without writes before it's processed")
+	flag.StringVar(&config.Completion, "completion", "", "Print a shell completion script (bash, zsh or fish) and exit")
+	flag.BoolVar(&config.HTTP2, "http2", true, "Allow HTTP/2 for TestNod API requests and the upload; -http2=false forces HTTP/1.1")
+	flag.IntVar(&config.MaxConnsPerHost, "max-conns-per-host", 0, "Limit connections per host, idle or in use, for TestNod API requests and uploads each (0 means no limit)")
+	flag.IntVar(&config.MaxIdleConns, "max-idle-conns", 0, "Keep at most this many idle connections open across hosts (0 keeps Go's default of 100)")
+	flag.IntVar(&config.MaxIdleConnsPerHost, "max-idle-conns-per-host", 0, "Keep at most this many idle connections open per host (0 keeps Go's default of 2)")
+	flag.Float64Var(&config.SampleRate, "sample-rate", 1, "Upload with this probability, e.g. 0.1 for one invocation in ten; otherwise exit 0 without creating a test run")
+	flag.Uint64Var(&config.RetryJitterSeed, "retry-jitter-seed", 0, "Seed the random jitter added to retry delays so the delays are the same on every run (default: random)")
+	flag.Int64Var(&config.SampleSeed, "sample-seed", 0, "Seed the -sample-rate decision so it's reproducible (default: random)")
+	flag.Float64Var(&config.RateLimit, "rate-limit", 0, "Cap TestNod API requests and uploads combined at this many per second; requests wait their turn (0 means no limit)")
+	flag.StringVar(&config.ClientCert, "client-cert", "", "PEM client certificate for TestNod API servers that require mutual TLS (requires -client-key)")
+	flag.StringVar(&config.ClientKey, "client-key", "", "PEM private key for -client-cert")
+	flag.BoolVar(&config.SkipTLSVerifyUpload, "skip-tls-verify-upload", false, "Don't verify the storage server's TLS certificate when uploading to the presigned URL; TestNod API requests stay verified")
+	flag.BoolVar(&config.ClientCertUpload, "client-cert-upload", false, "Also present -client-cert when uploading to the presigned URL")
+	flag.StringVar(&config.AttemptLog, "attempt-log", "", "Append a JSON line with the status, duration and error of every create and upload attempt to this file")
+	flag.StringVar(&config.WebhookURL, "webhook-url", "", "POST the test run's ID, URL, project and file as JSON to this URL after a successful upload; failures only warn")
+	flag.StringVar(&config.Resume, "resume", "", "Record uploaded files in this checkpoint file and skip files it lists as uploaded with unchanged content")
+	flag.StringVar(&config.StatusFile, "status-file", "", "Keep this file updated with the current phase, file and bytes uploaded as JSON, for CI UIs that poll it")
+	flag.BoolVar(&config.NoColor, "no-color", false, "Don't color error codes (also disabled by NO_COLOR or when stdout isn't a terminal)")
+	flag.BoolVar(&config.Quiet, "quiet", false, "Don't print the summary line at the end of the run")
+	flag.BoolVar(&config.PrintURLOnly, "print-url-only", false, "Print only the test run URL to stdout on success, for piping to another program; every other message goes to stderr")
+	flag.Var(&config.StoreResponseHeaders, "store-response-header", "Print this header from the create test run response (can be repeated)")
 
-	flag.Parse()
+	args, err := expandArgFiles(os.Args[1:])
+	if err != nil {
+		return config, err
+	}
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 	config.Tags = tags
 
-	args := flag.Args()
-	if len(args) == 0 {
-		return config, fmt.Errorf("no file specified")
+	// -completion needs neither a file nor a token.
+	if config.Completion != "" {
+		return config, nil
 	}
 
-	config.FilePath = args[0]
-	if _, err := os.Stat(config.FilePath); os.IsNotExist(err) {
-		return config, fmt.Errorf("file not found: %s", config.FilePath)
+	// Everything below may read the environment, CI detection included.
+	if config.EnvFile != "" {
+		loaded, err := dotenv.Load(config.EnvFile)
+		if err != nil {
+			return config, err
+		}
+		debug.Log("loaded %s from %s", strings.Join(loaded, ", "), config.EnvFile)
 	}
 
-	if !config.ValidateFile && config.Token == "" {
-		return config, fmt.Errorf("no token specified")
+	// CI metadata describes this run, so it wins over the repository's
+	// defaults in .testnod-meta.json.
+	if config.CIMetadata {
+		applyCIMetadata(&config, cimeta.OSGetenv)
 	}
 
-	if !config.ValidateFile && config.BuildID == "" {
-		return config, fmt.Errorf("no build ID specified (-build-id is required)")
+	if wd, err := os.Getwd(); err == nil {
+		if err := applyMetaFile(&config, wd); err != nil {
+			return config, err
+		}
 	}
 
-	return config, nil
-}
+	if config.ExpandTags {
+		expanded, err := expandTags(config.Tags, config.ExpandTagsStrict)
+		if err != nil {
+			return config, err
+		}
+		config.Tags = expanded
+	}
 
-func validateOnly(config Config) {
-	fmt.Println("Validating file:", config.FilePath)
+	if config.TagPrefix != "" {
+		config.Tags = prefixTags(config.Tags, config.TagPrefix)
+	}
 
-	err := validation.ValidateJUnitXMLFile(config.FilePath)
-	if err != nil {
-		fmt.Println(err)
-		exitBasedOnIgnoreFailures(config.IgnoreFailures)
+	for _, pattern := range config.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return config, fmt.Errorf("invalid -redact-pattern %q: %w", pattern, err)
+		}
+		config.redactRegexps = append(config.redactRegexps, re)
 	}
 
-	fmt.Printf("%s is a valid JUnit XML file!\n", config.FilePath)
-	os.Exit(0)
-}
+	if config.SuiteFilter != "" {
+		re, err := regexp.Compile(config.SuiteFilter)
+		if err != nil {
+			return config, fmt.Errorf("invalid -suite-filter %q: %w", config.SuiteFilter, err)
+		}
+		config.suiteFilterRegexp = re
+	}
 
-func uploadToTestNod(config Config) {
-	err := validation.ValidateJUnitXMLFile(config.FilePath)
-	if err != nil {
-		fmt.Printf("File validation failed: %v\n", err)
-		exitBasedOnIgnoreFailures(config.IgnoreFailures)
+	if config.TagFromFilename != "" {
+		re, err := regexp.Compile(config.TagFromFilename)
+		if err != nil {
+			return config, fmt.Errorf("invalid -tag-from-filename %q: %w", config.TagFromFilename, err)
+		}
+		if re.NumSubexp() == 0 {
+			return config, fmt.Errorf("invalid -tag-from-filename %q: needs a capture group for the tag value", config.TagFromFilename)
+		}
+		config.tagFromFilenameRe = re
 	}
 
-	fmt.Printf("%s is a valid JUnit XML file. Creating test run...\n", config.FilePath)
+	config.UploadMethod = strings.ToUpper(config.UploadMethod)
+	if config.UploadMethod != http.MethodPut && config.UploadMethod != http.MethodPost {
+		return config, fmt.Errorf("unsupported -upload-method %q (supported: PUT, POST)", config.UploadMethod)
+	}
 
-	uploadRequest := testnod.CreateTestRunRequest{
-		Tags: config.Tags,
-		TestRun: testnod.TestRun{
-			Metadata: testnod.TestRunMetadata{
-				Branch:    config.Branch,
-				CommitSHA: config.CommitSHA,
-				RunURL:    config.RunURL,
-				BuildID:   config.BuildID,
-			},
-		},
+	config.StorageBackend = strings.ToLower(config.StorageBackend)
+	if !upload.IsStorageBackend(config.StorageBackend) {
+		return config, fmt.Errorf("unsupported -storage-backend %q (supported: s3, azure, gcs)", config.StorageBackend)
 	}
 
-	uploadURL := config.BaseURL + "/integrations/test_runs/upload"
-	debug.Log("CreateTestRun URL: %s", uploadURL)
-	serverResponse, err := testnod.CreateTestRun(uploadURL, config.Token, uploadRequest)
-	if err != nil {
-		fmt.Printf("Error creating test run on TestNod: %v\n", err)
-		exitBasedOnIgnoreFailures(config.IgnoreFailures)
+	if config.UploadURL != "" {
+		u, err := url.Parse(strings.ReplaceAll(config.UploadURL, uploadIDPlaceholder, "0"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return config, fmt.Errorf("invalid -upload-url %q: must be an http(s) URL", config.UploadURL)
+		}
 	}
 
-	debug.Log("test run created: id=%d test_run_id=%d upload_id=%d presigned-url-host=%s", serverResponse.ID, serverResponse.TestRunID, serverResponse.UploadID, serverResponse.PresignedURL[:min(60, len(serverResponse.PresignedURL))])
+	if strings.TrimSpace(config.SchemaVersion) == "" {
+		return config, fmt.Errorf("-schema-version must not be empty")
+	}
 
-	fmt.Println("Created test run, uploading JUnit XML file...")
-	debug.Log("uploading file: %s", config.FilePath)
-	err = upload.UploadJUnitXmlFile(config.FilePath, serverResponse.PresignedURL)
+	if config.RequestID != "" && !requestIDPattern.MatchString(config.RequestID) {
+		return config, fmt.Errorf("invalid -request-id %q: use up to 128 letters, digits, '.', '_', ':' or '-'", config.RequestID)
+	}
 
-	if err != nil {
-		fmt.Println("There was an error uploading the file to TestNod. We've been notified and will look into it. Sorry for the inconvenience.")
+	if !config.FailIfNoUploadURL && !strings.Contains(config.UploadURL, uploadIDPlaceholder) {
+		return config, fmt.Errorf("-fail-if-no-upload-url=false requires an -upload-url with an %s template", uploadIDPlaceholder)
+	}
 
-		debug.Log("notifying TestNod of upload failure for upload %d (test run %d)", serverResponse.UploadID, serverResponse.TestRunID)
-		notifyErr := testnod.NotifyUploadFailure(
-			config.BaseURL,
-			config.Token,
-			serverResponse.UploadID,
-			serverResponse.TestRunID,
-			"The test results file could not be uploaded. Please try again or contact support if the issue persists.",
-		)
-		if notifyErr != nil {
-			debug.Log("failed to notify TestNod of upload failure: %v", notifyErr)
+	if config.UploadSuccessStatus != "" {
+		for _, field := range strings.Split(config.UploadSuccessStatus, ",") {
+			status, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || status < 200 || status > 299 {
+				return config, fmt.Errorf("invalid -upload-success-status %q: must be comma-separated 2xx statuses", config.UploadSuccessStatus)
+			}
+			config.uploadSuccess = append(config.uploadSuccess, status)
 		}
+	}
 
-		exitBasedOnIgnoreFailures(config.IgnoreFailures)
+	if config.CompressionLevel != "" {
+		if _, err := upload.ParseCompressionLevel(config.CompressionLevel); err != nil {
+			return config, fmt.Errorf("-compression-level: %w", err)
+		}
 	}
 
-	fmt.Printf("Test run uploaded successfully! TestNod will now process your test run. You can follow its progress at %s\n", serverResponse.TestRunURL)
-	os.Exit(0)
-}
+	args = flag.Args()
+	if config.WatchDir != "" {
+		if len(args) > 0 {
+			return config, fmt.Errorf("-watch does not take file arguments")
+		}
+		if info, err := os.Stat(config.WatchDir); err != nil || !info.IsDir() {
+			return config, fmt.Errorf("watch directory not found: %s", config.WatchDir)
+		}
+		if config.WatchSettle <= 0 {
+			return config, fmt.Errorf("-watch-settle must be positive")
+		}
+		for _, pattern := range config.FilePatterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return config, fmt.Errorf("invalid -file-pattern %q: %w", pattern, err)
+			}
+		}
+	} else if config.CreateOnly != "" {
+		// The test run is created before the file exists.
+		if len(args) > 0 {
+			return config, fmt.Errorf("-create-only does not take file arguments")
+		}
+	} else {
+		// Positional arguments win over TESTNOD_FILE.
+		if config.InputList != "" {
+			listed, err := readInputList(config.InputList)
+			if err != nil {
+				return config, err
+			}
+			args = append(args, listed...)
+		}
 
-func (m *uploadTagsFlag) String() string {
-	var values []string
-	for _, tag := range *m {
-		values = append(values, tag.Value)
+		if config.Stdin {
+			if len(args) > 0 {
+				return config, fmt.Errorf("-stdin does not take file arguments")
+			}
+			config.FilePaths = []string{stdinPath}
+		} else if len(args) > 0 {
+			config.FilePaths = args
+		} else if envFile := os.Getenv("TESTNOD_FILE"); envFile != "" {
+			config.FilePaths = []string{envFile}
+		}
+		if len(config.FilePaths) == 0 {
+			return config, fmt.Errorf("no file specified")
+		}
+
+		var existing []string
+		for _, path := range config.FilePaths {
+			if path == stdinPath {
+				if !config.ValidateFile || len(config.FilePaths) > 1 {
+					return config, fmt.Errorf("standard input can only be read with -validate, as the only file")
+				}
+				// Editor integrations reading stdin want a structured result.
+				config.Output = "json"
+			} else if !download.IsURL(path) {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					if !config.SkipMissing {
+						return config, fmt.Errorf("file not found: %s", path)
+					}
+					fmt.Fprintf(messages(config), "Warning: skipping missing file %s (-skip-missing)\n", path)
+					continue
+				}
+			}
+			existing = append(existing, path)
+		}
+		if len(existing) == 0 {
+			return config, fmt.Errorf("none of the files exist")
+		}
+		config.FilePaths = existing
+		config.FilePath = config.FilePaths[0]
 	}
-	return strings.Join(values, ",")
-}
 
-func (m *uploadTagsFlag) Set(value string) error {
-	*m = append(*m, testnod.Tag{Value: value})
-	return nil
-}
+	if config.Export != "" && len(config.FilePaths) > 1 {
+		return config, fmt.Errorf("-export takes a single file")
+	}
 
-func exitBasedOnIgnoreFailures(ignoreFailures bool) {
-	if ignoreFailures {
-		os.Exit(0)
+	if config.Export != "" && config.Export != "json" {
+		return config, fmt.Errorf("unsupported export format %q (supported: json)", config.Export)
+	}
+
+	switch config.OnDuplicateSuite {
+	case onDuplicateSuiteKeep, onDuplicateSuiteRename, onDuplicateSuiteError:
+	default:
+		return config, fmt.Errorf("unsupported -on-duplicate-suite mode %q (supported: keep, rename, error)", config.OnDuplicateSuite)
+	}
+
+	if config.Output != "text" && config.Output != "json" {
+		return config, fmt.Errorf("unsupported -output format %q (supported: text, json)", config.Output)
+	}
+
+	if config.Output == "json" && !config.ValidateFile {
+		return config, fmt.Errorf("-output json requires -validate")
+	}
+
+	// Exported data on stdout must not be followed by the summary line.
+	if (config.Export != "" && config.OutputPath == "") || config.Output == "json" {
+		config.Quiet = true
+	}
+
+	if config.ListFiles && (config.WatchDir != "" || config.CreateOnly != "" || config.Stdin) {
+		return config, fmt.Errorf("-list-files can't be combined with -watch, -create-only or -stdin")
+	}
+
+	uploading := !config.ValidateFile && !config.CheckOnly && config.Export == "" && !config.ListFiles
+
+	if config.CreateOnly != "" && (!uploading || config.SkipUpload || config.ReuseRun != "" || config.WatchDir != "") {
+		return config, fmt.Errorf("-create-only can't be combined with -validate, -check-only, -export, -skip-upload, -reuse-run or -watch")
+	}
+
+	if config.GroupBy != "" {
+		if config.GroupBy != groupByClassnamePrefix {
+			return config, fmt.Errorf("unsupported -group-by %q (supported: %s)", config.GroupBy, groupByClassnamePrefix)
+		}
+		if !uploading || config.CreateOnly != "" || config.ReuseRun != "" {
+			return config, fmt.Errorf("-group-by only works when uploading, without -create-only or -reuse-run")
+		}
+	}
+
+	if config.Coverage != "" {
+		if !uploading || config.SkipUpload || config.CreateOnly != "" || config.ReuseRun != "" || config.GroupBy != "" || config.WatchDir != "" {
+			return config, fmt.Errorf("-coverage only works when uploading, without -skip-upload, -create-only, -reuse-run, -group-by or -watch")
+		}
+		if len(config.FilePaths) > 1 {
+			return config, fmt.Errorf("-coverage uploads with a single file")
+		}
+		if _, err := os.Stat(config.Coverage); err != nil {
+			return config, fmt.Errorf("coverage file not found: %s", config.Coverage)
+		}
+	}
+
+	if config.ReuseRun != "" {
+		if !uploading || config.SkipUpload || config.WatchDir != "" {
+			return config, fmt.Errorf("-reuse-run can't be combined with -validate, -check-only, -export, -skip-upload or -watch")
+		}
+		if len(config.FilePaths) > 1 {
+			return config, fmt.Errorf("-reuse-run uploads a single file")
+		}
+	}
+
+	if config.MaxTestcases < 0 {
+		return config, fmt.Errorf("-max-testcases must not be negative")
+	}
+
+	if config.NoUploadOnFailure && !uploading {
+		return config, fmt.Errorf("-no-upload-on-failure only works when uploading")
+	}
+
+	if config.PrintURLOnly && (!uploading || config.WatchDir != "") {
+		return config, fmt.Errorf("-print-url-only only works when creating test runs, without -watch")
+	}
+
+	if config.NoUploadExitCode < 0 || config.NoUploadExitCode > 255 {
+		return config, fmt.Errorf("-no-upload-exit-code must be between 0 and 255")
+	}
+
+	if config.OnFailureExitCode < 1 || config.OnFailureExitCode > 255 {
+		return config, fmt.Errorf("-on-failure-exit-code must be between 1 and 255")
+	}
+
+	if config.PreUploadHookTimeout <= 0 {
+		return config, fmt.Errorf("-pre-upload-hook-timeout must be positive")
+	}
+
+	if (config.ClientCert == "") != (config.ClientKey == "") {
+		return config, fmt.Errorf("-client-cert and -client-key must be given together")
+	}
+
+	if config.ClientCertUpload && config.ClientCert == "" {
+		return config, fmt.Errorf("-client-cert-upload requires -client-cert and -client-key")
+	}
+
+	if config.TopSlow < 0 {
+		return config, fmt.Errorf("-top-slow must not be negative")
+	}
+	if config.TopSlow > 0 && !config.ValidateFile {
+		return config, fmt.Errorf("-top-slow requires -validate")
+	}
+
+	if config.DetectFlaky && config.WatchDir != "" {
+		return config, fmt.Errorf("-detect-flaky can't be combined with -watch")
+	}
+
+	if config.MaxReportedFailures < 0 {
+		return config, fmt.Errorf("-max-reported-failures must not be negative")
+	}
+
+	if config.MaxConnsPerHost < 0 || config.MaxIdleConns < 0 || config.MaxIdleConnsPerHost < 0 {
+		return config, fmt.Errorf("-max-conns-per-host, -max-idle-conns and -max-idle-conns-per-host must not be negative")
+	}
+
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return config, fmt.Errorf("-sample-rate must be between 0 and 1")
+	}
+	gitHubAnnotationsSet := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "sample-seed":
+			config.sampleSeedSet = true
+		case "retry-jitter-seed":
+			config.retryJitterSeedSet = true
+		case "github-annotations":
+			gitHubAnnotationsSet = true
+		}
+	})
+	// On GitHub Actions annotations default to on, unless the flag was
+	// given either way.
+	if !gitHubAnnotationsSet && ghannotate.Enabled(os.Getenv) {
+		config.GitHubAnnotations = true
+	}
+
+	if config.RateLimit < 0 {
+		return config, fmt.Errorf("-rate-limit must not be negative")
+	}
+
+	if len(config.FilePatterns) > 0 && config.WatchDir == "" {
+		return config, fmt.Errorf("-file-pattern requires -watch")
+	}
+
+	if config.StripDriveLetters && !config.NormalizePaths {
+		return config, fmt.Errorf("-strip-drive-letters requires -normalize-paths")
+	}
+
+	if config.MinTests < 0 {
+		return config, fmt.Errorf("-min-tests must not be negative")
+	}
+
+	if config.SkippedThreshold < 0 || config.SkippedThreshold >= 1 {
+		return config, fmt.Errorf("-fail-on-skipped-threshold must be at least 0 and less than 1")
+	}
+
+	if config.MaxDepth < 0 {
+		return config, fmt.Errorf("-max-depth must not be negative")
+	}
+
+	if config.ValidateMaxTime < 0 {
+		return config, fmt.Errorf("-validate-max-time must not be negative")
+	}
+
+	if config.ValidateEncoding != "" && !validation.IsUTF8(config.ValidateEncoding) {
+		return config, fmt.Errorf("invalid -validate-encoding %q: only utf-8 is supported", config.ValidateEncoding)
+	}
+
+	if config.QuickValidateKB < 0 {
+		return config, fmt.Errorf("-quick-validate-kb must not be negative")
+	}
+
+	if config.QuickValidate && (config.MaxTestcases > 0 || config.ValidateMaxTime > 0 || config.WarningsAsErrors) {
+		return config, fmt.Errorf("-quick-validate can't be combined with -max-testcases, -validate-max-time or -warnings-as-errors, which need the whole file")
+	}
+
+	if config.CreateAttempts < 1 {
+		return config, fmt.Errorf("-retries-include-create must be at least 1")
+	}
+
+	if config.UploadAttempts < 1 {
+		return config, fmt.Errorf("-retries-include-upload must be at least 1")
+	}
+
+	if config.SequenceRetries < 0 {
+		return config, fmt.Errorf("-sequence-retries must not be negative")
+	}
+	if config.SequenceRetries > 0 && config.ReuseRun != "" {
+		return config, fmt.Errorf("-sequence-retries creates the test run again, so it can't be combined with -reuse-run")
+	}
+
+	if config.MaxAttemptsTotal < 0 {
+		return config, fmt.Errorf("-max-attempts-total must not be negative")
+	}
+	config.attemptBudget = newAttemptBudget(config.MaxAttemptsTotal)
+	config.timings = newPhaseTimings(config.Timing)
+	config.markdown = newMarkdownSummary(config.SummaryMarkdown)
+
+	if config.WebhookURL != "" {
+		if u, err := url.Parse(config.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return config, fmt.Errorf("invalid -webhook-url %q: must be an http(s) URL", config.WebhookURL)
+		}
+	}
+
+	if config.StatusFile != "" {
+		if info, err := os.Stat(filepath.Dir(config.StatusFile)); err != nil || !info.IsDir() {
+			return config, fmt.Errorf("-status-file directory not found: %s", filepath.Dir(config.StatusFile))
+		}
+		config.status = status.New(config.StatusFile)
+	}
+
+	if config.Resume != "" {
+		if !uploading || config.WatchDir != "" {
+			return config, fmt.Errorf("-resume only applies to uploading file arguments, not -validate, -check-only, -export or -watch")
+		}
+		if config.checkpoint, err = checkpoint.Load(config.Resume); err != nil {
+			return config, err
+		}
+	}
+
+	if config.MaxDownloadMB <= 0 {
+		return config, fmt.Errorf("-max-download-mb must be positive")
+	}
+
+	if config.TokenStdin {
+		if config.Token != "" {
+			return config, fmt.Errorf("-token and -token-stdin are mutually exclusive")
+		}
+		for _, path := range config.FilePaths {
+			if path == stdinPath {
+				return config, fmt.Errorf("-token-stdin can't be combined with reading the file from standard input")
+			}
+		}
+		token, err := readToken(stdin)
+		if err != nil {
+			return config, err
+		}
+		config.Token = token
+	}
+
+	if uploading && config.Token == "" {
+		return config, fmt.Errorf("no token specified")
+	}
+
+	if config.BasicPass != "" && config.BasicPassFile != "" {
+		return config, fmt.Errorf("-basic-pass and -basic-pass-file are mutually exclusive")
+	}
+	if (config.BasicPass != "" || config.BasicPassFile != "" || config.BasicAuthUpload) && config.BasicUser == "" {
+		return config, fmt.Errorf("-basic-pass, -basic-pass-file and -basic-auth-upload require -basic-user")
+	}
+	if config.BasicPassFile != "" {
+		pass, err := readBasicPass(config.BasicPassFile)
+		if err != nil {
+			return config, err
+		}
+		config.BasicPass = pass
+	} else if config.BasicUser != "" && config.BasicPass == "" {
+		config.BasicPass = os.Getenv("TESTNOD_BASIC_PASS")
+	}
+
+	if config.Note != "" && config.NoteFile != "" {
+		return config, fmt.Errorf("-note and -note-file are mutually exclusive")
+	}
+	if config.NoteFile != "" {
+		note, err := readNote(config.NoteFile)
+		if err != nil {
+			return config, err
+		}
+		config.Note = note
+	}
+
+	// A reused run already has its build ID.
+	if uploading && config.ReuseRun == "" && config.BuildID == "" {
+		return config, fmt.Errorf("no build ID specified (-build-id is required)")
+	}
+
+	if config.ExpandCommitSHA && config.CommitSHA != "" {
+		if wd, err := os.Getwd(); err == nil {
+			if expanded, err := expandCommitSHA(config.CommitSHA, wd); err != nil {
+				fmt.Fprintf(messages(config), "Warning: keeping -commit-sha %s as given: %v\n", config.CommitSHA, err)
+			} else {
+				config.CommitSHA = expanded
+			}
+		}
+	}
+
+	if err := checkRequiredMetadata(testRunMetadata(config), config.RequireMetadata); err != nil {
+		return config, err
+	}
+
+	// Opened last, so a run rejected above doesn't create the file.
+	if config.AttemptLog != "" {
+		log, err := attemptlog.Open(config.AttemptLog)
+		if err != nil {
+			return config, err
+		}
+		config.attemptLog = log
+	}
+
+	return config, nil
+}
+
+// readToken reads the -token-stdin token: the first line of r without its
+// line ending. Anything after the first line is ignored.
+func readToken(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read token from standard input: %w", err)
+	}
+	token := strings.TrimRight(line, "\r\n")
+	if token == "" {
+		return "", fmt.Errorf("no token on standard input (-token-stdin)")
+	}
+	return token, nil
+}
+
+// readBasicPass reads the -basic-pass-file password: the first line of the
+// file without its line ending.
+func readBasicPass(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read -basic-pass-file: %w", err)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read -basic-pass-file: %w", err)
+	}
+	pass := strings.TrimRight(line, "\r\n")
+	if pass == "" {
+		return "", fmt.Errorf("no password in %s (-basic-pass-file)", path)
+	}
+	return pass, nil
+}
+
+// readNote reads the -note-file text, without surrounding whitespace such
+// as a trailing newline.
+func readNote(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read -note-file: %w", err)
+	}
+	note := strings.TrimSpace(string(data))
+	if note == "" {
+		return "", fmt.Errorf("no note in %s (-note-file)", path)
+	}
+	return note, nil
+}
+
+// configureTransports gives the API and upload clients their own transports,
+// since the TestNod API and the presigned storage URL are often reached over
+// different network paths.
+func configureTransports(config Config) error {
+	apiOptions := transport.Options{
+		Proxy:        config.APIProxy,
+		ClientCert:   config.ClientCert,
+		ClientKey:    config.ClientKey,
+		DisableHTTP2: !config.HTTP2,
+	}
+	poolOptions(&apiOptions, config)
+	apiTransport, err := transport.New(apiOptions)
+	if err != nil {
+		return fmt.Errorf("failed to configure the API transport: %w", err)
+	}
+
+	// Only the upload transport can skip verification, so the token sent to
+	// the TestNod API never goes to an unverified server.
+	uploadOptions := transport.Options{Proxy: config.UploadProxy, DisableHTTP2: !config.HTTP2, InsecureSkipVerify: config.SkipTLSVerifyUpload}
+	poolOptions(&uploadOptions, config)
+	if config.ClientCertUpload {
+		uploadOptions.ClientCert = config.ClientCert
+		uploadOptions.ClientKey = config.ClientKey
+	}
+	uploadTransport, err := transport.New(uploadOptions)
+	if err != nil {
+		return fmt.Errorf("failed to configure the upload transport: %w", err)
+	}
+
+	var apiRoundTripper, uploadRoundTripper http.RoundTripper = apiTransport, uploadTransport
+
+	// The upload request body is the JUnit file itself, so only its headers
+	// are dumped.
+	if config.DumpDir != "" {
+		if apiRoundTripper, err = dump.NewTransport(apiTransport, config.DumpDir, "testnod-api", config.Token, true); err != nil {
+			return err
+		}
+		if uploadRoundTripper, err = dump.NewTransport(uploadTransport, config.DumpDir, "presigned-upload", config.Token, false); err != nil {
+			return err
+		}
+		debug.Log("dumping requests and responses to %s", config.DumpDir)
+	}
+
+	// One limiter for both clients, so the cap applies to their combined
+	// request rate.
+	if config.RateLimit > 0 {
+		limiter := transport.NewLimiter(config.RateLimit)
+		apiRoundTripper = &transport.RateLimited{Base: apiRoundTripper, Limiter: limiter}
+		uploadRoundTripper = &transport.RateLimited{Base: uploadRoundTripper, Limiter: limiter}
+	}
+
+	testnod.SetTransport(apiRoundTripper)
+	upload.SetTransport(uploadRoundTripper)
+	return nil
+}
+
+// poolOptions applies the connection pool flags to opts.
+func poolOptions(opts *transport.Options, config Config) {
+	opts.MaxIdleConns = config.MaxIdleConns
+	opts.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	opts.MaxConnsPerHost = config.MaxConnsPerHost
+}
+
+func validationOptions(config Config) validation.Options {
+	return validation.Options{
+		MaxTestcases: config.MaxTestcases,
+		MaxDepth:     config.MaxDepth,
+		Encoding:     config.ValidateEncoding,
+		MaxTime:      config.ValidateMaxTime,
+		Quick:        config.QuickValidate,
+		QuickLimit:   int64(config.QuickValidateKB) * 1024,
+		// A downloaded copy's name comes from the URL, which often has no
+		// extension.
+		SkipExtension: config.downloaded,
+	}
+}
+
+// validateFile validates the file, printing any warnings. Errors always fail
+// it; warnings only with -warnings-as-errors.
+func validateFile(config Config) error {
+	defer config.timings.since(phaseValidate, time.Now())
+	report := validation.ValidateJUnitXMLFileReport(config.FilePath, validationOptions(config))
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(messages(config), "Warning: %s\n", warning)
+	}
+	return validationError(config, report)
+}
+
+// validationError is the error a validation report fails with, if any.
+func validationError(config Config, report validation.Report) error {
+	if err := report.Err(); err != nil {
+		return err
+	}
+	if config.WarningsAsErrors && len(report.Warnings) > 0 {
+		return errcode.Errorf(errcode.ValidateWarnings, "%d validation warning(s) treated as errors (-warnings-as-errors)", len(report.Warnings))
+	}
+	return nil
+}
+
+func validateOnly(config Config) error {
+	fmt.Println("Validating file:", config.FilePath)
+
+	err := validateFile(config)
+	if err != nil {
+		fmt.Println(formatError(config, err))
+		return err
+	}
+
+	var doc *junit.Document
+	if checksNeedDocument(config) || config.TopSlow > 0 {
+		if doc, err = junit.ParseFile(config.FilePath); err != nil {
+			fmt.Println(err)
+			return err
+		}
+	}
+
+	if err := checkSkippedThreshold(doc, config.SkippedThreshold); err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	if err := checkMinTests(doc, config.FilePath, config.MinTests); err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	if config.RequireFailureMessages {
+		if err := checkFailureMessages(doc, config.FilePath); err != nil {
+			fmt.Println(err)
+			return err
+		}
+	}
+
+	fmt.Printf("%s is a valid JUnit XML file!\n", config.FilePath)
+
+	if config.TopSlow > 0 {
+		printSlowest(os.Stdout, slowestTestcases(doc, config.TopSlow))
+	}
+	return nil
+}
+
+func checkOnly(config Config) error {
+	fmt.Println("Checking file:", config.FilePath)
+
+	doc, err := junit.ParseFile(config.FilePath)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	issues := lint.Run(doc, lint.Rules)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if lint.HasErrors(issues) {
+		fmt.Printf("%s has %d issue(s), including errors\n", config.FilePath, len(issues))
+		return fmt.Errorf("%s has lint errors", config.FilePath)
+	}
+
+	fmt.Printf("%s passed all checks with %d warning(s)\n", config.FilePath, len(issues))
+	return nil
+}
+
+// exportResults writes the parsed file in the -export format to -o, or to
+// stdout when no output file is given. Nothing else is printed to stdout in
+// that case so the output can be piped.
+func exportResults(config Config, stdout io.Writer) error {
+	doc, err := junit.ParseFile(config.FilePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	data, err := export.JSON(doc)
+	if err != nil {
+		err = fmt.Errorf("failed to export %s: %w", config.FilePath, err)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	data = append(data, '\n')
+
+	if config.OutputPath == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(config.OutputPath, data, 0o644); err != nil {
+		err = fmt.Errorf("failed to write %s: %w", config.OutputPath, err)
+		fmt.Println(err)
+		return err
+	}
+
+	fmt.Printf("Exported %s to %s\n", config.FilePath, config.OutputPath)
+	return nil
+}
+
+func uploadToTestNod(config Config) (uploadResult, error) {
+	var err error
+	if !config.validated {
+		if err = validateFile(config); err != nil {
+			fmt.Printf("File validation failed: %s\n", formatError(config, err))
+			return uploadResult{}, err
+		}
+	}
+
+	// Parsed once for the checks and the rewrite, which can be slow for
+	// large files.
+	var doc *junit.Document
+	if checksNeedDocument(config) || needsRewrite(config) {
+		if doc, err = junit.ParseFile(config.FilePath); err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+	}
+
+	if err := checkSkippedThreshold(doc, config.SkippedThreshold); err != nil {
+		fmt.Println(err)
+		return uploadResult{}, err
+	}
+
+	if err := checkMinTests(doc, config.FilePath, config.MinTests); err != nil {
+		fmt.Println(err)
+		return uploadResult{}, err
+	}
+
+	if config.RequireFailureMessages {
+		if err := checkFailureMessages(doc, config.FilePath); err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+	}
+
+	if config.NoUploadOnFailure {
+		if err := checkNoFailures(doc, config.FilePath); err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+	}
+
+	if config.Coverage != "" {
+		if err := validateCoverage(config.Coverage); err != nil {
+			fmt.Println(formatError(config, err))
+			return uploadResult{}, err
+		}
+	}
+
+	uploadPath := config.FilePath
+	if needsRewrite(config) {
+		rewrittenPath, err := rewriteDocument(config, doc)
+		if err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+		defer removeTemp(config, rewrittenPath)
+		uploadPath = rewrittenPath
+	} else if compressed, err := gzipsniff.IsGzip(config.FilePath); err == nil && compressed {
+		// TestNod expects XML, so gzipped input is uploaded decompressed
+		// whatever its extension.
+		decompressedPath, err := gzipsniff.Decompress(config.FilePath)
+		if err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+		defer removeTemp(config, decompressedPath)
+		uploadPath = decompressedPath
+	}
+
+	if config.PreUploadHook != "" {
+		if err := runPreUploadHook(config, uploadPath); err != nil {
+			fmt.Println(err)
+			return uploadResult{}, err
+		}
+		// The hook may have changed the file, so what's reported is read
+		// back from it.
+		if config.ReportFailures || config.markdown != nil {
+			if doc, err = junit.ParseFile(uploadPath); err != nil {
+				fmt.Println(err)
+				return uploadResult{}, err
+			}
+		}
+	}
+
+	if config.ReuseRun == "" {
+		fmt.Printf("%s is a valid JUnit XML file. Creating test run...\n", config.FilePath)
+	}
+
+	result := uploadResult{Document: doc}
+	setRequestID(config)
+	setBasicAuth(config)
+	upload.SetAttemptObserver(func(attempt int, duration time.Duration, err error) {
+		result.UploadAttempts = attempt
+		config.attemptBudget.use()
+		warnStatus(config.attemptLog.Record(config.FilePath, attemptlog.Upload, attempt, duration, err))
+	})
+	if retryIf := retryPredicate(config); retryIf != nil {
+		upload.SetRetryIf(retryIf)
+		defer upload.SetRetryIf(nil)
+	}
+
+	if config.SequenceRetries > 0 {
+		testnod.SetIdempotencyKey(newRequestID())
+		defer testnod.SetIdempotencyKey("")
+	}
+
+	var serverResponse testnod.SuccessfulServerResponse
+	if config.ReuseRun != "" {
+		serverResponse, err = readRunFile(config.ReuseRun)
+		if err != nil {
+			fmt.Println(err)
+			return result, err
+		}
+		fmt.Printf("Reusing test run %s from %s (-reuse-run)\n", serverResponse.TestRunURL, config.ReuseRun)
+		warnPresignedURLExpiry(serverResponse.PresignedURL)
+	} else {
+		serverResponse, err = createTestRun(config, &result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if config.SkipUpload {
+		fmt.Println("Created test run, skipping the upload (-skip-upload). Server response:")
+		if err := printCreateResponse(os.Stdout, serverResponse); err != nil {
+			return result, err
+		}
+		result.TestRunURL = serverResponse.TestRunURL
+		return result, nil
+	}
+
+	upload.SetAttempts(config.UploadAttempts)
+	upload.SetMethod(config.UploadMethod)
+	upload.SetSuccessStatuses(config.uploadSuccess)
+	upload.SetStorageBackend(config.StorageBackend)
+	upload.SetCompressionLevel(uploadCompressionLevel(config))
+	if config.status != nil {
+		upload.SetProgressObserver(func(sent int64) { warnStatus(config.status.SetBytes(sent)) })
+		defer upload.SetProgressObserver(nil)
+	}
+
+	// With -sequence-retries, an upload that still fails after its own
+	// retries starts over from creating the test run.
+	for sequence := 0; ; sequence++ {
+		if sequence > 0 {
+			fmt.Printf("Upload failed: %s\n", formatError(config, err))
+			// The run the upload failed for is abandoned, so TestNod is
+			// told about it like about any other failed upload.
+			notifyUploadFailure(config, serverResponse)
+			fmt.Printf("Creating the test run again for a fresh upload URL (sequence retry %d of %d)...\n", sequence, config.SequenceRetries)
+			serverResponse, err = createTestRun(config, &result)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		// With an -upload-url template the server needn't send a presigned URL,
+		// but only if the user opted out of the guard.
+		if config.FailIfNoUploadURL {
+			if err := checkPresignedURL(serverResponse.PresignedURL); err != nil {
+				fmt.Println(formatError(config, err))
+				fmt.Printf("If your server doesn't return presigned URLs, pass -upload-url with an %s template and -fail-if-no-upload-url=false.\n", uploadIDPlaceholder)
+				notifyUploadFailure(config, serverResponse)
+				return result, err
+			}
+		}
+
+		if err := config.attemptBudget.check("uploading"); err != nil {
+			fmt.Println(err)
+			notifyUploadFailure(config, serverResponse)
+			return result, err
+		}
+
+		if config.ReuseRun == "" {
+			fmt.Println("Created test run, uploading JUnit XML file...")
+		} else {
+			fmt.Println("Uploading JUnit XML file...")
+		}
+		debug.Log("uploading file: %s", uploadPath)
+		warnStatus(config.status.SetPhase(status.Uploading))
+		start := time.Now()
+		err = upload.UploadJUnitXmlFile(uploadPath, uploadTarget(config, serverResponse))
+		config.timings.since(phaseUpload, start)
+		debug.Log("upload attempts: %d", result.UploadAttempts)
+		if err == nil || !retrySequence(config, err, sequence) {
+			break
+		}
+	}
+
+	if err != nil {
+		fmt.Println(formatError(config, err))
+		fmt.Println("There was an error uploading the file to TestNod. We've been notified and will look into it. Sorry for the inconvenience.")
+		notifyUploadFailure(config, serverResponse)
+		return result, err
+	}
+
+	fmt.Printf("Test run uploaded successfully! TestNod will now process your test run. You can follow its progress at %s\n", serverResponse.TestRunURL)
+	result.TestRunURL = serverResponse.TestRunURL
+
+	if config.Coverage != "" {
+		if err := uploadCoverage(config, serverResponse); err != nil {
+			fmt.Println(formatError(config, err))
+			return result, err
+		}
+	}
+
+	if config.WebhookURL != "" {
+		notifyWebhook(config, serverResponse)
+	}
+	return result, nil
+}
+
+// createTestRun creates the test run for config's metadata and tags,
+// recording each attempt in result.
+func createTestRun(config Config, result *uploadResult) (testnod.SuccessfulServerResponse, error) {
+	uploadRequest := testnod.CreateTestRunRequest{
+		Tags: config.Tags,
+		TestRun: testnod.TestRun{
+			Metadata: testRunMetadata(config),
+			Note:     config.Note,
+		},
+		Coverage: config.Coverage != "",
+	}
+
+	uploadURL := config.BaseURL + "/integrations/test_runs/upload"
+	debug.Log("CreateTestRun URL: %s", uploadURL)
+	testnod.SetCapturedHeaders(config.StoreResponseHeaders...)
+	testnod.SetSchemaVersion(config.SchemaVersion)
+	testnod.SetCreateAttempts(config.CreateAttempts)
+	warnStatus(config.status.SetPhase(status.Creating))
+
+	testnod.SetAttemptObserver(func(attempt int, duration time.Duration, err error) {
+		result.CreateAttempts = attempt
+		config.attemptBudget.use()
+		warnStatus(config.attemptLog.Record(config.FilePath, attemptlog.Create, attempt, duration, err))
+	})
+	if retryIf := retryPredicate(config); retryIf != nil {
+		testnod.SetRetryIf(retryIf)
+		defer testnod.SetRetryIf(nil)
+	}
+
+	if err := config.attemptBudget.check("creating a test run"); err != nil {
+		fmt.Println(err)
+		return testnod.SuccessfulServerResponse{}, err
+	}
+
+	start := time.Now()
+	serverResponse, err := testnod.CreateTestRun(uploadURL, config.Token, uploadRequest)
+	config.timings.since(phaseCreate, start)
+	debug.Log("create attempts: %d", result.CreateAttempts)
+	if err != nil {
+		fmt.Printf("Error creating test run on TestNod: %s\n", formatError(config, err))
+		return serverResponse, err
+	}
+
+	printStoredHeaders(os.Stdout, serverResponse.Headers, config.StoreResponseHeaders)
+
+	debug.Log("test run created: id=%d test_run_id=%d upload_id=%d presigned-url-host=%s", serverResponse.ID, serverResponse.TestRunID, serverResponse.UploadID, serverResponse.PresignedURL[:min(60, len(serverResponse.PresignedURL))])
+	warnPresignedURLExpiry(serverResponse.PresignedURL)
+	return serverResponse, nil
+}
+
+// requestIDPattern is what -request-id accepts: short enough for a header
+// and safe to print in log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID returns a random -request-id for runs that don't set one.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setRequestID hands the -request-id to everything that sends or logs
+// requests.
+func setRequestID(config Config) {
+	testnod.SetRequestID(config.RequestID)
+	upload.SetRequestID(config.RequestID)
+	config.attemptLog.SetRequestID(config.RequestID)
+}
+
+// setBasicAuth hands the -basic-user credentials to the API client, and to
+// the upload with -basic-auth-upload.
+func setBasicAuth(config Config) {
+	testnod.SetBasicAuth(config.BasicUser, config.BasicPass)
+	if config.BasicAuthUpload {
+		upload.SetBasicAuth(config.BasicUser, config.BasicPass)
+	} else {
+		upload.SetBasicAuth("", "")
+	}
+}
+
+// notifyWebhook posts the uploaded test run to -webhook-url. The upload has
+// already succeeded, so a failure only warns.
+func notifyWebhook(config Config, serverResponse testnod.SuccessfulServerResponse) {
+	err := webhook.Send(config.WebhookURL, webhook.Payload{
+		TestRunID:  serverResponse.TestRunID,
+		TestRunURL: serverResponse.TestRunURL,
+		Project:    serverResponse.Project,
+		File:       config.FilePath,
+		Status:     webhook.StatusUploaded,
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to notify -webhook-url: %v\n", err)
+	}
+}
+
+// uploadCompressionLevel is the gzip level for the upload, or
+// upload.Uncompressed without -compression-level. parseFlags has already
+// rejected invalid levels.
+func uploadCompressionLevel(config Config) int {
+	if config.CompressionLevel == "" {
+		return upload.Uncompressed
+	}
+	level, err := upload.ParseCompressionLevel(config.CompressionLevel)
+	if err != nil {
+		return upload.Uncompressed
+	}
+	return level
+}
+
+// formatError puts the error's stable code, if it has one, in front of its
+// message. The code is colored unless -no-color or NO_COLOR is set or stdout
+// isn't a terminal.
+func formatError(config Config, err error) string {
+	return errcode.Format(err, useColor(config))
+}
+
+func useColor(config Config) bool {
+	if config.NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// checkPresignedURL rejects a create response without a usable upload URL
+// before the upload step turns it into a confusing request error.
+func checkPresignedURL(presignedURL string) error {
+	if presignedURL == "" {
+		return errcode.Errorf(errcode.NoPresignedURL, "server did not return a presigned URL")
+	}
+	parsed, err := url.Parse(presignedURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errcode.Errorf(errcode.NoPresignedURL, "server returned an invalid presigned URL")
+	}
+	return nil
+}
+
+func notifyUploadFailure(config Config, serverResponse testnod.SuccessfulServerResponse) {
+	debug.Log("notifying TestNod of upload failure for upload %d (test run %d)", serverResponse.UploadID, serverResponse.TestRunID)
+	err := testnod.NotifyUploadFailure(
+		config.BaseURL,
+		config.Token,
+		serverResponse.UploadID,
+		serverResponse.TestRunID,
+		"The test results file could not be uploaded. Please try again or contact support if the issue persists.",
+	)
+	if err != nil {
+		debug.Log("failed to notify TestNod of upload failure: %v", err)
+	}
+}
+
+// runPreUploadHook runs -pre-upload-hook on the file about to be uploaded and
+// validates it again, since the hook may have modified it.
+func runPreUploadHook(config Config, filePath string) error {
+	fmt.Println("Running pre-upload hook...")
+	output, err := hook.Run(config.PreUploadHook, filePath, config.PreUploadHookTimeout)
+	if len(output) > 0 {
+		fmt.Print(string(output))
+		if output[len(output)-1] != '\n' {
+			fmt.Println()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("pre-upload hook failed, not uploading: %w", err)
+	}
+
+	report := validation.ValidateJUnitXMLFileReport(filePath, validationOptions(config))
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(messages(config), "Warning: %s\n", warning)
+	}
+	if err := validationError(config, report); err != nil {
+		return fmt.Errorf("file is no longer valid after the pre-upload hook: %w", err)
+	}
+	return nil
+}
+
+// needsRewrite reports whether any option modifies the file before upload.
+func needsRewrite(config Config) bool {
+	return config.Canonicalize || config.SummaryJUnit || config.CollapseRetries || config.NormalizePaths || config.ClassnamePrefix != "" || config.FillEmptyClassname != "" || len(config.redactRegexps) > 0 || config.suiteFilterRegexp != nil ||
+		(config.OnDuplicateSuite != "" && config.OnDuplicateSuite != onDuplicateSuiteKeep)
+}
+
+// rewriteDocument applies the options that modify the file to doc, its
+// parsed content, and writes the result to a temporary file, returning its
+// path. The caller removes it once the upload is done.
+func rewriteDocument(config Config, doc *junit.Document) (string, error) {
+	if config.suiteFilterRegexp != nil {
+		if kept := rewrite.FilterSuites(doc, config.suiteFilterRegexp); kept == 0 {
+			return "", fmt.Errorf("no testsuite in %s matches -suite-filter %q", config.FilePath, config.SuiteFilter)
+		}
+		debug.Log("kept %d testsuite(s) matching %q", len(doc.Suites), config.SuiteFilter)
+	}
+
+	switch config.OnDuplicateSuite {
+	case onDuplicateSuiteError:
+		if duplicates := rewrite.DuplicateSuiteNames(doc); len(duplicates) > 0 {
+			return "", fmt.Errorf("%s has more than one testsuite named %s (-on-duplicate-suite error)", config.FilePath, strings.Join(duplicates, ", "))
+		}
+	case onDuplicateSuiteRename:
+		renamed := rewrite.RenameDuplicateSuites(doc)
+		debug.Log("renamed %d duplicate testsuite(s)", renamed)
+	}
+
+	if config.CollapseRetries {
+		removed := rewrite.CollapseRetries(doc)
+		debug.Log("collapsed %d retried testcase attempt(s)", removed)
+	}
+
+	// Before -classname-prefix, so a prefix ending in a backslash is kept.
+	if config.NormalizePaths {
+		changed := rewrite.NormalizePaths(doc, config.StripDriveLetters)
+		debug.Log("normalized paths in %d testcase(s)", changed)
+	}
+
+	if config.ClassnamePrefix != "" || config.FillEmptyClassname != "" {
+		changed := rewrite.PrefixClassnames(doc, config.ClassnamePrefix, config.FillEmptyClassname)
+		debug.Log("prefixed %d classname(s) with %q", changed, config.ClassnamePrefix)
+	}
+
+	if len(config.redactRegexps) > 0 {
+		changed := rewrite.Redact(doc, config.redactRegexps)
+		debug.Log("redacted %d element(s)", changed)
+	}
+
+	if config.SummaryJUnit && rewrite.WrapSuite(doc) {
+		debug.Log("wrapped the bare testsuite in <testsuites> tests=%s", doc.Tests)
+	}
+
+	if config.Canonicalize {
+		junit.Canonicalize(doc)
+	}
+
+	data, err := junit.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to rewrite %s: %w", config.FilePath, err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "testnod-rewritten-*.xml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer tmpFile.Close()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to write rewritten file: %w", err)
+	}
+
+	debug.Log("rewrote %s to %s (%d bytes)", config.FilePath, tmpFile.Name(), len(data))
+	return tmpFile.Name(), nil
+}
+
+func (m *uploadTagsFlag) String() string {
+	var values []string
+	for _, tag := range *m {
+		values = append(values, tag.Value)
+	}
+	return strings.Join(values, ",")
+}
+
+func (m *uploadTagsFlag) Set(value string) error {
+	*m = append(*m, testnod.Tag{Value: value})
+	return nil
+}
+
+// expandTags expands environment variable references in tag values. It runs
+// after flag parsing so that -expand-tags applies regardless of flag order.
+func expandTags(tags uploadTagsFlag, strict bool) (uploadTagsFlag, error) {
+	var expanded uploadTagsFlag
+	for _, tag := range tags {
+		var unset []string
+		value := os.Expand(tag.Value, func(name string) string {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				unset = append(unset, name)
+			}
+			return v
+		})
+
+		if strict && len(unset) > 0 {
+			return nil, fmt.Errorf("tag %q references unset environment variable(s): %s", tag.Value, strings.Join(unset, ", "))
+		}
+
+		debug.Log("expanded tag %q to %q", tag.Value, value)
+		expanded = append(expanded, testnod.Tag{Value: value})
+	}
+	return expanded, nil
+}
+
+// prefixTags prepends prefix to every tag value that doesn't already start
+// with it, so running it twice changes nothing. Tags that end up with the
+// same value are only kept once. It runs after every tag source has been
+// applied.
+func prefixTags(tags uploadTagsFlag, prefix string) uploadTagsFlag {
+	var prefixed uploadTagsFlag
+	for _, tag := range tags {
+		value := tag.Value
+		if !strings.HasPrefix(value, prefix) {
+			value = prefix + value
+		}
+		if slices.ContainsFunc(prefixed, func(t testnod.Tag) bool { return t.Value == value }) {
+			continue
+		}
+		prefixed = append(prefixed, testnod.Tag{Value: value})
+	}
+	return prefixed
+}
+
+// fileTags is the tags for the test run of the file at path: config's tags
+// plus, with -tag-from-filename, the pattern's first capture group matched
+// against the file's name, after -tag-prefix. A name the pattern doesn't
+// match only gets config's tags.
+func fileTags(config Config, path string) uploadTagsFlag {
+	if config.tagFromFilenameRe == nil || config.ValidateFile || config.CheckOnly || config.Export != "" {
+		return config.Tags
+	}
+	match := config.tagFromFilenameRe.FindStringSubmatch(filepath.Base(path))
+	if len(match) < 2 || match[1] == "" {
+		fmt.Fprintf(messages(config), "Warning: -tag-from-filename doesn't match %s, not tagging it\n", path)
+		return config.Tags
+	}
+	debug.Log("tagging %s with %q (-tag-from-filename)", path, match[1])
+	return prefixTags(append(slices.Clone(config.Tags), testnod.Tag{Value: match[1]}), config.TagPrefix)
+}
+
+func (m *stringListFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *stringListFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// printStoredHeaders prints each requested response header, in the order the
+// flags were given. Headers missing from the response are reported as such so
+// a misconfigured gateway is easy to spot.
+func printStoredHeaders(w io.Writer, headers http.Header, names []string) {
+	for _, name := range names {
+		value := headers.Get(name)
+		if value == "" {
+			fmt.Fprintf(w, "Response header %s: (not present)\n", name)
+			continue
+		}
+		fmt.Fprintf(w, "Response header %s: %s\n", name, value)
+	}
+}
+
+// printCreateResponse prints the create test run response as JSON, including
+// the presigned URL, for -skip-upload.
+func printCreateResponse(w io.Writer, resp testnod.SuccessfulServerResponse) error {
+	data, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to print response: %w", err)
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+func exitBasedOnIgnoreFailures(config Config) {
+	os.Exit(failureExitCode(config))
+}
+
+// failureExitCode is the exit code for a failed run. -ignore-failures wins
+// over -on-failure-exit-code.
+func failureExitCode(config Config) int {
+	if config.IgnoreFailures {
+		return 0
+	}
+	if config.OnFailureExitCode < 1 || config.OnFailureExitCode > 255 {
+		return defaultFailureExitCode
 	}
-	os.Exit(1)
+	return config.OnFailureExitCode
 }
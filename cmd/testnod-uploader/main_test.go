@@ -1,10 +1,36 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"testnod-uploader/internal/attemptlog"
+	"testnod-uploader/internal/checkpoint"
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/export"
+	"testnod-uploader/internal/junit"
+	"testnod-uploader/internal/status"
+	"testnod-uploader/internal/testnod"
+	"testnod-uploader/internal/transport"
+	"testnod-uploader/internal/upload"
+	"testnod-uploader/internal/validation"
+	"testnod-uploader/internal/webhook"
 )
 
 func TestParseFlags(t *testing.T) {
@@ -79,6 +105,15 @@ func TestParseFlags(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "check-only flag without token or build id is fine",
+			args: []string{"cmd", "-check-only", "test.xml"},
+			wantConfig: Config{
+				CheckOnly: true,
+				FilePath:  "test.xml",
+			},
+			wantErr: false,
+		},
 		{
 			name: "with tags",
 			args: []string{"cmd", "-token=abc123", "-build-id=build-1", "-tag=feature", "-tag=backend", "test.xml"},
@@ -132,6 +167,9 @@ func TestParseFlags(t *testing.T) {
 				if got.ValidateFile != tt.wantConfig.ValidateFile {
 					t.Errorf("parseFlags() ValidateFile = %v, want %v", got.ValidateFile, tt.wantConfig.ValidateFile)
 				}
+				if got.CheckOnly != tt.wantConfig.CheckOnly {
+					t.Errorf("parseFlags() CheckOnly = %v, want %v", got.CheckOnly, tt.wantConfig.CheckOnly)
+				}
 				if got.Branch != tt.wantConfig.Branch {
 					t.Errorf("parseFlags() Branch = %v, want %v", got.Branch, tt.wantConfig.Branch)
 				}
@@ -189,23 +227,2777 @@ func TestUploadTagsFlag(t *testing.T) {
 	})
 }
 
-func TestExitBasedOnIgnoreFailures(t *testing.T) {
-	// We can't directly test os.Exit, but we can test the function exists
-	// and doesn't panic with different inputs
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("exitBasedOnIgnoreFailures() panicked: %v", r)
+func TestStoreResponseHeaderFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tmpFile, err := os.CreateTemp("", "store_header_test_*.xml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	os.Args = []string{"cmd", "-validate", "-store-response-header=X-Request-Id", "-store-response-header", "X-Trace-Id", tmpFile.Name()}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() unexpected error: %v", err)
+	}
+
+	if got := config.StoreResponseHeaders.String(); got != "X-Request-Id,X-Trace-Id" {
+		t.Errorf("StoreResponseHeaders = %q, want %q", got, "X-Request-Id,X-Trace-Id")
+	}
+}
+
+func TestPrintStoredHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-Request-Id", "req-123")
+
+	var buf bytes.Buffer
+	printStoredHeaders(&buf, headers, []string{"x-request-id", "X-Missing"})
+
+	want := "Response header x-request-id: req-123\nResponse header X-Missing: (not present)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printStoredHeaders() output = %q, want %q", got, want)
+	}
+}
+
+func TestConfigureTransportsUsesPerStepProxies(t *testing.T) {
+	t.Cleanup(func() {
+		testnod.SetTransport(http.DefaultTransport)
+		upload.SetTransport(http.DefaultTransport)
+	})
+
+	// A forward proxy receives the absolute target URL in the request line.
+	var apiProxied, uploadProxied []string
+	apiProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiProxied = append(apiProxied, r.URL.String())
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer apiProxy.Close()
+	uploadProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploadProxied = append(uploadProxied, r.URL.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer uploadProxy.Close()
+
+	err := configureTransports(Config{APIProxy: apiProxy.URL, UploadProxy: uploadProxy.URL})
+	if err != nil {
+		t.Fatalf("configureTransports() unexpected error: %v", err)
+	}
+
+	if _, err := testnod.CreateTestRun("http://testnod.example/integrations/test_runs/upload", "token", testnod.CreateTestRunRequest{}); err != nil {
+		t.Fatalf("CreateTestRun() unexpected error: %v", err)
+	}
+	if err := upload.UploadJUnitXmlFile("../../testdata/valid_junit.xml", "http://storage.example/bucket/key"); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() unexpected error: %v", err)
+	}
+
+	if len(apiProxied) != 1 || apiProxied[0] != "http://testnod.example/integrations/test_runs/upload" {
+		t.Errorf("API proxy saw %v, want only the create request", apiProxied)
+	}
+	if len(uploadProxied) != 1 || uploadProxied[0] != "http://storage.example/bucket/key" {
+		t.Errorf("Upload proxy saw %v, want only the upload request", uploadProxied)
+	}
+}
+
+func TestConfigureTransportsInvalidProxy(t *testing.T) {
+	err := configureTransports(Config{UploadProxy: "not a url"})
+	if err == nil || !strings.Contains(err.Error(), "upload transport: invalid proxy URL") {
+		t.Errorf("configureTransports() error = %v, expected an invalid upload proxy error", err)
+	}
+}
+
+func TestConfigureTransportsSkipTLSVerifyUpload(t *testing.T) {
+	shortenRetryDelays(t)
+	t.Cleanup(func() { configureTransports(Config{}) })
+
+	// Both servers present a certificate no client trusts.
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer api.Close()
+	storage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer storage.Close()
+
+	if err := configureTransports(Config{APIProxy: "direct", UploadProxy: "direct", SkipTLSVerifyUpload: true}); err != nil {
+		t.Fatalf("configureTransports() unexpected error: %v", err)
+	}
+
+	if err := upload.UploadJUnitXmlFile("../../testdata/valid_junit.xml", storage.URL+"/bucket/key"); err != nil {
+		t.Errorf("UploadJUnitXmlFile() error = %v, want the upload to skip verification", err)
+	}
+	_, err := testnod.CreateTestRun(api.URL+"/integrations/test_runs/upload", "token", testnod.CreateTestRunRequest{})
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("CreateTestRun() error = %v, want the API to still verify certificates", err)
+	}
+}
+
+func TestConfigureTransportsClientCert(t *testing.T) {
+	t.Run("unloadable pair", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "client.crt"), []byte("not a certificate"), 0o600)
+		os.WriteFile(filepath.Join(dir, "client.key"), []byte("not a key"), 0o600)
+
+		err := configureTransports(Config{ClientCert: filepath.Join(dir, "client.crt"), ClientKey: filepath.Join(dir, "client.key")})
+		if err == nil || !strings.Contains(err.Error(), "API transport: failed to load client certificate") {
+			t.Errorf("configureTransports() error = %v, expected a client certificate error", err)
 		}
-	}()
+	})
 
-	// Test with ignore failures true - would call os.Exit(0)
-	// Test with ignore failures false - would call os.Exit(1)
-	// We can't actually test the exit codes without subprocess testing
-	// but we can ensure the function doesn't panic
+	t.Run("flags must be paired", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
 
-	// Note: We can't actually call this function in tests because it will exit
-	// the test process. In a real scenario, you might use dependency injection
-	// or a wrapper function to make this testable.
+		for _, args := range [][]string{
+			{"cmd", "-validate", "-client-cert", "client.crt", "../../testdata/valid_junit.xml"},
+			{"cmd", "-validate", "-client-cert-upload", "../../testdata/valid_junit.xml"},
+		} {
+			os.Args = args
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-client-key") {
+				t.Errorf("parseFlags(%v) error = %v, expected a -client-key error", args[1:], err)
+			}
+		}
+	})
+}
+
+func TestExpandTags(t *testing.T) {
+	t.Setenv("BUILD_ID", "42")
+	t.Setenv("STAGE", "ci")
+	os.Unsetenv("TESTNOD_UNSET_VAR")
+
+	tests := []struct {
+		name    string
+		tags    uploadTagsFlag
+		strict  bool
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "braced and bare variables",
+			tags: uploadTagsFlag{{Value: "build-${BUILD_ID}"}, {Value: "$STAGE"}, {Value: "plain"}},
+			want: []string{"build-42", "ci", "plain"},
+		},
+		{
+			name: "unset variable expands to empty",
+			tags: uploadTagsFlag{{Value: "build-${TESTNOD_UNSET_VAR}"}},
+			want: []string{"build-"},
+		},
+		{
+			name:    "unset variable errors in strict mode",
+			tags:    uploadTagsFlag{{Value: "build-${TESTNOD_UNSET_VAR}"}},
+			strict:  true,
+			wantErr: "TESTNOD_UNSET_VAR",
+		},
+		{
+			name:   "set variable in strict mode",
+			tags:   uploadTagsFlag{{Value: "build-${BUILD_ID}"}},
+			strict: true,
+			want:   []string{"build-42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTags(tt.tags, tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandTags() error = %v, expected to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandTags() unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expandTags() returned %d tags, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got[i].Value != want {
+					t.Errorf("expandTags()[%d] = %q, want %q", i, got[i].Value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFlagsTagExpansion(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	t.Setenv("BUILD_ID", "42")
+
+	tmpFile, err := os.CreateTemp("", "expand_tags_test_*.xml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "literal by default",
+			args: []string{"cmd", "-validate", "-tag=build-${BUILD_ID}", tmpFile.Name()},
+			want: "build-${BUILD_ID}",
+		},
+		{
+			name: "expanded with flag after tag",
+			args: []string{"cmd", "-validate", "-tag=build-${BUILD_ID}", "-expand-tags", tmpFile.Name()},
+			want: "build-42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+			config, err := parseFlags()
+			if err != nil {
+				t.Fatalf("parseFlags() unexpected error: %v", err)
+			}
+			if len(config.Tags) != 1 || config.Tags[0].Value != tt.want {
+				t.Errorf("parseFlags() Tags = %v, want [%s]", config.Tags, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportResults(t *testing.T) {
+	t.Run("to file", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out.json")
+		config := Config{FilePath: "../../testdata/valid_junit.xml", Export: "json", OutputPath: out}
+
+		if err := exportResults(config, io.Discard); err != nil {
+			t.Fatalf("exportResults() unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		var report export.Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("Output is not valid JSON: %v", err)
+		}
+		if len(report.Suites) != 1 || report.Suites[0].Name != "com.example.TestSuite" {
+			t.Errorf("Unexpected exported report: %+v", report)
+		}
+	})
+
+	t.Run("to stdout", func(t *testing.T) {
+		var buf bytes.Buffer
+		config := Config{FilePath: "../../testdata/valid_junit_multiple_suites.xml", Export: "json"}
+
+		if err := exportResults(config, &buf); err != nil {
+			t.Fatalf("exportResults() unexpected error: %v", err)
+		}
+
+		var report export.Report
+		if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+			t.Fatalf("stdout is not pure JSON: %v\n%s", err, buf.String())
+		}
+		if len(report.Suites) != 2 {
+			t.Errorf("Expected 2 suites, got %d", len(report.Suites))
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		config := Config{FilePath: "../../testdata/invalid_no_testsuite.xml", Export: "json"}
+		if err := exportResults(config, io.Discard); err == nil {
+			t.Error("exportResults() expected error for invalid file")
+		}
+	})
+}
+
+func TestParseFlagsExport(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   string
+		wantQuiet bool
+	}{
+		{name: "json to file", args: []string{"cmd", "-export", "json", "-o", "out.json"}},
+		{name: "json to stdout is quiet", args: []string{"cmd", "-export", "json"}, wantQuiet: true},
+		{name: "unsupported format", args: []string{"cmd", "-export", "yaml"}, wantErr: "unsupported export format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append(tt.args, "../../testdata/valid_junit.xml")
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+			config, err := parseFlags()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags() error = %v, expected to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() unexpected error (no token should be needed): %v", err)
+			}
+			if config.Quiet != tt.wantQuiet {
+				t.Errorf("parseFlags() Quiet = %v, want %v", config.Quiet, tt.wantQuiet)
+			}
+		})
+	}
+}
+
+// shortenRetryDelays keeps tests that exercise retries through the CLI fast.
+func shortenRetryDelays(t *testing.T) {
+	t.Helper()
+	testnodDelay := testnod.SetRetryDelay(10 * time.Millisecond)
+	uploadDelay := upload.SetRetryDelay(10 * time.Millisecond)
+	webhookDelay := webhook.SetRetryDelay(10 * time.Millisecond)
+	t.Cleanup(func() {
+		testnod.SetRetryDelay(testnodDelay)
+		upload.SetRetryDelay(uploadDelay)
+		webhook.SetRetryDelay(webhookDelay)
+	})
+}
+
+// fakeTestNod serves the create test run endpoint and the presigned upload
+// URL it hands out. Tests can register extra routes on Mux.
+type fakeTestNod struct {
+	*httptest.Server
+	Mux      *http.ServeMux
+	Creates  int
+	Uploaded []byte
+
+	// CoverageUploaded is the body of the coverage upload, requested by a
+	// create with Coverage set, and CoverageType its Content-Type.
+	CoverageUploaded []byte
+	CoverageType     string
+
+	// OnRequest, if set, is called before the create and upload handlers.
+	OnRequest func(r *http.Request)
+}
+
+func newFakeTestNod(t *testing.T) *fakeTestNod {
+	t.Helper()
+	fake := &fakeTestNod{Mux: http.NewServeMux()}
+	fake.Mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+		if fake.OnRequest != nil {
+			fake.OnRequest(r)
+		}
+		fake.Creates++
+		var request testnod.CreateTestRunRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		response := testnod.SuccessfulServerResponse{
+			TestRunURL:   "https://testnod.example/runs/1",
+			PresignedURL: "http://" + r.Host + "/storage/key",
+		}
+		if request.Coverage {
+			response.CoveragePresignedURL = "http://" + r.Host + "/storage/coverage"
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	})
+	fake.Mux.HandleFunc("/storage/coverage", func(w http.ResponseWriter, r *http.Request) {
+		fake.CoverageUploaded, _ = io.ReadAll(r.Body)
+		fake.CoverageType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	})
+	fake.Mux.HandleFunc("/storage/key", func(w http.ResponseWriter, r *http.Request) {
+		if fake.OnRequest != nil {
+			fake.OnRequest(r)
+		}
+		fake.Uploaded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	})
+	fake.Server = httptest.NewServer(fake.Mux)
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// uploadConfig is a Config for uploading filePath to the fake, with the flag
+// defaults parseFlags would set.
+func (f *fakeTestNod) uploadConfig(filePath string) Config {
+	return Config{
+		Token:                "token",
+		BuildID:              "42",
+		BaseURL:              f.URL,
+		FilePath:             filePath,
+		MaxDownloadMB:        defaultMaxDownloadMB,
+		CreateAttempts:       defaultAttempts,
+		UploadAttempts:       defaultAttempts,
+		UploadMethod:         http.MethodPut,
+		PreUploadHookTimeout: defaultPreUploadHookTimeout,
+		FailIfNoUploadURL:    true,
+		RetryOnTimeout:       true,
+	}
+}
+
+func TestRunDownloadsURL(t *testing.T) {
+	fixture, err := os.ReadFile("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	server.Mux.HandleFunc("/artifacts/results.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture)
+	})
+	server.Mux.HandleFunc("/artifacts/junit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture)
+	})
+	server.Mux.HandleFunc("/artifacts/results.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not xml"))
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		config := server.uploadConfig(server.URL + "/artifacts/results.xml")
+
+		summary := run(config)
+		if summary.Failed != 0 || summary.Succeeded != 1 {
+			t.Fatalf("run() summary = %+v, expected one successful upload", summary)
+		}
+		if !bytes.Equal(server.Uploaded, fixture) {
+			t.Errorf("Uploaded content does not match the downloaded file")
+		}
+	})
+
+	t.Run("no extension in the URL", func(t *testing.T) {
+		config := server.uploadConfig(server.URL + "/artifacts/junit")
+		config.WarningsAsErrors = true
+
+		if summary := run(config); summary.Failed != 0 || summary.Succeeded != 1 {
+			t.Errorf("run() summary = %+v, want the download uploaded without an extension warning", summary)
+		}
+	})
+
+	t.Run("validation fails", func(t *testing.T) {
+		config := Config{
+			ValidateFile:  true,
+			FilePath:      server.URL + "/artifacts/results.txt",
+			MaxDownloadMB: defaultMaxDownloadMB,
+		}
+
+		summary := run(config)
+		if summary.Failed != 1 {
+			t.Errorf("run() summary = %+v, expected the downloaded file to fail validation", summary)
+		}
+	})
+
+	t.Run("temp file is removed", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		t.Setenv("TMPDIR", tmpDir)
+
+		run(Config{ValidateFile: true, FilePath: server.URL + "/artifacts/results.xml", MaxDownloadMB: defaultMaxDownloadMB})
+
+		entries, _ := os.ReadDir(tmpDir)
+		if len(entries) != 0 {
+			t.Errorf("Expected downloaded file to be removed, found %d entries", len(entries))
+		}
+	})
+}
+
+func TestParseFlagsURLArgument(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "-validate", "https://artifacts.example/results.xml"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() unexpected error (URLs should not be checked on disk): %v", err)
+	}
+	if config.MaxDownloadMB != defaultMaxDownloadMB {
+		t.Errorf("parseFlags() MaxDownloadMB = %d, want %d", config.MaxDownloadMB, defaultMaxDownloadMB)
+	}
+}
+
+func TestParseFlagsRetryAttempts(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantCreate  int
+		wantUpload  int
+		errContains string
+	}{
+		{name: "defaults", args: nil, wantCreate: 3, wantUpload: 3},
+		{name: "independent counts", args: []string{"-retries-include-create=1", "-retries-include-upload=5"}, wantCreate: 1, wantUpload: 5},
+		{name: "zero create attempts", args: []string{"-retries-include-create=0"}, errContains: "-retries-include-create must be at least 1"},
+		{name: "negative upload attempts", args: []string{"-retries-include-upload=-1"}, errContains: "-retries-include-upload must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append(append([]string{"cmd", "-validate"}, tt.args...), "../../testdata/valid_junit.xml")
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+			config, err := parseFlags()
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("parseFlags() error = %v, expected to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() unexpected error: %v", err)
+			}
+			if config.CreateAttempts != tt.wantCreate || config.UploadAttempts != tt.wantUpload {
+				t.Errorf("parseFlags() attempts = create %d, upload %d; want create %d, upload %d",
+					config.CreateAttempts, config.UploadAttempts, tt.wantCreate, tt.wantUpload)
+			}
+		})
+	}
+}
+
+func TestRewriteDocumentCanonicalize(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.xml")
+	second := filepath.Join(dir, "second.xml")
+	os.WriteFile(first, []byte(`<testsuite name="s" tests="1"><testcase name="a" classname="A" file="a.go" line="3"/></testsuite>`), 0o644)
+	os.WriteFile(second, []byte("<testsuite tests='1' name='s'>\n\t<testcase line=\"3\" file=\"a.go\" classname=\"A\" name=\"a\"></testcase>\n</testsuite>\n"), 0o644)
+
+	var outputs []string
+	for _, path := range []string{first, second} {
+		canonicalPath, err := rewriteDocument(Config{FilePath: path, Canonicalize: true}, parseFixture(t, path))
+		if err != nil {
+			t.Fatalf("rewriteDocument(%s) unexpected error: %v", path, err)
+		}
+		data, _ := os.ReadFile(canonicalPath)
+		os.Remove(canonicalPath)
+		outputs = append(outputs, string(data))
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("Expected identical canonical files:\n%s\n---\n%s", outputs[0], outputs[1])
+	}
+}
+
+func TestParseFlagsWatch(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		args        []string
+		errContains string
+	}{
+		{name: "directory without file arguments", args: []string{"cmd", "-validate", "-watch", dir}},
+		{name: "file arguments", args: []string{"cmd", "-validate", "-watch", dir, "../../testdata/valid_junit.xml"}, errContains: "-watch does not take file arguments"},
+		{name: "missing directory", args: []string{"cmd", "-validate", "-watch", filepath.Join(dir, "missing")}, errContains: "watch directory not found"},
+		{name: "file instead of directory", args: []string{"cmd", "-validate", "-watch", "../../testdata/valid_junit.xml"}, errContains: "watch directory not found"},
+		{name: "zero settle time", args: []string{"cmd", "-validate", "-watch", dir, "-watch-settle", "0s"}, errContains: "-watch-settle must be positive"},
+		{name: "file patterns", args: []string{"cmd", "-validate", "-watch", dir, "-file-pattern", "TEST-*.xml", "-file-pattern", "*.junit"}},
+		{name: "invalid file pattern", args: []string{"cmd", "-validate", "-watch", dir, "-file-pattern", "[results"}, errContains: "invalid -file-pattern"},
+		{name: "file pattern without watch", args: []string{"cmd", "-validate", "-file-pattern", "*.junit", "../../testdata/valid_junit.xml"}, errContains: "-file-pattern requires -watch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+			config, err := parseFlags()
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("parseFlags() error = %v, expected to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() unexpected error: %v", err)
+			}
+			if config.WatchDir != dir || config.WatchSettle != defaultWatchSettle {
+				t.Errorf("parseFlags() watch = %q settle %s, want %q settle %s", config.WatchDir, config.WatchSettle, dir, defaultWatchSettle)
+			}
+		})
+	}
+}
+
+func TestRewriteFileClassnamePrefix(t *testing.T) {
+	input := "../../testdata/valid_junit_multiple_suites.xml"
+	path, err := rewriteDocument(Config{FilePath: input, ClassnamePrefix: "billing."}, parseFixture(t, input))
+	if err != nil {
+		t.Fatalf("rewriteDocument() unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	if err := validation.ValidateJUnitXMLFileWithOptions(path, validation.Options{MaxDepth: defaultMaxDepth}); err != nil {
+		t.Errorf("Rewritten file failed validation: %v", err)
+	}
+
+	doc, err := junit.ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile() unexpected error: %v", err)
+	}
+	count := 0
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		count++
+		if !strings.HasPrefix(tc.Classname, "billing.") {
+			t.Errorf("Classname %q is missing the prefix", tc.Classname)
+		}
+	})
+	if count == 0 {
+		t.Fatal("Expected the rewritten file to contain testcases")
+	}
+}
+
+func TestRedactPatternFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("patterns redact the uploaded file", func(t *testing.T) {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "results.xml")
+		os.WriteFile(input, []byte(`<testsuite><testcase name="a" classname="b"><failure message="token=s3cr3t">DSN user:s3cr3t@db</failure></testcase></testsuite>`), 0o644)
+
+		os.Args = []string{"cmd", "-validate", "-redact-pattern", `token=\S+`, "-redact-pattern", "s3cr3t", input}
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags() unexpected error: %v", err)
+		}
+		if !needsRewrite(config) {
+			t.Fatal("needsRewrite() = false, expected -redact-pattern to rewrite the file")
+		}
+
+		path, err := rewriteDocument(config, parseFixture(t, config.FilePath))
+		if err != nil {
+			t.Fatalf("rewriteDocument() unexpected error: %v", err)
+		}
+		defer os.Remove(path)
+
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "s3cr3t") {
+			t.Errorf("Rewritten file still contains the secret:\n%s", data)
+		}
+		if !strings.Contains(string(data), "DSN user:***@db") {
+			t.Errorf("Rewritten file missing redacted text:\n%s", data)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		os.Args = []string{"cmd", "-validate", "-redact-pattern", "(", "../../testdata/valid_junit.xml"}
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "invalid -redact-pattern") {
+			t.Errorf("parseFlags() error = %v, expected invalid -redact-pattern", err)
+		}
+	})
+}
+
+func TestParseFlagsFileFromEnv(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name        string
+		env         string
+		args        []string
+		wantFile    string
+		errContains string
+	}{
+		{name: "env fallback", env: "../../testdata/valid_junit.xml", wantFile: "../../testdata/valid_junit.xml"},
+		{name: "positional overrides env", env: "../../testdata/pytest_junit.xml", args: []string{"../../testdata/valid_junit.xml"}, wantFile: "../../testdata/valid_junit.xml"},
+		{name: "env file must exist", env: "missing.xml", errContains: "file not found: missing.xml"},
+		{name: "neither set", errContains: "no file specified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TESTNOD_FILE", tt.env)
+			os.Args = append([]string{"cmd", "-validate"}, tt.args...)
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+			config, err := parseFlags()
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("parseFlags() error = %v, expected to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() unexpected error: %v", err)
+			}
+			if config.FilePath != tt.wantFile {
+				t.Errorf("parseFlags() FilePath = %q, want %q", config.FilePath, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestRunPreUploadHook(t *testing.T) {
+	writeResults := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "results.xml")
+		os.WriteFile(path, []byte(`<testsuite name="s"><testcase name="a" classname="internal.A"/></testsuite>`), 0o644)
+		return path
+	}
+
+	t.Run("hook modifies the uploaded file", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(writeResults(t))
+		config.PreUploadHook = "sed -i.bak 's/internal/public/' {file}"
+
+		if summary := run(config); summary.Failed != 0 {
+			t.Fatalf("run() summary = %+v, expected success", summary)
+		}
+		if !strings.Contains(string(server.Uploaded), `classname="public.A"`) {
+			t.Errorf("Expected the hook's changes to be uploaded, got:\n%s", server.Uploaded)
+		}
+	})
+
+	t.Run("failing hook aborts before creating a test run", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(writeResults(t))
+		config.PreUploadHook = "exit 1"
+
+		if summary := run(config); summary.Failed != 1 {
+			t.Errorf("run() summary = %+v, expected a failure", summary)
+		}
+		if server.Creates != 0 || server.Uploaded != nil {
+			t.Errorf("Expected nothing to be sent, got %d create(s) and upload %q", server.Creates, server.Uploaded)
+		}
+	})
+
+	t.Run("hook that breaks the file", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(writeResults(t))
+		config.PreUploadHook = "echo garbage > {file}"
+
+		if summary := run(config); summary.Failed != 1 {
+			t.Errorf("run() summary = %+v, expected the broken file to be rejected", summary)
+		}
+		if server.Creates != 0 {
+			t.Errorf("Expected no test run to be created, got %d", server.Creates)
+		}
+	})
+}
+
+func TestUploadToTestNodAttemptCounts(t *testing.T) {
+	shortenRetryDelays(t)
+
+	tests := []struct {
+		name           string
+		createFailures int
+		uploadFailures int
+		wantErr        bool
+		wantCreate     int
+		wantUpload     int
+	}{
+		{name: "no failures", wantCreate: 1, wantUpload: 1},
+		{name: "flaky create", createFailures: 2, wantCreate: 3, wantUpload: 1},
+		{name: "flaky upload", uploadFailures: 1, wantCreate: 1, wantUpload: 2},
+		{name: "create gives up", createFailures: 3, wantErr: true, wantCreate: 3, wantUpload: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createFailures, uploadFailures := tt.createFailures, tt.uploadFailures
+			mux := http.NewServeMux()
+			mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+				if createFailures > 0 {
+					createFailures--
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(testnod.SuccessfulServerResponse{PresignedURL: "http://" + r.Host + "/storage/key"})
+			})
+			mux.HandleFunc("/storage/key", func(w http.ResponseWriter, r *http.Request) {
+				if uploadFailures > 0 {
+					uploadFailures--
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			logPath := filepath.Join(t.TempDir(), "attempts.jsonl")
+			log, err := attemptlog.Open(logPath)
+			if err != nil {
+				t.Fatalf("attemptlog.Open() error = %v", err)
+			}
+			defer log.Close()
+
+			fake := &fakeTestNod{Server: server}
+			config := fake.uploadConfig("../../testdata/valid_junit.xml")
+			config.attemptLog = log
+			result, err := uploadToTestNod(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uploadToTestNod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.CreateAttempts != tt.wantCreate || result.UploadAttempts != tt.wantUpload {
+				t.Errorf("uploadToTestNod() attempts = create %d, upload %d; want create %d, upload %d",
+					result.CreateAttempts, result.UploadAttempts, tt.wantCreate, tt.wantUpload)
+			}
+
+			// One line per attempt, the successful ones included.
+			data, _ := os.ReadFile(logPath)
+			var steps []string
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				var entry attemptlog.Entry
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("Failed to parse attempt log line %q: %v", line, err)
+				}
+				steps = append(steps, fmt.Sprintf("%s:%d:%s", entry.Step, entry.Attempt, entry.Status))
+			}
+			var want []string
+			for i := 1; i <= tt.wantCreate; i++ {
+				status := attemptlog.StatusOK
+				if i <= tt.createFailures {
+					status = "E_CREATE_502"
+				}
+				want = append(want, fmt.Sprintf("create:%d:%s", i, status))
+			}
+			for i := 1; i <= tt.wantUpload; i++ {
+				status := attemptlog.StatusOK
+				if i <= tt.uploadFailures {
+					status = "E_UPLOAD_503"
+				}
+				want = append(want, fmt.Sprintf("upload:%d:%s", i, status))
+			}
+			if strings.Join(steps, " ") != strings.Join(want, " ") {
+				t.Errorf("Attempt log = %v, want %v", steps, want)
+			}
+		})
+	}
+}
+
+func TestRunSkipUpload(t *testing.T) {
+	server := newFakeTestNod(t)
+	config := server.uploadConfig("../../testdata/valid_junit.xml")
+	config.SkipUpload = true
+
+	summary := run(config)
+	if summary.Failed != 0 || summary.Action != "created" {
+		t.Fatalf("run() summary = %+v, expected one created test run", summary)
+	}
+	if server.Creates != 1 {
+		t.Errorf("Expected 1 create request, got %d", server.Creates)
+	}
+	if server.Uploaded != nil {
+		t.Errorf("Expected no upload, got %q", server.Uploaded)
+	}
+}
+
+func TestPrintCreateResponse(t *testing.T) {
+	var buf bytes.Buffer
+	err := printCreateResponse(&buf, testnod.SuccessfulServerResponse{ID: 7, TestRunURL: "https://testnod.example/runs/7", PresignedURL: "https://storage.example/key"})
+	if err != nil {
+		t.Fatalf("printCreateResponse() unexpected error: %v", err)
+	}
+
+	for _, want := range []string{`"id": 7`, `"test_run_url": "https://testnod.example/runs/7"`, `"presigned_url": "https://storage.example/key"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("printCreateResponse() output missing %s:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestUploadToTestNodMissingPresignedURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		presignedURL string
+		wantErr      string
+	}{
+		{name: "omitted", wantErr: "server did not return a presigned URL"},
+		{name: "not a URL", presignedURL: "bucket/key", wantErr: "server returned an invalid presigned URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notified bool
+			mux := http.NewServeMux()
+			mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				response := map[string]any{"id": 1, "test_run_id": 2, "upload_id": 3}
+				if tt.presignedURL != "" {
+					response["presigned_url"] = tt.presignedURL
+				}
+				json.NewEncoder(w).Encode(response)
+			})
+			mux.HandleFunc("/integrations/test_runs/upload_failed", func(w http.ResponseWriter, r *http.Request) {
+				notified = true
+				w.WriteHeader(http.StatusOK)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			fake := &fakeTestNod{Server: server}
+			_, err := uploadToTestNod(fake.uploadConfig("../../testdata/valid_junit.xml"))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("uploadToTestNod() error = %v, want %q", err, tt.wantErr)
+			}
+			if !notified {
+				t.Error("Expected TestNod to be notified of the failed upload")
+			}
+		})
+	}
+}
+
+func TestCompressionLevelFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{name: "unset", value: "", want: upload.Uncompressed},
+		{name: "number", value: "1", want: gzip.BestSpeed},
+		{name: "named", value: "BestCompression", want: gzip.BestCompression},
+		{name: "out of range", value: "12", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cmd", "-validate", "-compression-level", tt.value, "../../testdata/valid_junit.xml"}
+
+			config, err := parseFlags()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "-compression-level") {
+					t.Errorf("parseFlags() error = %v, want a -compression-level error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if got := uploadCompressionLevel(config); got != tt.want {
+				t.Errorf("uploadCompressionLevel() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStatusFile(t *testing.T) {
+	readStatus := func(path string) status.Status {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read status file: %v", err)
+		}
+		var s status.Status
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("Status file is not valid JSON: %v\n%s", err, data)
+		}
+		return s
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.StatusFile = filepath.Join(t.TempDir(), "status.json")
+		config.status = status.New(config.StatusFile)
+
+		var phases []string
+		server.OnRequest = func(r *http.Request) {
+			phases = append(phases, readStatus(config.StatusFile).Phase)
+		}
+
+		if summary := run(config); summary.Failed != 0 {
+			t.Fatalf("run() summary = %+v, expected success", summary)
+		}
+
+		final := readStatus(config.StatusFile)
+		phases = append(phases, final.Phase)
+		want := []string{status.Creating, status.Uploading, status.Done}
+		if strings.Join(phases, ",") != strings.Join(want, ",") {
+			t.Errorf("Observed phases %v, want %v", phases, want)
+		}
+		if final.File != config.FilePath || final.BytesTransferred != int64(len(server.Uploaded)) {
+			t.Errorf("Final status = %+v, want %s with %d bytes", final, config.FilePath, len(server.Uploaded))
+		}
+	})
+
+	t.Run("validation failure", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/invalid_no_testsuite.xml")
+		config.StatusFile = filepath.Join(t.TempDir(), "status.json")
+		config.status = status.New(config.StatusFile)
+
+		run(config)
+
+		if s := readStatus(config.StatusFile); s.Phase != status.Failed || s.Error == "" {
+			t.Errorf("status = %+v, want failed with an error", s)
+		}
+		if server.Creates != 0 {
+			t.Errorf("Expected no test run to be created, got %d", server.Creates)
+		}
+	})
+}
+
+func TestParseFlagsRequireMetadata(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "present", args: []string{"-branch", "main", "-commit-sha", "abc123"}},
+		{name: "missing", args: []string{"-branch", "main"}, wantErr: "required metadata missing: commit_sha"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append([]string{"cmd", "-token", "token", "-build-id", "42", "-require-metadata", "branch,commit_sha"}, tt.args...)
+			os.Args = append(os.Args, "../../testdata/valid_junit.xml")
+
+			_, err := parseFlags()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseFlags() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadMethodFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "PUT", want: http.MethodPut},
+		{value: "post", want: http.MethodPost},
+		{value: "PATCH", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cmd", "-validate", "-upload-method", tt.value, "../../testdata/valid_junit.xml"}
+
+			config, err := parseFlags()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseFlags() expected an error for -upload-method %s", tt.value)
+				}
+				return
+			}
+			if err != nil || config.UploadMethod != tt.want {
+				t.Errorf("parseFlags() UploadMethod = %q, %v, want %q", config.UploadMethod, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("upload uses the method", func(t *testing.T) {
+		t.Cleanup(func() { upload.SetMethod(http.MethodPut) })
+		server := newFakeTestNod(t)
+		var method string
+		server.OnRequest = func(r *http.Request) { method = r.Method }
+
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.UploadMethod = http.MethodPost
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if method != http.MethodPost {
+			t.Errorf("Upload used %s, want POST", method)
+		}
+	})
+}
+
+func TestParseFlagsMultipleFiles(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "validate several files",
+			args: []string{"-validate", "../../testdata/valid_junit.xml", "../../testdata/pytest_junit.xml"},
+			want: []string{"../../testdata/valid_junit.xml", "../../testdata/pytest_junit.xml"},
+		},
+		{
+			name:    "missing second file",
+			args:    []string{"-validate", "../../testdata/valid_junit.xml", "missing.xml"},
+			wantErr: "file not found: missing.xml",
+		},
+		{
+			name:    "export takes one file",
+			args:    []string{"-export", "json", "../../testdata/valid_junit.xml", "../../testdata/pytest_junit.xml"},
+			wantErr: "-export takes a single file",
+		},
+		{
+			name:    "json output requires validate",
+			args:    []string{"-check-only", "-output", "json", "../../testdata/valid_junit.xml"},
+			wantErr: "-output json requires -validate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			config, err := parseFlags()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if strings.Join(config.FilePaths, " ") != strings.Join(tt.want, " ") || config.FilePath != tt.want[0] {
+				t.Errorf("parseFlags() FilePaths = %v (FilePath %q), want %v", config.FilePaths, config.FilePath, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadToTestNodKeepTemp(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep-temp=%v", keep), func(t *testing.T) {
+			tempDir := t.TempDir()
+			t.Setenv("TMPDIR", tempDir)
+
+			server := newFakeTestNod(t)
+			config := server.uploadConfig("../../testdata/valid_junit.xml")
+			config.Canonicalize = true
+			config.KeepTemp = keep
+
+			if _, err := uploadToTestNod(config); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read temp dir: %v", err)
+			}
+			if keep && (len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "testnod-rewritten-")) {
+				t.Errorf("Expected the rewritten file to be kept, found %v", entries)
+			}
+			if !keep && len(entries) != 0 {
+				t.Errorf("Expected temporary files to be removed, found %v", entries)
+			}
+		})
+	}
+
+	t.Run("removed on error", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv("TMPDIR", tempDir)
+
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.Canonicalize = true
+		config.PreUploadHook = "exit 1"
+
+		if _, err := uploadToTestNod(config); err == nil {
+			t.Fatal("Expected the failing hook to fail the upload")
+		}
+		if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+			t.Errorf("Expected temporary files to be removed, found %v", entries)
+		}
+	})
+}
+
+func TestOnDuplicateSuite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "merged.xml")
+	content := `<testsuites><testsuite name="api"><testcase name="a"/></testsuite><testsuite name="api"><testcase name="b"/></testsuite></testsuites>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	t.Run("keep", func(t *testing.T) {
+		if needsRewrite(Config{FilePath: path, OnDuplicateSuite: onDuplicateSuiteKeep}) {
+			t.Error("Expected keep to leave the file untouched")
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		config := Config{FilePath: path, OnDuplicateSuite: onDuplicateSuiteRename}
+		if !needsRewrite(config) {
+			t.Fatal("Expected rename to rewrite the file")
+		}
+		rewritten, err := rewriteDocument(config, parseFixture(t, path))
+		if err != nil {
+			t.Fatalf("rewriteDocument() error = %v", err)
+		}
+		defer os.Remove(rewritten)
+
+		doc, err := junit.ParseFile(rewritten)
+		if err != nil {
+			t.Fatalf("Failed to parse rewritten file: %v", err)
+		}
+		if doc.Suites[0].Name != "api" || doc.Suites[1].Name != "api (2)" {
+			t.Errorf("suite names = %q, %q, want api, api (2)", doc.Suites[0].Name, doc.Suites[1].Name)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := rewriteDocument(Config{FilePath: path, OnDuplicateSuite: onDuplicateSuiteError}, parseFixture(t, path))
+		if err == nil || !strings.Contains(err.Error(), "more than one testsuite named api") {
+			t.Errorf("rewriteDocument() error = %v, want a duplicate suite error", err)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-on-duplicate-suite", "merge", path}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-on-duplicate-suite") {
+			t.Errorf("parseFlags() error = %v, want an -on-duplicate-suite error", err)
+		}
+	})
+}
+
+func TestParseFlagsMetaFile(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	fixture, err := filepath.Abs("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, ".git"), 0o755)
+	os.WriteFile(filepath.Join(root, metaFileName), []byte(`{"branch": "main", "commit_sha": "abc123", "tags": ["team-a"]}`), 0o644)
+	t.Chdir(root)
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-token", "token", "-build-id", "42", "-branch", "feature", "-require-metadata", "branch,commit_sha", fixture}
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if config.Branch != "feature" || config.CommitSHA != "abc123" || config.Tags.String() != "team-a" {
+		t.Errorf("parseFlags() branch=%q commit-sha=%q tags=%q, want the flag branch and the file's commit SHA and tags", config.Branch, config.CommitSHA, config.Tags.String())
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	err := validation.ValidateJUnitXMLFile("../../testdata/invalid_no_testsuite.xml")
+
+	t.Setenv("NO_COLOR", "1")
+	if got := formatError(Config{}, err); got != "[E_VALIDATE_ROOT] "+err.Error() {
+		t.Errorf("formatError() = %q, want the uncolored code and message", got)
+	}
+
+	if got := errcode.Code(checkPresignedURL("")); got != errcode.NoPresignedURL {
+		t.Errorf("checkPresignedURL() code = %q, want %q", got, errcode.NoPresignedURL)
+	}
+}
+
+func TestUploadToTestNodGzipInput(t *testing.T) {
+	fixture, err := os.ReadFile("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(fixture)
+	gz.Close()
+
+	// The extension says XML; only the magic bytes say gzip.
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, compressed.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	if _, err := uploadToTestNod(server.uploadConfig(path)); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+	if !bytes.Equal(server.Uploaded, fixture) {
+		t.Errorf("Expected the decompressed XML to be uploaded, got %d bytes", len(server.Uploaded))
+	}
+}
+
+func TestConfigureTransportsRateLimit(t *testing.T) {
+	t.Cleanup(func() {
+		testnod.SetTransport(http.DefaultTransport)
+		upload.SetTransport(http.DefaultTransport)
+	})
+
+	const perSecond = 10
+	if err := configureTransports(Config{APIProxy: "direct", UploadProxy: "direct", HTTP2: true, RateLimit: perSecond}); err != nil {
+		t.Fatalf("configureTransports() unexpected error: %v", err)
+	}
+
+	// Each upload is a create plus an upload request, all drawn from the
+	// same bucket.
+	server := newFakeTestNod(t)
+	start := time.Now()
+	for range 3 {
+		if _, err := uploadToTestNod(server.uploadConfig("../../testdata/valid_junit.xml")); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	const requests = 6
+	if minimum := time.Duration(requests-1) * time.Second / perSecond; elapsed < minimum {
+		t.Errorf("%d requests took %v, want at least %v at %d/s", requests, elapsed, minimum, perSecond)
+	}
+}
+
+func TestParseFlagsRateLimit(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-rate-limit", "-1", "../../testdata/valid_junit.xml"}
+
+	if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-rate-limit must not be negative") {
+		t.Errorf("parseFlags() error = %v, expected a negative rate limit error", err)
+	}
+}
+
+func TestSuiteFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	content := `<testsuites tests="3" failures="1"><testsuite name="integration.api"><testcase name="a"/><testcase name="b"><failure/></testcase></testsuite><testsuite name="unit"><testcase name="c"/></testsuite></testsuites>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	t.Run("matching suites uploaded", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(path)
+		config.SuiteFilter = `^integration\.`
+		config.suiteFilterRegexp = regexp.MustCompile(config.SuiteFilter)
+
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		doc, err := junit.Parse(bytes.NewReader(server.Uploaded))
+		if err != nil {
+			t.Fatalf("Failed to parse the uploaded file: %v", err)
+		}
+		if len(doc.Suites) != 1 || doc.Suites[0].Name != "integration.api" || doc.Tests != "2" || doc.Failures != "1" {
+			t.Errorf("Uploaded %d suite(s) with tests=%q failures=%q, want integration.api with tests=2 failures=1", len(doc.Suites), doc.Tests, doc.Failures)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		config := server.uploadConfig(path)
+		config.SuiteFilter = "^e2e"
+		config.suiteFilterRegexp = regexp.MustCompile(config.SuiteFilter)
+
+		_, err := uploadToTestNod(config)
+		if err == nil || !strings.Contains(err.Error(), "no testsuite") {
+			t.Errorf("uploadToTestNod() error = %v, want a no match error", err)
+		}
+		if server.Creates != 0 {
+			t.Errorf("Expected no test run to be created, got %d", server.Creates)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-suite-filter", "(", path}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "invalid -suite-filter") {
+			t.Errorf("parseFlags() error = %v, expected an invalid pattern error", err)
+		}
+	})
+}
+
+func TestUploadToTestNodEnvironment(t *testing.T) {
+	for _, environment := range []string{"", "staging"} {
+		t.Run(fmt.Sprintf("environment=%q", environment), func(t *testing.T) {
+			server := newFakeTestNod(t)
+			var body map[string]map[string]map[string]any
+			server.OnRequest = func(r *http.Request) {
+				if r.URL.Path == "/integrations/test_runs/upload" {
+					json.NewDecoder(r.Body).Decode(&body)
+				}
+			}
+
+			config := server.uploadConfig("../../testdata/valid_junit.xml")
+			config.Environment = environment
+			if _, err := uploadToTestNod(config); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+
+			got, ok := body["test_run"]["metadata"]["environment"]
+			if environment == "" && ok {
+				t.Errorf("Expected no environment field, got %v", got)
+			}
+			if environment != "" && got != environment {
+				t.Errorf("environment = %v, want %s", got, environment)
+			}
+		})
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: testnod.SchemaVersion},
+		{name: "override", args: []string{"-schema-version", "2"}, want: "2"},
+		{name: "empty", args: []string{"-schema-version", " "}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "t", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+			config, err := parseFlags()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "-schema-version must not be empty") {
+					t.Errorf("parseFlags() error = %v, want an empty version error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+
+			server := newFakeTestNod(t)
+			var got string
+			server.OnRequest = func(r *http.Request) {
+				if r.URL.Path == "/integrations/test_runs/upload" {
+					got = r.Header.Get(testnod.SchemaVersionHeader)
+				}
+			}
+			uploadConfig := server.uploadConfig(config.FilePath)
+			uploadConfig.SchemaVersion = config.SchemaVersion
+			t.Cleanup(func() { testnod.SetSchemaVersion("") })
+			if _, err := uploadToTestNod(uploadConfig); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", testnod.SchemaVersionHeader, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadToTestNodNote(t *testing.T) {
+	for _, note := range []string{"", "re-run after infra fix"} {
+		t.Run(fmt.Sprintf("note=%q", note), func(t *testing.T) {
+			server := newFakeTestNod(t)
+			var body map[string]map[string]any
+			server.OnRequest = func(r *http.Request) {
+				if r.URL.Path == "/integrations/test_runs/upload" {
+					json.NewDecoder(r.Body).Decode(&body)
+				}
+			}
+
+			config := server.uploadConfig("../../testdata/valid_junit.xml")
+			config.Note = note
+			if _, err := uploadToTestNod(config); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+
+			got, ok := body["test_run"]["note"]
+			if note == "" && ok {
+				t.Errorf("Expected no note field, got %v", got)
+			}
+			if note != "" && got != note {
+				t.Errorf("note = %v, want %s", got, note)
+			}
+		})
+	}
+}
+
+func TestParseFlagsNoteFile(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	dir := t.TempDir()
+	noteFile := filepath.Join(dir, "note.txt")
+	os.WriteFile(noteFile, []byte("re-run after infra fix\n"), 0o644)
+	emptyFile := filepath.Join(dir, "empty.txt")
+	os.WriteFile(emptyFile, []byte("\n"), 0o644)
+
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		wantNote string
+		wantErr  string
+	}{
+		{"note", []string{"-note", "flaky runner"}, "flaky runner", ""},
+		{"note file", []string{"-note-file", noteFile}, "re-run after infra fix", ""},
+		{"both", []string{"-note", "x", "-note-file", noteFile}, "", "mutually exclusive"},
+		{"empty file", []string{"-note-file", emptyFile}, "", "no note in"},
+		{"missing file", []string{"-note-file", filepath.Join(dir, "missing.txt")}, "", "failed to read -note-file"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "t", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+
+			config, err := parseFlags()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if config.Note != tt.wantNote {
+				t.Errorf("Note = %q, want %q", config.Note, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	dir := t.TempDir()
+	warnOnly := filepath.Join(dir, "warn.xml")
+	os.WriteFile(warnOnly, []byte(`<testsuites><testsuite name="empty"></testsuite><testsuite name="a"><testcase name="t"/></testsuite></testsuites>`), 0o644)
+	broken := filepath.Join(dir, "broken.xml")
+	os.WriteFile(broken, []byte(`<testsuites><testsuite name="empty"></testsuite><testsuite name="a"><testcase name="t">`), 0o644)
+
+	tests := []struct {
+		name             string
+		file             string
+		warningsAsErrors bool
+		wantCode         string
+	}{
+		{name: "warnings pass by default", file: warnOnly},
+		{name: "warnings fail when strict", file: warnOnly, warningsAsErrors: true, wantCode: errcode.ValidateWarnings},
+		{name: "errors always fail", file: broken, wantCode: errcode.ValidateMalformed},
+		{name: "errors win over warnings when strict", file: broken, warningsAsErrors: true, wantCode: errcode.ValidateMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{FilePath: tt.file, WarningsAsErrors: tt.warningsAsErrors}
+			if got := errcode.Code(validateOnly(config)); got != tt.wantCode {
+				t.Errorf("validateOnly() code = %q, want %q", got, tt.wantCode)
+			}
+
+			report, err := validateForReport(config)
+			if errcode.Code(err) != tt.wantCode || len(report.Warnings) != 1 {
+				t.Errorf("validateForReport() = %+v, %v; want one warning and code %q", report, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestConnectionPoolFlags(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-max-conns-per-host", "32", "-max-idle-conns", "300", "-max-idle-conns-per-host", "16", "../../testdata/valid_junit.xml"}
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+
+	var opts transport.Options
+	poolOptions(&opts, config)
+	tr, err := transport.New(opts)
+	if err != nil {
+		t.Fatalf("transport.New() error = %v", err)
+	}
+	if tr.MaxConnsPerHost != 32 || tr.MaxIdleConns != 300 || tr.MaxIdleConnsPerHost != 16 {
+		t.Errorf("transport pool = %d/%d/%d, want 32/300/16", tr.MaxConnsPerHost, tr.MaxIdleConns, tr.MaxIdleConnsPerHost)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-max-conns-per-host", "-1", "../../testdata/valid_junit.xml"}
+	if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("parseFlags() error = %v, expected a negative value error", err)
+	}
+}
+
+func TestUploadToTestNodWebhook(t *testing.T) {
+	shortenRetryDelays(t)
+
+	t.Run("payload", func(t *testing.T) {
+		var got webhook.Payload
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+		}))
+		defer hook.Close()
+
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.WebhookURL = hook.URL
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+
+		want := webhook.Payload{TestRunURL: "https://testnod.example/runs/1", File: "../../testdata/valid_junit.xml", Status: webhook.StatusUploaded}
+		if got != want {
+			t.Errorf("Webhook received %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("failure doesn't fail the upload", func(t *testing.T) {
+		calls := 0
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer hook.Close()
+
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.WebhookURL = hook.URL
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Errorf("uploadToTestNod() error = %v, want the upload to succeed", err)
+		}
+		if calls != 2 {
+			t.Errorf("Webhook called %d times, want 2 (one retry)", calls)
+		}
+	})
+
+	t.Run("not called when the upload fails", func(t *testing.T) {
+		calls := 0
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+		defer hook.Close()
+
+		server := newFakeTestNod(t)
+		config := server.uploadConfig("../../testdata/invalid_no_testsuite.xml")
+		config.WebhookURL = hook.URL
+		uploadToTestNod(config)
+		if calls != 0 {
+			t.Errorf("Webhook called %d times after a failed upload", calls)
+		}
+	})
+}
+
+func TestParseFlagsValidateMaxTime(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-validate-max-time", "-1", "../../testdata/valid_junit.xml"}
+
+	if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-validate-max-time must not be negative") {
+		t.Errorf("parseFlags() error = %v, want a negative limit error", err)
+	}
+}
+
+func TestParseFlagsValidateEncoding(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		value   string
+		wantErr bool
+	}{
+		{"utf-8", false},
+		{"UTF8", false},
+		{"latin-1", true},
+	} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-validate-encoding", tt.value, "../../testdata/valid_junit.xml"}
+
+		config, err := parseFlags()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFlags(-validate-encoding %s) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if !tt.wantErr && validationOptions(config).Encoding != tt.value {
+			t.Errorf("validationOptions().Encoding = %q, want %q", validationOptions(config).Encoding, tt.value)
+		}
+	}
+}
+
+func TestParseFlagsQuickValidate(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"default limit", []string{"-quick-validate"}, ""},
+		{"no limit", []string{"-quick-validate", "-quick-validate-kb", "0"}, ""},
+		{"negative limit", []string{"-quick-validate", "-quick-validate-kb", "-1"}, "-quick-validate-kb must not be negative"},
+		{"with max-testcases", []string{"-quick-validate", "-max-testcases", "10"}, "-quick-validate can't be combined"},
+		{"with warnings-as-errors", []string{"-quick-validate", "-warnings-as-errors"}, "-quick-validate can't be combined"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-validate"}, tt.args...), "../../testdata/valid_junit.xml")
+
+			config, err := parseFlags()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			opts := validationOptions(config)
+			if !opts.Quick || opts.QuickLimit != int64(config.QuickValidateKB)*1024 {
+				t.Errorf("validationOptions() = %+v, want a quick validation limited to %d KB", opts, config.QuickValidateKB)
+			}
+			if err := validateOnly(config); err != nil {
+				t.Errorf("validateOnly() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenStdin(t *testing.T) {
+	oldArgs := os.Args
+	oldStdin := stdin
+	defer func() {
+		os.Args = oldArgs
+		stdin = oldStdin
+	}()
+
+	// pipeToken feeds content to stdin through a pipe, as a shell would.
+	pipeToken := func(t *testing.T, content string) {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("os.Pipe() error = %v", err)
+		}
+		t.Cleanup(func() { r.Close() })
+		go func() {
+			w.WriteString(content)
+			w.Close()
+		}()
+		stdin = r
+	}
+
+	t.Run("token is used", func(t *testing.T) {
+		var gotToken string
+		server := newFakeTestNod(t)
+		server.OnRequest = func(r *http.Request) {
+			if r.URL.Path == "/integrations/test_runs/upload" {
+				gotToken = r.Header.Get("Project-Token")
+			}
+		}
+		pipeToken(t, "piped-token\r\n")
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-token-stdin", "-build-id", "42", "../../testdata/valid_junit.xml"}
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags() error = %v", err)
+		}
+		if config.Token != "piped-token" {
+			t.Fatalf("Token = %q, want the trimmed first line of stdin", config.Token)
+		}
+		config.BaseURL = server.URL
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if gotToken != "piped-token" {
+			t.Errorf("Project-Token header = %q, want %q", gotToken, "piped-token")
+		}
+	})
+
+	errorCases := []struct {
+		name    string
+		args    []string
+		input   string
+		wantErr string
+	}{
+		{"empty input", []string{"-token-stdin", "-build-id", "42", "../../testdata/valid_junit.xml"}, "", "no token on standard input"},
+		{"with -stdin", []string{"-token-stdin", "-validate", "-stdin"}, "token\n", "can't be combined"},
+		{"with a - argument", []string{"-token-stdin", "-validate", "-"}, "token\n", "can't be combined"},
+		{"with -token", []string{"-token-stdin", "-token", "other", "-build-id", "42", "../../testdata/valid_junit.xml"}, "token\n", "mutually exclusive"},
+	}
+	for _, tt := range errorCases {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeToken(t, tt.input)
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizePaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	content := `<testsuite name="windows"><testcase classname="C:\work\src\api" name="spec\users_spec.rb"/></testsuite>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.NormalizePaths = true
+	config.StripDriveLetters = true
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+	if !bytes.Contains(server.Uploaded, []byte(`classname="/work/src/api"`)) || !bytes.Contains(server.Uploaded, []byte(`name="spec/users_spec.rb"`)) {
+		t.Errorf("Uploaded %s, want normalized classname and name", server.Uploaded)
+	}
+
+	t.Run("strip-drive-letters requires normalize-paths", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-strip-drive-letters", "../../testdata/valid_junit.xml"}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-strip-drive-letters requires -normalize-paths") {
+			t.Errorf("parseFlags() error = %v, want a missing -normalize-paths error", err)
+		}
+	})
+}
+
+func TestCollapseRetries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	content := `<testsuite name="unit" tests="3" failures="1"><testcase classname="A" name="a"><failure/><system-out>first</system-out></testcase><testcase classname="A" name="b"/><testcase classname="A" name="a"><system-out>second</system-out></testcase></testsuite>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.CollapseRetries = true
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+
+	doc, err := junit.Parse(bytes.NewReader(server.Uploaded))
+	if err != nil {
+		t.Fatalf("Failed to parse the uploaded file: %v", err)
+	}
+	suite := doc.Suites[0]
+	if len(suite.Testcases) != 2 || suite.Tests != "2" || suite.Failures != "0" {
+		t.Fatalf("Uploaded %s, want testcases a and b with tests=2 failures=0", server.Uploaded)
+	}
+	if out := suite.Testcases[0].SystemOut; len(out) != 1 || out[0].Text != "first\nsecond" {
+		t.Errorf("Uploaded system-out %+v, want both attempts", out)
+	}
+}
+
+func TestSummaryJUnit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	content := `<testsuite name="unit" time="2.5"><testcase name="a"/><testcase name="b"><failure/></testcase><testcase name="c"><error/></testcase></testsuite>`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.SummaryJUnit = true
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+
+	if !bytes.Contains(server.Uploaded, []byte("<testsuites")) {
+		t.Fatalf("Uploaded %s, want a <testsuites> root", server.Uploaded)
+	}
+	doc, err := junit.Parse(bytes.NewReader(server.Uploaded))
+	if err != nil {
+		t.Fatalf("Failed to parse the uploaded file: %v", err)
+	}
+	if doc.Bare || doc.Tests != "3" || doc.Failures != "1" || doc.Errors != "1" || doc.Time != "2.5" {
+		t.Errorf("Uploaded tests=%q failures=%q errors=%q time=%q, want 3, 1, 1 and 2.5", doc.Tests, doc.Failures, doc.Errors, doc.Time)
+	}
+}
+
+func TestTagPrefix(t *testing.T) {
+	t.Run("idempotent", func(t *testing.T) {
+		tags := uploadTagsFlag{{Value: "nightly"}, {Value: "ci/linux"}, {Value: "ci"}}
+		once := prefixTags(tags, "ci/")
+		if got := once.String(); got != "ci/nightly,ci/linux,ci/ci" {
+			t.Errorf("prefixTags() = %q, want ci/nightly,ci/linux,ci/ci", got)
+		}
+		if twice := prefixTags(once, "ci/"); twice.String() != once.String() {
+			t.Errorf("prefixTags() twice = %q, want %q", twice.String(), once.String())
+		}
+	})
+
+	t.Run("duplicates after prefixing", func(t *testing.T) {
+		tags := uploadTagsFlag{{Value: "nightly"}, {Value: "ci/nightly"}}
+		prefixed := prefixTags(tags, "ci/")
+		if got := prefixed.String(); got != "ci/nightly" {
+			t.Errorf("prefixTags() = %q, want a single ci/nightly", got)
+		}
+	})
+
+	t.Run("all tag sources", func(t *testing.T) {
+		fixture, err := filepath.Abs("../../testdata/valid_junit.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, nested := writeRepo(t)
+		writeMetaFile(t, root, `{"tags": ["team-a", "ci/from-file"]}`)
+		t.Chdir(nested)
+		t.Setenv("STAGE", "deploy")
+
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-tag-prefix", "ci/", "-tag", "nightly", "-tag", "$STAGE", "-expand-tags", fixture}
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags() error = %v", err)
+		}
+		if got := config.Tags.String(); got != "ci/nightly,ci/deploy,ci/team-a,ci/from-file" {
+			t.Errorf("Tags = %q, want every flag, expanded and file tag prefixed once", got)
+		}
+	})
+}
+
+func TestTagFromFilename(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		for pattern, wantErr := range map[string]string{
+			`shard-(\d+)`: "",
+			`shard-\d+`:   "needs a capture group",
+			`shard-(`:     "invalid -tag-from-filename",
+		} {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cmd", "-validate", "-tag-from-filename", pattern, "../../testdata/valid_junit.xml"}
+			_, err := parseFlags()
+			if wantErr == "" && err != nil {
+				t.Errorf("parseFlags(%s) error = %v", pattern, err)
+			}
+			if wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)) {
+				t.Errorf("parseFlags(%s) error = %v, want %q", pattern, err, wantErr)
+			}
+		}
+	})
+
+	t.Run("tags each run", func(t *testing.T) {
+		fixture, err := os.ReadFile("../../testdata/valid_junit.xml")
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		dir := t.TempDir()
+		var paths []string
+		for _, name := range []string{"shard-3.xml", "shard-12.junit.xml", "results.xml", "ci-shard-nightly.xml"} {
+			path := filepath.Join(dir, name)
+			os.WriteFile(path, fixture, 0o644)
+			paths = append(paths, path)
+		}
+
+		server := newFakeTestNod(t)
+		var tags []string
+		server.OnRequest = func(r *http.Request) {
+			if r.URL.Path == "/integrations/test_runs/upload" {
+				var request testnod.CreateTestRunRequest
+				json.NewDecoder(r.Body).Decode(&request)
+				var values []string
+				for _, tag := range request.Tags {
+					values = append(values, tag.Value)
+				}
+				tags = append(tags, strings.Join(values, ","))
+			}
+		}
+
+		config := server.uploadConfig(paths[0])
+		config.FilePaths = paths
+		config.Tags = uploadTagsFlag{{Value: "ci/nightly"}}
+		config.TagPrefix = "ci/"
+		config.tagFromFilenameRe = regexp.MustCompile(`shard-(\w+)`)
+		config.Quiet = true
+		if summary := run(config); summary.Failed > 0 {
+			t.Fatalf("run() summary = %+v, want every file uploaded", summary)
+		}
+
+		want := []string{"ci/nightly,ci/3", "ci/nightly,ci/12", "ci/nightly", "ci/nightly"}
+		if !slices.Equal(tags, want) {
+			t.Errorf("create tags = %q, want %q", tags, want)
+		}
+	})
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	valid := `<testsuite name="s"><testcase name="a"/></testsuite>`
+	a := write("a.xml", valid)
+	b := write("b.xml", "<testsuite>")
+	c := write("c.xml", valid)
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+
+	resumeConfig := func(server *fakeTestNod) Config {
+		t.Helper()
+		config := server.uploadConfig(a)
+		config.FilePaths = []string{a, b, c}
+		config.Resume = checkpointPath
+		var err error
+		if config.checkpoint, err = checkpoint.Load(checkpointPath); err != nil {
+			t.Fatalf("checkpoint.Load() error = %v", err)
+		}
+		return config
+	}
+
+	// The first run is interrupted by b, which is broken.
+	server := newFakeTestNod(t)
+	summary := run(resumeConfig(server))
+	if summary.Succeeded != 2 || summary.Failed != 1 || server.Creates != 2 {
+		t.Fatalf("First run summary = %+v with %d create(s), want a and c uploaded and b failed", summary, server.Creates)
+	}
+
+	// Once b is fixed, resuming only uploads b.
+	write("b.xml", valid)
+	server = newFakeTestNod(t)
+	summary = run(resumeConfig(server))
+	if summary.Succeeded != 1 || summary.Skipped != 2 || summary.Failed != 0 || server.Creates != 1 {
+		t.Errorf("Resumed run summary = %+v with %d create(s), want b uploaded and a and c skipped", summary, server.Creates)
+	}
+
+	// A file whose content changed is uploaded again.
+	write("c.xml", `<testsuite name="s"><testcase name="changed"/></testsuite>`)
+	server = newFakeTestNod(t)
+	summary = run(resumeConfig(server))
+	if summary.Succeeded != 1 || summary.Skipped != 2 || !strings.Contains(string(server.Uploaded), "changed") {
+		t.Errorf("Run after changing c summary = %+v, want only c uploaded again", summary)
+	}
+
+	t.Run("not with -validate", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-resume", checkpointPath, a}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-resume only applies to uploading") {
+			t.Errorf("parseFlags() error = %v, want -resume rejected", err)
+		}
+	})
+}
+
+func TestParseFlagsUploadSuccessStatus(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "200, 204", want: []int{200, 204}},
+		{value: "404", wantErr: true},
+		{value: "ok", wantErr: true},
+	} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-upload-success-status", tt.value, "../../testdata/valid_junit.xml"}
+
+		config, err := parseFlags()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFlags(-upload-success-status %q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(config.uploadSuccess, tt.want) {
+			t.Errorf("parseFlags(-upload-success-status %q) = %v, want %v", tt.value, config.uploadSuccess, tt.want)
+		}
+	}
+}
+
+func TestUploadToTestNodUploadURL(t *testing.T) {
+	server := newFakeTestNod(t)
+	var uploadedTo string
+	server.Mux.HandleFunc("/runs/", func(w http.ResponseWriter, r *http.Request) {
+		uploadedTo = r.URL.Path
+	})
+
+	config := server.uploadConfig("../../testdata/valid_junit.xml")
+	config.UploadURL = server.URL + "/runs/{id}/upload"
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+	if uploadedTo != "/runs/0/upload" {
+		t.Errorf("Uploaded to %q, want /runs/0/upload with the created run's ID", uploadedTo)
+	}
+	if server.Uploaded != nil {
+		t.Error("Expected the presigned URL not to be used")
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-upload-url", "runs/{id}/upload", "../../testdata/valid_junit.xml"}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "invalid -upload-url") {
+			t.Errorf("parseFlags() error = %v, want an invalid URL error", err)
+		}
+	})
+}
+
+func TestFailIfNoUploadURL(t *testing.T) {
+	shortenRetryDelays(t)
+
+	// newServer is a self-hosted server that answers 201 without a presigned
+	// URL and accepts uploads at /runs/{id}/upload.
+	newServer := func(t *testing.T) (*fakeTestNod, *string) {
+		uploadedTo := new(string)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 7, "test_run_url": "https://testnod.example/runs/7"})
+		})
+		mux.HandleFunc("/runs/", func(w http.ResponseWriter, r *http.Request) {
+			*uploadedTo = r.URL.Path
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return &fakeTestNod{Server: server}, uploadedTo
+	}
+
+	t.Run("fails by default", func(t *testing.T) {
+		server, uploadedTo := newServer(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.UploadURL = server.URL + "/runs/{id}/upload"
+
+		_, err := uploadToTestNod(config)
+		if got := errcode.Code(err); got != errcode.NoPresignedURL {
+			t.Errorf("uploadToTestNod() error = %v, want code %s", err, errcode.NoPresignedURL)
+		}
+		if *uploadedTo != "" {
+			t.Errorf("Uploaded to %s, want no upload", *uploadedTo)
+		}
+	})
+
+	t.Run("override with an upload URL template", func(t *testing.T) {
+		server, uploadedTo := newServer(t)
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.UploadURL = server.URL + "/runs/{id}/upload"
+		config.FailIfNoUploadURL = false
+
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if *uploadedTo != "/runs/7/upload" {
+			t.Errorf("Uploaded to %q, want /runs/7/upload", *uploadedTo)
+		}
+	})
+
+	t.Run("override requires a template", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+
+		for _, args := range [][]string{
+			{"cmd", "-validate", "-fail-if-no-upload-url=false", "../../testdata/valid_junit.xml"},
+			{"cmd", "-validate", "-fail-if-no-upload-url=false", "-upload-url", "https://storage.example/upload", "../../testdata/valid_junit.xml"},
+		} {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = args
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "requires an -upload-url with an {id} template") {
+				t.Errorf("parseFlags(%q) error = %v, want a missing template error", args, err)
+			}
+		}
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	server := newFakeTestNod(t)
+	headers := make(map[string]string)
+	server.OnRequest = func(r *http.Request) {
+		headers[r.URL.Path] = r.Header.Get("X-Request-Id")
+	}
+
+	logPath := filepath.Join(t.TempDir(), "attempts.jsonl")
+	log, err := attemptlog.Open(logPath)
+	if err != nil {
+		t.Fatalf("attemptlog.Open() error = %v", err)
+	}
+	defer log.Close()
+
+	config := server.uploadConfig("../../testdata/valid_junit.xml")
+	config.RequestID = "build-42.1"
+	config.attemptLog = log
+	if _, err := uploadToTestNod(config); err != nil {
+		t.Fatalf("uploadToTestNod() error = %v", err)
+	}
+
+	for _, path := range []string{"/integrations/test_runs/upload", "/storage/key"} {
+		if headers[path] != "build-42.1" {
+			t.Errorf("%s X-Request-Id = %q, want build-42.1", path, headers[path])
+		}
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read attempt log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, line := range lines {
+		var entry attemptlog.Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.RequestID != "build-42.1" {
+			t.Errorf("Attempt log line %s, want request_id build-42.1", line)
+		}
+	}
+	if len(lines) != 2 {
+		t.Errorf("Attempt log has %d lines, want create and upload", len(lines))
+	}
+
+	t.Run("generated", func(t *testing.T) {
+		id := newRequestID()
+		if !requestIDPattern.MatchString(id) || len(id) != 32 || id == newRequestID() {
+			t.Errorf("newRequestID() = %q, want 32 random hex characters", id)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-request-id", "abc\r\nX-Injected: 1", "../../testdata/valid_junit.xml"}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "invalid -request-id") {
+			t.Errorf("parseFlags() error = %v, want an invalid request ID error", err)
+		}
+	})
+}
+
+func TestStorageBackend(t *testing.T) {
+	t.Run("azure headers on upload", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		var blobType string
+		server.OnRequest = func(r *http.Request) {
+			if r.URL.Path == "/storage/key" {
+				blobType = r.Header.Get("x-ms-blob-type")
+			}
+		}
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.StorageBackend = upload.BackendAzure
+		t.Cleanup(func() { upload.SetStorageBackend(upload.BackendS3) })
+
+		if _, err := uploadToTestNod(config); err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if blobType != "BlockBlob" {
+			t.Errorf("x-ms-blob-type = %q, want BlockBlob", blobType)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-storage-backend", "ftp", "../../testdata/valid_junit.xml"}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "unsupported -storage-backend") {
+			t.Errorf("parseFlags() error = %v, want an unsupported backend error", err)
+		}
+	})
+}
+
+func TestMaxAttemptsTotal(t *testing.T) {
+	shortenRetryDelays(t)
+
+	// failingTestNod fails the first createFailures creates and every upload.
+	failingTestNod := func(t *testing.T, createFailures int) (server *httptest.Server, creates, uploads *int) {
+		creates, uploads = new(int), new(int)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+			*creates++
+			if *creates <= createFailures {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(testnod.SuccessfulServerResponse{
+				TestRunURL:   "https://testnod.example/runs/1",
+				PresignedURL: "http://" + r.Host + "/storage/key",
+			})
+		})
+		mux.HandleFunc("/storage/key", func(w http.ResponseWriter, r *http.Request) {
+			*uploads++
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		server = httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server, creates, uploads
+	}
+
+	for _, tt := range []struct {
+		name           string
+		createFailures int
+		total          int
+		wantCreates    int
+		wantUploads    int
+	}{
+		{"spent on create", 10, 2, 2, 0},
+		{"shared by create and upload", 2, 4, 3, 1},
+		{"used up exactly by create", 2, 3, 3, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, creates, uploads := failingTestNod(t, tt.createFailures)
+			config := (&fakeTestNod{Server: server}).uploadConfig("../../testdata/valid_junit.xml")
+			config.CreateAttempts = 5
+			config.UploadAttempts = 5
+			config.MaxAttemptsTotal = tt.total
+			config.attemptBudget = newAttemptBudget(tt.total)
+
+			if _, err := uploadToTestNod(config); err == nil {
+				t.Fatal("uploadToTestNod() error = nil, want the failed attempts to fail it")
+			}
+			if *creates+*uploads > tt.total {
+				t.Errorf("Made %d create and %d upload attempts, more than the total of %d", *creates, *uploads, tt.total)
+			}
+			if *creates != tt.wantCreates || *uploads != tt.wantUploads {
+				t.Errorf("Made %d create and %d upload attempts, want %d and %d", *creates, *uploads, tt.wantCreates, tt.wantUploads)
+			}
+		})
+	}
+
+	t.Run("rejects a negative total", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-token", "token", "-max-attempts-total", "-1", "../../testdata/valid_junit.xml"}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-max-attempts-total must not be negative") {
+			t.Errorf("parseFlags() error = %v, want a negative total error", err)
+		}
+	})
+}
+
+func TestRetryOnTimeout(t *testing.T) {
+	shortenRetryDelays(t)
+
+	// A response header timeout well below the server's delay makes every
+	// slow attempt time out without waiting for the clients' own timeouts.
+	timeoutTransport := &http.Transport{ResponseHeaderTimeout: 20 * time.Millisecond}
+	testnod.SetTransport(timeoutTransport)
+	upload.SetTransport(timeoutTransport)
+	t.Cleanup(func() { configureTransports(Config{}) })
+
+	// slowTestNod delays the creates when slowCreate is set, and the uploads
+	// otherwise, long enough to time out.
+	slowTestNod := func(t *testing.T, slowCreate bool) (server *httptest.Server, creates, uploads *atomic.Int32) {
+		creates, uploads = new(atomic.Int32), new(atomic.Int32)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+			creates.Add(1)
+			if slowCreate {
+				time.Sleep(200 * time.Millisecond)
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(testnod.SuccessfulServerResponse{
+				TestRunURL:   "https://testnod.example/runs/1",
+				PresignedURL: "http://" + r.Host + "/storage/key",
+			})
+		})
+		mux.HandleFunc("/storage/key", func(w http.ResponseWriter, r *http.Request) {
+			uploads.Add(1)
+			if !slowCreate {
+				time.Sleep(200 * time.Millisecond)
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+		mux.HandleFunc("/integrations/test_runs/upload_failed", func(w http.ResponseWriter, r *http.Request) {})
+		server = httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server, creates, uploads
+	}
+
+	for _, tt := range []struct {
+		name           string
+		slowCreate     bool
+		retryOnTimeout bool
+		wantCreates    int32
+		wantUploads    int32
+		wantCode       string
+	}{
+		{"create retried by default", true, true, 3, 0, errcode.CreateTimeout},
+		{"create fails on the first timeout", true, false, 1, 0, errcode.CreateTimeout},
+		{"upload retried by default", false, true, 1, 3, errcode.UploadTimeout},
+		{"upload fails on the first timeout", false, false, 1, 1, errcode.UploadTimeout},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, creates, uploads := slowTestNod(t, tt.slowCreate)
+			config := (&fakeTestNod{Server: server}).uploadConfig("../../testdata/valid_junit.xml")
+			config.RetryOnTimeout = tt.retryOnTimeout
+
+			_, err := uploadToTestNod(config)
+			if got := errcode.Code(err); got != tt.wantCode {
+				t.Fatalf("uploadToTestNod() error = %v, want code %s", err, tt.wantCode)
+			}
+			if creates.Load() != tt.wantCreates || uploads.Load() != tt.wantUploads {
+				t.Errorf("Made %d create and %d upload attempts, want %d and %d", creates.Load(), uploads.Load(), tt.wantCreates, tt.wantUploads)
+			}
+		})
+	}
+
+	t.Run("other errors are still retried", func(t *testing.T) {
+		var creates atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			creates.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+		config := (&fakeTestNod{Server: server}).uploadConfig("../../testdata/valid_junit.xml")
+		config.RetryOnTimeout = false
+
+		if _, err := uploadToTestNod(config); err == nil {
+			t.Fatal("uploadToTestNod() error = nil, want the failed creates to fail it")
+		}
+		if creates.Load() != 3 {
+			t.Errorf("Made %d create attempts, want 3", creates.Load())
+		}
+	})
+}
+
+func TestAnnotate(t *testing.T) {
+	server := newFakeTestNod(t)
+
+	t.Run("notice on success", func(t *testing.T) {
+		config := server.uploadConfig("../../testdata/valid_junit.xml")
+		config.GitHubAnnotations = true
+		result, err := uploadToTestNod(config)
+		if err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+
+		var buf bytes.Buffer
+		annotate(config, &buf, config.FilePath, []string{result.TestRunURL}, err)
+		if want := "::notice::TestNod test run: https://testnod.example/runs/1\n"; buf.String() != want {
+			t.Errorf("annotate() wrote %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("error on validation failure", func(t *testing.T) {
+		config := server.uploadConfig("../../testdata/invalid_no_testsuite.xml")
+		config.GitHubAnnotations = true
+		result, err := uploadToTestNod(config)
+		if err == nil {
+			t.Fatal("uploadToTestNod() error = nil, want a validation error")
+		}
+
+		var buf bytes.Buffer
+		annotate(config, &buf, config.FilePath, []string{result.TestRunURL}, err)
+		want := "::error file=../../testdata/invalid_no_testsuite.xml::" + err.Error() + "\n"
+		if buf.String() != want {
+			t.Errorf("annotate() wrote %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("notice per group run", func(t *testing.T) {
+		var buf bytes.Buffer
+		annotate(Config{GitHubAnnotations: true}, &buf, "results.xml", []string{"https://testnod.example/runs/1", "https://testnod.example/runs/2"}, nil)
+		want := "::notice::TestNod test run: https://testnod.example/runs/1\n::notice::TestNod test run: https://testnod.example/runs/2\n"
+		if buf.String() != want {
+			t.Errorf("annotate() wrote %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("no file for URLs", func(t *testing.T) {
+		var buf bytes.Buffer
+		annotate(Config{GitHubAnnotations: true}, &buf, "https://ci.example/junit.xml", nil, errors.New("download failed"))
+		if want := "::error::download failed\n"; buf.String() != want {
+			t.Errorf("annotate() wrote %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		annotate(Config{}, &buf, "results.xml", nil, errors.New("upload failed"))
+		if buf.Len() != 0 {
+			t.Errorf("annotate() wrote %q without -github-annotations", buf.String())
+		}
+	})
+}
+
+func TestParseFlagsGitHubAnnotations(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		name          string
+		githubActions string
+		args          []string
+		want          bool
+	}{
+		{"off outside GitHub Actions", "", nil, false},
+		{"on by default on GitHub Actions", "true", nil, true},
+		{"explicit opt-out on GitHub Actions", "true", []string{"-github-annotations=false"}, false},
+		{"explicit opt-in", "", []string{"-github-annotations"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_ACTIONS", tt.githubActions)
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "token", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+
+			config, err := parseFlags()
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if config.GitHubAnnotations != tt.want {
+				t.Errorf("GitHubAnnotations = %v, want %v", config.GitHubAnnotations, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	// base64("ci:s3cret")
+	const want = "Basic Y2k6czNjcmV0"
+
+	for _, withUpload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upload %v", withUpload), func(t *testing.T) {
+			server := newFakeTestNod(t)
+			headers := make(map[string]string)
+			server.OnRequest = func(r *http.Request) {
+				headers[r.URL.Path] = r.Header.Get("Authorization")
+			}
+
+			config := server.uploadConfig("../../testdata/valid_junit.xml")
+			config.BasicUser = "ci"
+			config.BasicPass = "s3cret"
+			config.BasicAuthUpload = withUpload
+			t.Cleanup(func() { setBasicAuth(Config{}) })
+			if _, err := uploadToTestNod(config); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+
+			if got := headers["/integrations/test_runs/upload"]; got != want {
+				t.Errorf("create Authorization = %q, want %q", got, want)
+			}
+			wantUpload := ""
+			if withUpload {
+				wantUpload = want
+			}
+			if got := headers["/storage/key"]; got != wantUpload {
+				t.Errorf("upload Authorization = %q, want %q", got, wantUpload)
+			}
+		})
+	}
+
+	passFile := filepath.Join(t.TempDir(), "pass")
+	if err := os.WriteFile(passFile, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      string
+		wantPass string
+		wantErr  string
+	}{
+		{name: "flag", args: []string{"-basic-user", "ci", "-basic-pass", "from-flag"}, env: "from-env", wantPass: "from-flag"},
+		{name: "file", args: []string{"-basic-user", "ci", "-basic-pass-file", passFile}, env: "from-env", wantPass: "from-file"},
+		{name: "environment", args: []string{"-basic-user", "ci"}, env: "from-env", wantPass: "from-env"},
+		{name: "flag and file", args: []string{"-basic-user", "ci", "-basic-pass", "x", "-basic-pass-file", passFile}, wantErr: "mutually exclusive"},
+		{name: "password without user", args: []string{"-basic-pass", "x"}, wantErr: "require -basic-user"},
+		{name: "upload without user", args: []string{"-basic-auth-upload"}, wantErr: "require -basic-user"},
+		{name: "missing file", args: []string{"-basic-user", "ci", "-basic-pass-file", filepath.Join(t.TempDir(), "missing")}, wantErr: "failed to read -basic-pass-file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			t.Setenv("TESTNOD_BASIC_PASS", tt.env)
+			os.Args = append(append([]string{"cmd", "-token", "token", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+
+			config, err := parseFlags()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if config.BasicPass != tt.wantPass {
+				t.Errorf("parseFlags() password = %q, want %q", config.BasicPass, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestRetryJitterSeed(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		args    []string
+		wantSet bool
+	}{
+		{args: []string{"cmd", "-validate", "../../testdata/valid_junit.xml"}},
+		{args: []string{"cmd", "-validate", "-retry-jitter-seed", "0", "../../testdata/valid_junit.xml"}, wantSet: true},
+	} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = tt.args
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags(%v) error = %v", tt.args, err)
+		}
+		if config.retryJitterSeedSet != tt.wantSet || config.RetryJitterSeed != 0 {
+			t.Errorf("parseFlags(%v) seed = %d (set %v), want 0 (set %v)", tt.args, config.RetryJitterSeed, config.retryJitterSeedSet, tt.wantSet)
+		}
+	}
+}
+
+func TestExitBasedOnIgnoreFailures(t *testing.T) {
+	// We can't directly test os.Exit, but we can test the function exists
+	// and doesn't panic with different inputs
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("exitBasedOnIgnoreFailures() panicked: %v", r)
+		}
+	}()
+
+	// Test with ignore failures true - would call os.Exit(0)
+	// Test with ignore failures false - would call os.Exit(1)
+	// We can't actually test the exit codes without subprocess testing
+	// but we can ensure the function doesn't panic
+
+	// Note: We can't actually call this function in tests because it will exit
+	// the test process. In a real scenario, you might use dependency injection
+	// or a wrapper function to make this testable.
+}
+
+func TestFailureExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   int
+	}{
+		{name: "default", config: Config{OnFailureExitCode: defaultFailureExitCode}, want: 1},
+		{name: "custom code", config: Config{OnFailureExitCode: 75}, want: 75},
+		{name: "ignore failures wins", config: Config{OnFailureExitCode: 75, IgnoreFailures: true}, want: 0},
+		{name: "out of range falls back", config: Config{OnFailureExitCode: 300}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureExitCode(tt.config); got != tt.want {
+				t.Errorf("failureExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMainExitCode runs main in a subprocess, since it ends with os.Exit.
+func TestMainExitCode(t *testing.T) {
+	if args := os.Getenv("TESTNOD_TEST_MAIN_ARGS"); args != "" {
+		os.Args = append([]string{"testnod-uploader"}, strings.Fields(args)...)
+		main()
+		return
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want int
+	}{
+		{name: "success", args: "-validate ../../testdata/valid_junit.xml", want: 0},
+		{name: "default failure code", args: "-validate ../../testdata/invalid_no_testsuite.xml", want: 1},
+		{name: "custom failure code", args: "-validate -on-failure-exit-code 75 ../../testdata/invalid_no_testsuite.xml", want: 75},
+		{name: "ignore failures wins", args: "-validate -on-failure-exit-code 75 -ignore-failures ../../testdata/invalid_no_testsuite.xml", want: 0},
+		{name: "custom code for flag errors", args: "-on-failure-exit-code 75 ../../testdata/valid_junit.xml", want: 75},
+		{name: "out of range code", args: "-validate -on-failure-exit-code 256 ../../testdata/valid_junit.xml", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestMainExitCode$")
+			cmd.Env = append(os.Environ(), "TESTNOD_TEST_MAIN_ARGS="+tt.args)
+			output, _ := cmd.CombinedOutput()
+
+			if got := cmd.ProcessState.ExitCode(); got != tt.want {
+				t.Errorf("exit code = %d, want %d\noutput:\n%s", got, tt.want, output)
+			}
+		})
+	}
+}
+
+func TestPrintURLOnly(t *testing.T) {
+	server := newFakeTestNod(t)
+
+	run := func(args string) (stdout, stderr string, exitCode int) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMainExitCode$")
+		cmd.Env = append(os.Environ(), "TESTNOD_BASE_URL="+server.URL, "TESTNOD_TEST_MAIN_ARGS="+args)
+		var out, errOut bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &errOut
+		cmd.Run()
+		return out.String(), errOut.String(), cmd.ProcessState.ExitCode()
+	}
+
+	t.Run("success", func(t *testing.T) {
+		stdout, stderr, code := run("-print-url-only -token t -build-id 1 ../../testdata/valid_junit.xml")
+		if code != 0 {
+			t.Fatalf("exit code = %d, want 0\nstderr:\n%s", code, stderr)
+		}
+		if stdout != "https://testnod.example/runs/1\n" {
+			t.Errorf("stdout = %q, want only the test run URL", stdout)
+		}
+		if !strings.Contains(stderr, "Test run uploaded successfully") || !strings.Contains(stderr, "1 file, 1 uploaded") {
+			t.Errorf("stderr = %q, want the progress messages and summary", stderr)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		stdout, stderr, code := run("-print-url-only -token t -build-id 1 ../../testdata/invalid_no_testsuite.xml")
+		if code == 0 {
+			t.Errorf("exit code = 0, want a failure")
+		}
+		if stdout != "" {
+			t.Errorf("stdout = %q, want nothing", stdout)
+		}
+		if !strings.Contains(stderr, "File validation failed") {
+			t.Errorf("stderr = %q, want the validation error", stderr)
+		}
+	})
+
+	t.Run("validate only", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-print-url-only", "../../testdata/valid_junit.xml"}
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-print-url-only only works when creating test runs") {
+			t.Errorf("parseFlags() error = %v, want a mode error", err)
+		}
+	})
 }
 
 func TestValidateOnly(t *testing.T) {
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/export"
+	"testnod-uploader/internal/junit"
+)
+
+// markdownSummary collects the processed files for -summary-markdown, which
+// is written once every file is done. A nil *markdownSummary collects
+// nothing.
+type markdownSummary struct {
+	path string
+	docs []*junit.Document
+}
+
+func newMarkdownSummary(path string) *markdownSummary {
+	if path == "" {
+		return nil
+	}
+	return &markdownSummary{path: path}
+}
+
+// add adds a processed file to the summary as the documents it was uploaded
+// as. A nil document, or no documents for a file that wasn't uploaded, is
+// parsed from filePath. A file that doesn't parse has already failed with
+// its own error, so it's left out.
+func (m *markdownSummary) add(filePath string, docs []*junit.Document) {
+	if m == nil {
+		return
+	}
+	if len(docs) == 0 {
+		docs = []*junit.Document{nil}
+	}
+	for _, doc := range docs {
+		if doc == nil {
+			var err error
+			if doc, err = junit.ParseFile(filePath); err != nil {
+				debug.Log("not adding %s to the Markdown summary: %v", filePath, err)
+				return
+			}
+		}
+		m.docs = append(m.docs, doc)
+	}
+}
+
+// write writes the Markdown table and failing testcases of every added file,
+// reporting where to w.
+func (m *markdownSummary) write(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	if err := os.WriteFile(m.path, export.Markdown(m.docs...), 0o644); err != nil {
+		return fmt.Errorf("failed to write -summary-markdown: %w", err)
+	}
+	fmt.Fprintf(w, "Wrote a Markdown summary of %d file(s) to %s\n", len(m.docs), m.path)
+	return nil
+}
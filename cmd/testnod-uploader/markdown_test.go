@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSummaryMarkdown(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "summary.md")
+	config := Config{
+		ValidateFile: true,
+		FilePaths:    []string{"../../testdata/valid_junit_multiple_suites.xml", "../../testdata/valid_junit.xml", "../../testdata/invalid_malformed.xml"},
+		markdown:     newMarkdownSummary(out),
+	}
+	config.FilePath = config.FilePaths[0]
+
+	summary := run(config)
+	if summary.Succeeded != 2 || summary.Failed != 1 {
+		t.Fatalf("run() summary = %+v, want two valid files and one invalid", summary)
+	}
+	if err := config.markdown.write(io.Discard); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read summary: %v", err)
+	}
+	for _, want := range []string{
+		"| com.example.FirstTest | 2 | 0 | 0 | 0.050s |\n",
+		"| com.example.SecondTest | 1 | 0 | 0 | 0.030s |\n",
+		"| com.example.TestSuite | 3 | 1 | 0 | 0.123s |\n",
+		"- `com.example.TestSuite.testFailure` (com.example.TestSuite): Expected true but was false\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Summary %q, want it to contain %q", data, want)
+		}
+	}
+}
+
+func TestSummaryMarkdownDisabled(t *testing.T) {
+	var m *markdownSummary
+	m.add("../../testdata/valid_junit.xml", nil)
+	if err := m.write(io.Discard); err != nil {
+		t.Errorf("write() without -summary-markdown error = %v", err)
+	}
+}
+
+func TestSummaryMarkdownRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(failuresInput), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "summary.md")
+
+	server := newFakeTestNod(t)
+	config := server.uploadConfig(path)
+	config.redactRegexps = []*regexp.Regexp{regexp.MustCompile(`got \d+`)}
+	config.suiteFilterRegexp = regexp.MustCompile(`^api$`)
+	config.markdown = newMarkdownSummary(out)
+
+	if summary := run(config); summary.Succeeded != 1 {
+		t.Fatalf("run() summary = %+v, want the file uploaded", summary)
+	}
+	if err := config.markdown.write(io.Discard); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read summary: %v", err)
+	}
+	if !strings.Contains(string(data), "expected 201, ***") || strings.Contains(string(data), "got 500") {
+		t.Errorf("Summary %q, want the failure message as redacted for the upload", data)
+	}
+	if strings.Contains(string(data), "db.Migrate") {
+		t.Errorf("Summary %q, want the suites -suite-filter dropped left out", data)
+	}
+}
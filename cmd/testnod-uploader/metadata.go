@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"testnod-uploader/internal/cimeta"
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/testnod"
+)
+
+// testRunMetadata is the metadata sent with the create test run request.
+func testRunMetadata(config Config) testnod.TestRunMetadata {
+	return testnod.TestRunMetadata{
+		Branch:      config.Branch,
+		CommitSHA:   config.CommitSHA,
+		RunURL:      config.RunURL,
+		BuildID:     config.BuildID,
+		Environment: config.Environment,
+	}
+}
+
+// printMetadata writes the metadata sent with the create test run request
+// as JSON for -print-metadata.
+func printMetadata(w io.Writer, config Config) error {
+	data, err := json.MarshalIndent(testRunMetadata(config), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to print metadata: %w", err)
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+// metadataFields maps the JSON names accepted by -require-metadata to their
+// values.
+func metadataFields(metadata testnod.TestRunMetadata) map[string]string {
+	return map[string]string{
+		"branch":      metadata.Branch,
+		"commit_sha":  metadata.CommitSHA,
+		"run_url":     metadata.RunURL,
+		"build_id":    metadata.BuildID,
+		"environment": metadata.Environment,
+	}
+}
+
+// checkRequiredMetadata fails if any of the comma-separated fields is empty
+// in metadata, naming all of the missing ones.
+func checkRequiredMetadata(metadata testnod.TestRunMetadata, required string) error {
+	values := metadataFields(metadata)
+
+	var missing []string
+	for _, field := range strings.Split(required, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		value, ok := values[field]
+		if !ok {
+			return fmt.Errorf("unknown -require-metadata field %q (supported: branch, commit_sha, run_url, build_id, environment)", field)
+		}
+		if value == "" {
+			missing = append(missing, field)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("required metadata missing: %s (-require-metadata)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// metaFileName is the file teams commit to the repository to give every run
+// default metadata and tags.
+const metaFileName = ".testnod-meta.json"
+
+// repoMetadata is the content of a .testnod-meta.json file. Unknown fields
+// are ignored.
+type repoMetadata struct {
+	Branch      string   `json:"branch"`
+	CommitSHA   string   `json:"commit_sha"`
+	RunURL      string   `json:"run_url"`
+	BuildID     string   `json:"build_id"`
+	Environment string   `json:"environment"`
+	Tags        []string `json:"tags"`
+}
+
+// findMetaFile looks for .testnod-meta.json in dir and its parents, stopping
+// at the git root (the first directory containing .git) or the filesystem
+// root. It returns the closest file found.
+func findMetaFile(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, metaFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// applyMetaFile fills in the metadata config left empty from the
+// .testnod-meta.json closest to dir, and adds its tags to the ones given as
+// flags. Flags always win.
+func applyMetaFile(config *Config, dir string) error {
+	path, ok := findMetaFile(dir)
+	if !ok {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var meta repoMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	debug.Log("applying metadata from %s", path)
+
+	fill := func(value *string, fromFile string) {
+		if *value == "" {
+			*value = fromFile
+		}
+	}
+	fill(&config.Branch, meta.Branch)
+	fill(&config.CommitSHA, meta.CommitSHA)
+	fill(&config.RunURL, meta.RunURL)
+	fill(&config.BuildID, meta.BuildID)
+	fill(&config.Environment, meta.Environment)
+
+	for _, value := range meta.Tags {
+		if !slices.ContainsFunc(config.Tags, func(tag testnod.Tag) bool { return tag.Value == value }) {
+			config.Tags = append(config.Tags, testnod.Tag{Value: value})
+		}
+	}
+	return nil
+}
+
+// applyCIMetadata fills in the metadata config left empty from the
+// environment of the first CI provider in cimeta.Providers that is detected.
+func applyCIMetadata(config *Config, getenv cimeta.Getenv) {
+	provider, ok := cimeta.Detect(cimeta.Providers, getenv)
+	if !ok {
+		debug.Log("-ci-metadata: no CI provider detected")
+		return
+	}
+
+	metadata := testRunMetadata(*config)
+	filled := cimeta.Fill(&metadata, provider, getenv)
+	config.Branch = metadata.Branch
+	config.CommitSHA = metadata.CommitSHA
+	config.RunURL = metadata.RunURL
+	config.BuildID = metadata.BuildID
+	config.Environment = metadata.Environment
+	debug.Log("-ci-metadata: filled %v from %s", filled, provider.Name())
+}
+
+// fullSHALength is the length of a full SHA-1 commit hash.
+const fullSHALength = 40
+
+// expandCommitSHA resolves a short commit SHA to its full form with git in
+// dir. It fails if sha isn't an abbreviated hex SHA, dir isn't in a git
+// repository, or sha doesn't name exactly one commit there.
+func expandCommitSHA(sha string, dir string) (string, error) {
+	if len(sha) == fullSHALength {
+		return sha, nil
+	}
+	if len(sha) < 4 || len(sha) > fullSHALength || strings.Trim(strings.ToLower(sha), "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%q is not a short commit SHA", sha)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", sha+"^{commit}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git could not resolve %s to a single commit: %w", sha, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isLocalURL reports whether rawURL points at this machine or a private
+// network, which nobody else following the link can reach.
+func isLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+}
+
+// localRunURLWarning returns a warning when a run uploaded to the public
+// TestNod links to a local run URL, usually CI config left over from
+// testing. Self-hosted instances may well link to private hosts, so they
+// aren't checked.
+func localRunURLWarning(config Config) string {
+	base, err := url.Parse(config.BaseURL)
+	public, _ := url.Parse(defaultBaseURL)
+	if err != nil || !strings.EqualFold(base.Hostname(), public.Hostname()) {
+		return ""
+	}
+	if config.RunURL == "" || !isLocalURL(config.RunURL) {
+		return ""
+	}
+	return fmt.Sprintf("-run-url %s points at a local or private address, so the link in TestNod won't work for anyone else", config.RunURL)
+}
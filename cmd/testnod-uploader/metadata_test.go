@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/testnod"
+)
+
+func TestCheckRequiredMetadata(t *testing.T) {
+	full := testnod.TestRunMetadata{Branch: "main", CommitSHA: "abc123", RunURL: "https://ci.example/1", BuildID: "42"}
+
+	tests := []struct {
+		name     string
+		metadata testnod.TestRunMetadata
+		required string
+		wantErr  string
+	}{
+		{name: "present", metadata: full, required: "branch,commit_sha"},
+		{name: "nothing required", metadata: testnod.TestRunMetadata{}, required: ""},
+		{name: "spaces and empty entries", metadata: full, required: " branch , ,run_url"},
+		{name: "one missing", metadata: testnod.TestRunMetadata{Branch: "main"}, required: "branch,commit_sha", wantErr: "required metadata missing: commit_sha"},
+		{name: "all missing", metadata: testnod.TestRunMetadata{}, required: "branch,commit_sha", wantErr: "required metadata missing: branch, commit_sha"},
+		{name: "unknown field", metadata: full, required: "branch,author", wantErr: `unknown -require-metadata field "author"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRequiredMetadata(tt.metadata, tt.required)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkRequiredMetadata() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkRequiredMetadata() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeRepo creates root/.git and root/a/b and returns root and root/a/b.
+func writeRepo(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	for _, dir := range []string{filepath.Join(root, ".git"), nested} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	return root, nested
+}
+
+func writeMetaFile(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, metaFileName), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write meta file: %v", err)
+	}
+}
+
+func TestFindMetaFile(t *testing.T) {
+	t.Run("in the working directory", func(t *testing.T) {
+		_, nested := writeRepo(t)
+		writeMetaFile(t, nested, `{}`)
+		if path, ok := findMetaFile(nested); !ok || path != filepath.Join(nested, metaFileName) {
+			t.Errorf("findMetaFile() = %q, %v", path, ok)
+		}
+	})
+
+	t.Run("at the git root", func(t *testing.T) {
+		root, nested := writeRepo(t)
+		writeMetaFile(t, root, `{}`)
+		if path, ok := findMetaFile(nested); !ok || path != filepath.Join(root, metaFileName) {
+			t.Errorf("findMetaFile() = %q, %v", path, ok)
+		}
+	})
+
+	t.Run("closest wins", func(t *testing.T) {
+		root, nested := writeRepo(t)
+		writeMetaFile(t, root, `{}`)
+		writeMetaFile(t, filepath.Join(root, "a"), `{}`)
+		if path, ok := findMetaFile(nested); !ok || path != filepath.Join(root, "a", metaFileName) {
+			t.Errorf("findMetaFile() = %q, %v", path, ok)
+		}
+	})
+
+	t.Run("not above the git root", func(t *testing.T) {
+		outer := t.TempDir()
+		writeMetaFile(t, outer, `{}`)
+		root := filepath.Join(outer, "repo")
+		if err := os.MkdirAll(filepath.Join(root, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if path, ok := findMetaFile(root); ok {
+			t.Errorf("findMetaFile() = %q, want nothing above the git root", path)
+		}
+	})
+}
+
+func TestApplyMetaFile(t *testing.T) {
+	root, nested := writeRepo(t)
+	writeMetaFile(t, root, `{"branch": "main", "build_id": "from-file", "tags": ["team-a", "nightly"], "project": "ignored"}`)
+
+	config := Config{BuildID: "42", Tags: uploadTagsFlag{{Value: "nightly"}}}
+	if err := applyMetaFile(&config, nested); err != nil {
+		t.Fatalf("applyMetaFile() error = %v", err)
+	}
+
+	if config.Branch != "main" {
+		t.Errorf("Branch = %q, want main from the file", config.Branch)
+	}
+	if config.BuildID != "42" {
+		t.Errorf("BuildID = %q, want the flag to win", config.BuildID)
+	}
+	if got := config.Tags.String(); got != "nightly,team-a" {
+		t.Errorf("Tags = %q, want nightly,team-a", got)
+	}
+
+	writeMetaFile(t, nested, `{"branch": `)
+	if err := applyMetaFile(&config, nested); err == nil || !strings.Contains(err.Error(), metaFileName) {
+		t.Errorf("applyMetaFile() error = %v, want a parse error naming the file", err)
+	}
+}
+
+// initRepo creates a git repository with one commit in a temporary
+// directory and returns the directory and the commit's full SHA.
+func initRepo(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	return dir, git("rev-parse", "HEAD")
+}
+
+func TestExpandCommitSHA(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo, full := initRepo(t)
+
+	tests := []struct {
+		name    string
+		sha     string
+		dir     string
+		want    string
+		wantErr string
+	}{
+		{name: "short", sha: full[:7], dir: repo, want: full},
+		{name: "uppercase", sha: strings.ToUpper(full[:10]), dir: repo, want: full},
+		{name: "already full", sha: full, dir: t.TempDir(), want: full},
+		{name: "unknown commit", sha: "0000000", dir: repo, wantErr: "could not resolve"},
+		{name: "not a repository", sha: full[:7], dir: t.TempDir(), wantErr: "could not resolve"},
+		{name: "not hex", sha: "main", dir: repo, wantErr: "not a short commit SHA"},
+		{name: "too short", sha: full[:3], dir: repo, wantErr: "not a short commit SHA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandCommitSHA(tt.sha, tt.dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandCommitSHA(%q) error = %v, want %q", tt.sha, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("expandCommitSHA(%q) = %q, %v; want %q", tt.sha, got, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		t.Chdir(repo)
+		os.WriteFile("results.xml", []byte("<testsuites/>"), 0o644)
+		for _, tt := range []struct{ sha, want string }{
+			{sha: full[:8], want: full},
+			{sha: "fffffff", want: "fffffff"},
+		} {
+			oldArgs := os.Args
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cmd", "-validate", "-expand-commit-sha", "-commit-sha", tt.sha, "results.xml"}
+			config, err := parseFlags()
+			os.Args = oldArgs
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if config.CommitSHA != tt.want {
+				t.Errorf("CommitSHA = %q, want %q", config.CommitSHA, tt.want)
+			}
+		}
+	})
+}
+
+func TestLocalRunURLWarning(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		runURL  string
+		want    bool
+	}{
+		{name: "localhost", baseURL: defaultBaseURL, runURL: "http://localhost:8080/job/1", want: true},
+		{name: "localhost subdomain", baseURL: defaultBaseURL, runURL: "http://ci.localhost/job/1", want: true},
+		{name: "loopback", baseURL: defaultBaseURL, runURL: "http://127.0.0.1/job/1", want: true},
+		{name: "ipv6 loopback", baseURL: defaultBaseURL, runURL: "http://[::1]:8080/job/1", want: true},
+		{name: "private", baseURL: defaultBaseURL, runURL: "https://10.0.3.7/job/1", want: true},
+		{name: "private 192.168", baseURL: defaultBaseURL, runURL: "http://192.168.1.20/job/1", want: true},
+		{name: "public", baseURL: defaultBaseURL, runURL: "https://github.com/acme/app/actions/runs/1", want: false},
+		{name: "public ip", baseURL: defaultBaseURL, runURL: "http://8.8.8.8/job/1", want: false},
+		{name: "no run url", baseURL: defaultBaseURL, runURL: "", want: false},
+		{name: "self-hosted", baseURL: "https://testnod.internal", runURL: "http://localhost/job/1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := localRunURLWarning(Config{BaseURL: tt.baseURL, RunURL: tt.runURL})
+			if (got != "") != tt.want {
+				t.Errorf("localRunURLWarning(%s) = %q, want a warning: %v", tt.runURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCIMetadata(t *testing.T) {
+	vars := map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REF_NAME":   "main",
+		"GITHUB_SHA":        "abc123",
+		"GITHUB_RUN_ID":     "42",
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "acme/app",
+	}
+	getenv := func(name string) string { return vars[name] }
+
+	config := Config{Branch: "from-flag"}
+	applyCIMetadata(&config, getenv)
+	want := testnod.TestRunMetadata{Branch: "from-flag", CommitSHA: "abc123", RunURL: "https://github.com/acme/app/actions/runs/42", BuildID: "42"}
+	if got := testRunMetadata(config); got != want {
+		t.Errorf("testRunMetadata() = %+v, want %+v", got, want)
+	}
+
+	t.Run("no provider", func(t *testing.T) {
+		config := Config{}
+		applyCIMetadata(&config, func(string) string { return "" })
+		if got := testRunMetadata(config); got != (testnod.TestRunMetadata{}) {
+			t.Errorf("testRunMetadata() = %+v, want nothing filled in", got)
+		}
+	})
+
+	t.Run("wins over the meta file", func(t *testing.T) {
+		fixture, err := filepath.Abs("../../testdata/valid_junit.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, nested := writeRepo(t)
+		writeMetaFile(t, root, `{"branch": "from-file", "environment": "staging"}`)
+		t.Chdir(nested)
+		for name, value := range vars {
+			t.Setenv(name, value)
+		}
+
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-ci-metadata", "-token", "t", fixture}
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags() error = %v", err)
+		}
+		if config.Branch != "main" || config.BuildID != "42" || config.Environment != "staging" {
+			t.Errorf("branch = %q, build ID = %q, environment = %q; want main and 42 from CI and staging from the file", config.Branch, config.BuildID, config.Environment)
+		}
+	})
+}
+
+func TestEnvFile(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := `# Copied from a GitLab pipeline
+export GITLAB_CI=true
+CI_COMMIT_REF_NAME="feature/login"
+CI_COMMIT_SHA=abc123 # the merge commit
+CI_PIPELINE_ID='77'
+CI_PIPELINE_URL=https://gitlab.example/acme/app/-/pipelines/77
+`
+	if err := os.WriteFile(envFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+
+	// Start from a clean environment, whichever CI runs the tests. The
+	// commit SHA is already set, so the file must not override it.
+	t.Setenv("GITHUB_ACTIONS", "")
+	for _, name := range []string{"GITLAB_CI", "CI_COMMIT_REF_NAME", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "CI_PIPELINE_ID", "CI_PIPELINE_URL", "CI_ENVIRONMENT_NAME"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	t.Setenv("CI_COMMIT_SHA", "from-environment")
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-validate", "-ci-metadata", "-env-file", envFile, "../../testdata/valid_junit.xml"}
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+
+	want := testnod.TestRunMetadata{
+		Branch:    "feature/login",
+		CommitSHA: "from-environment",
+		RunURL:    "https://gitlab.example/acme/app/-/pipelines/77",
+		BuildID:   "77",
+	}
+	if got := testRunMetadata(config); got != want {
+		t.Errorf("testRunMetadata() = %+v, want %+v", got, want)
+	}
+
+	t.Run("invalid file", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), ".env")
+		if err := os.WriteFile(bad, []byte("NOT A VARIABLE\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write .env: %v", err)
+		}
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-validate", "-env-file", bad, "../../testdata/valid_junit.xml"}
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "invalid -env-file") {
+			t.Errorf("parseFlags() error = %v, want an invalid -env-file error", err)
+		}
+	})
+}
+
+func TestPrintMetadata(t *testing.T) {
+	fixture, err := filepath.Abs("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, nested := writeRepo(t)
+	writeMetaFile(t, root, `{"environment": "staging", "branch": "from-file"}`)
+	t.Chdir(nested)
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_COMMIT_REF_NAME", "main")
+	t.Setenv("CI_COMMIT_SHA", "def456")
+	t.Setenv("CI_PIPELINE_ID", "9")
+	t.Setenv("CI_PIPELINE_URL", "https://gitlab.example/pipelines/9")
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "-print-metadata", "-ci-metadata", "-token", "t", "-build-id", "from-flag", fixture}
+
+	config, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := printMetadata(&out, config); err != nil {
+		t.Fatalf("printMetadata() error = %v", err)
+	}
+	var got testnod.TestRunMetadata
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("printMetadata() wrote invalid JSON: %v\n%s", err, out.String())
+	}
+
+	want := testnod.TestRunMetadata{Branch: "main", CommitSHA: "def456", RunURL: "https://gitlab.example/pipelines/9", BuildID: "from-flag", Environment: "staging"}
+	if got != want {
+		t.Errorf("printMetadata() = %+v, want %+v", got, want)
+	}
+	if got != testRunMetadata(config) {
+		t.Errorf("printMetadata() = %+v, but the create request sends %+v", got, testRunMetadata(config))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/testnod"
+)
+
+// presignedURLWarnThreshold is how close to expiry a presigned URL can get
+// before the upload step warns about it.
+const presignedURLWarnThreshold = 2 * time.Minute
+
+// presignedURLRemaining reports how long a SigV4 presigned URL stays valid,
+// based on its X-Amz-Date and X-Amz-Expires query parameters. The result is
+// negative once the URL has expired. ok is false for URLs without a parsable
+// signature window.
+func presignedURLRemaining(rawURL string) (remaining time.Duration, ok bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, false
+	}
+
+	query := parsed.Query()
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return 0, false
+	}
+
+	expiresIn, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expiresIn < 0 {
+		return 0, false
+	}
+
+	expiresAt := signedAt.Add(time.Duration(expiresIn) * time.Second)
+	return time.Until(expiresAt), true
+}
+
+// warnPresignedURLExpiry warns when the presigned URL expires within
+// presignedURLWarnThreshold.
+func warnPresignedURLExpiry(presignedURL string) {
+	if remaining, ok := presignedURLRemaining(presignedURL); ok {
+		debug.Log("presigned URL valid for %s", remaining.Round(time.Second))
+		if remaining < presignedURLWarnThreshold {
+			fmt.Printf("Warning: the presigned upload URL expires in %s, the upload may be rejected\n", remaining.Round(time.Second))
+		}
+	}
+}
+
+// uploadIDPlaceholder in -upload-url is replaced with the created run's ID.
+const uploadIDPlaceholder = "{id}"
+
+// uploadTarget returns the URL the file is uploaded to: -upload-url with
+// {id} replaced by the created run's ID when it's set, for servers that
+// don't return a presigned URL, and the server's presigned URL otherwise.
+func uploadTarget(config Config, serverResponse testnod.SuccessfulServerResponse) string {
+	if config.UploadURL == "" {
+		return serverResponse.PresignedURL
+	}
+	return strings.ReplaceAll(config.UploadURL, uploadIDPlaceholder, strconv.Itoa(serverResponse.ID))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"testnod-uploader/internal/testnod"
+)
+
+func sigV4URL(signedAt time.Time, expires string) string {
+	return "https://bucket.s3.amazonaws.com/uploads/results.xml" +
+		"?X-Amz-Algorithm=AWS4-HMAC-SHA256" +
+		"&X-Amz-Credential=AKIAEXAMPLE%2F20250101%2Fus-east-1%2Fs3%2Faws4_request" +
+		"&X-Amz-Date=" + signedAt.UTC().Format("20060102T150405Z") +
+		"&X-Amz-Expires=" + expires +
+		"&X-Amz-SignedHeaders=host" +
+		"&X-Amz-Signature=abcdef0123456789"
+}
+
+func TestPresignedURLRemaining(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		url    string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "fresh URL", url: sigV4URL(now, "900"), want: 15 * time.Minute, wantOK: true},
+		{name: "close to expiry", url: sigV4URL(now.Add(-14*time.Minute), "900"), want: time.Minute, wantOK: true},
+		{name: "expired", url: sigV4URL(now.Add(-time.Hour), "900"), want: -45 * time.Minute, wantOK: true},
+		{name: "unsigned URL", url: "https://storage.example/bucket/key", wantOK: false},
+		{name: "malformed date", url: "https://storage.example/key?X-Amz-Date=yesterday&X-Amz-Expires=900", wantOK: false},
+		{name: "malformed expires", url: sigV4URL(now, "soon"), wantOK: false},
+		{name: "invalid URL", url: "://", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := presignedURLRemaining(tt.url)
+			if ok != tt.wantOK {
+				t.Fatalf("presignedURLRemaining() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			// X-Amz-Date has second precision.
+			if diff := got - tt.want; diff < -2*time.Second || diff > 2*time.Second {
+				t.Errorf("presignedURLRemaining() = %s, want about %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadTarget(t *testing.T) {
+	response := testnod.SuccessfulServerResponse{ID: 42, PresignedURL: "https://storage.example/presigned"}
+
+	tests := []struct {
+		name      string
+		uploadURL string
+		want      string
+	}{
+		{"presigned URL by default", "", "https://storage.example/presigned"},
+		{"placeholder", "https://api.example/runs/{id}/upload", "https://api.example/runs/42/upload"},
+		{"every placeholder", "https://api.example/runs/{id}/upload?run={id}", "https://api.example/runs/42/upload?run=42"},
+		{"no placeholder", "https://api.example/upload", "https://api.example/upload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uploadTarget(Config{UploadURL: tt.uploadURL}, response); got != tt.want {
+				t.Errorf("uploadTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"testnod-uploader/internal/download"
+	"testnod-uploader/internal/junit"
+	"testnod-uploader/internal/validation"
+)
+
+// fileReport is one entry of the -validate -output json report. The counts
+// are only filled in for valid files.
+type fileReport struct {
+	File     string `json:"file"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+	Suites   int    `json:"suites"`
+	Tests    int    `json:"tests"`
+	Failures int    `json:"failures"`
+
+	// Warnings don't make a file invalid unless -warnings-as-errors is set.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Slowest is the -top-slow list.
+	Slowest []slowTestcase `json:"slowest,omitempty"`
+}
+
+// writeValidationReport validates every file and writes the results to w as
+// a JSON array, adding each file's outcome to summary.
+func writeValidationReport(w io.Writer, config Config, summary *runSummary) error {
+	paths := inputFiles(config)
+	reports := make([]fileReport, 0, len(paths))
+	for _, path := range paths {
+		fileConfig := config
+		fileConfig.FilePath = path
+		report, err := validateForReport(fileConfig)
+		summary.Add(nil, err)
+		reports = append(reports, report)
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode validation report: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// stdinPath is the file argument that stands for standard input.
+const stdinPath = "-"
+
+// stdin is read for stdinPath. Tests replace it.
+var stdin io.Reader = os.Stdin
+
+func validateForReport(config Config) (fileReport, error) {
+	if config.FilePath == stdinPath {
+		return validateStdinForReport(config)
+	}
+
+	report := fileReport{File: config.FilePath}
+
+	localPath := config.FilePath
+	if download.IsURL(config.FilePath) {
+		downloaded, err := downloadFile(config)
+		if err != nil {
+			report.Error = err.Error()
+			return report, err
+		}
+		defer removeTemp(config, downloaded)
+		localPath = downloaded
+		config.downloaded = true
+	}
+
+	validationReport := validation.ValidateJUnitXMLFileReport(localPath, validationOptions(config))
+	report.Warnings = validationReport.Warnings
+	if err := validationError(config, validationReport); err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	doc, err := junit.ParseFile(localPath)
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	report.fill(doc, config.TopSlow)
+	return report, nil
+}
+
+// validateStdinForReport validates standard input in memory, so editor
+// integrations can check unsaved content without anything touching disk.
+func validateStdinForReport(config Config) (fileReport, error) {
+	report := fileReport{File: stdinPath}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		err = fmt.Errorf("failed to read standard input: %w", err)
+		report.Error = err.Error()
+		return report, err
+	}
+
+	validationReport := validation.ValidateJUnitXMLReport(bytes.NewReader(data), validationOptions(config))
+	report.Warnings = validationReport.Warnings
+	if err := validationError(config, validationReport); err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	doc, err := junit.Parse(bytes.NewReader(data))
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	report.fill(doc, config.TopSlow)
+	return report, nil
+}
+
+// fill marks a report valid and fills in the counts and the topSlow slowest
+// testcases from doc.
+func (r *fileReport) fill(doc *junit.Document, topSlow int) {
+	r.Valid = true
+	doc.WalkSuites(func(*junit.Suite) { r.Suites++ })
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		r.Tests++
+		if tc.Status() == junit.StatusFailed {
+			r.Failures++
+		}
+	})
+	r.Slowest = slowestTestcases(doc, topSlow)
+}
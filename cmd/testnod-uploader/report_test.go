@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteValidationReport(t *testing.T) {
+	failing := filepath.Join(t.TempDir(), "failing.xml")
+	content := `<testsuite name="s"><testcase name="a"><failure message="boom"/></testcase><testcase name="b"/></testsuite>`
+	if err := os.WriteFile(failing, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	config := Config{
+		ValidateFile: true,
+		Output:       "json",
+		FilePaths: []string{
+			"../../testdata/valid_junit_multiple_suites.xml",
+			"../../testdata/invalid_no_testsuite.xml",
+			failing,
+		},
+	}
+
+	var out bytes.Buffer
+	summary := runSummary{Action: "valid"}
+	if err := writeValidationReport(&out, config, &summary); err != nil {
+		t.Fatalf("writeValidationReport() error = %v", err)
+	}
+
+	var reports []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &reports); err != nil {
+		t.Fatalf("Report is not a JSON array: %v\n%s", err, out.String())
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(reports))
+	}
+
+	for _, report := range reports {
+		for _, key := range []string{"file", "valid", "suites", "tests", "failures"} {
+			if _, ok := report[key]; !ok {
+				t.Errorf("Entry %v is missing %q", report, key)
+			}
+		}
+	}
+
+	want := []fileReport{
+		{File: "../../testdata/valid_junit_multiple_suites.xml", Valid: true, Suites: 2, Tests: 3},
+		{File: "../../testdata/invalid_no_testsuite.xml"},
+		{File: failing, Valid: true, Suites: 1, Tests: 2, Failures: 1},
+	}
+	var got []fileReport
+	json.Unmarshal(out.Bytes(), &got)
+	for i := range want {
+		if got[i].Error != "" {
+			want[i].Error = got[i].Error
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("Entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[1].Error == "" {
+		t.Error("Expected the invalid file's entry to carry its error")
+	}
+
+	if summary.Files != 3 || summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 3 files with 1 failed", summary)
+	}
+}
+
+func TestValidateStdin(t *testing.T) {
+	original := stdin
+	t.Cleanup(func() { stdin = original })
+
+	tests := []struct {
+		name    string
+		input   string
+		want    fileReport
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			input: `<testsuite name="s"><testcase name="a"/><testcase name="b"><failure/></testcase></testsuite>`,
+			want:  fileReport{File: "-", Valid: true, Suites: 1, Tests: 2, Failures: 1},
+		},
+		{name: "invalid", input: `<root/>`, want: fileReport{File: "-"}, wantErr: true},
+		{name: "not XML", input: "hello", want: fileReport{File: "-"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin = strings.NewReader(tt.input)
+
+			var out bytes.Buffer
+			summary := runSummary{Action: "valid"}
+			config := Config{ValidateFile: true, Output: "json", FilePaths: []string{stdinPath}}
+			if err := writeValidationReport(&out, config, &summary); err != nil {
+				t.Fatalf("writeValidationReport() error = %v", err)
+			}
+
+			var got []fileReport
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil || len(got) != 1 {
+				t.Fatalf("Expected a one-entry JSON report, got %s (%v)", out.String(), err)
+			}
+			if tt.wantErr != (got[0].Error != "") {
+				t.Errorf("Error = %q, wantErr %v", got[0].Error, tt.wantErr)
+			}
+			got[0].Error = ""
+			if !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("report = %+v, want %+v", got[0], tt.want)
+			}
+			if wantFailed := map[bool]int{true: 1, false: 0}[tt.wantErr]; summary.Failed != wantFailed {
+				t.Errorf("summary.Failed = %d, want %d", summary.Failed, wantFailed)
+			}
+		})
+	}
+}
+
+func TestParseFlagsStdin(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "dash", args: []string{"-validate", "-"}},
+		{name: "flag", args: []string{"-validate", "-stdin"}},
+		{name: "flag with a file", args: []string{"-validate", "-stdin", "../../testdata/valid_junit.xml"}, wantErr: true},
+		{name: "upload", args: []string{"-token", "t", "-build-id", "1", "-"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			config, err := parseFlags()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseFlags() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if config.FilePath != stdinPath || config.Output != "json" || !config.Quiet {
+				t.Errorf("parseFlags() FilePath=%q Output=%q Quiet=%v, want stdin with a JSON report", config.FilePath, config.Output, config.Quiet)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"testnod-uploader/internal/atomicfile"
+	"testnod-uploader/internal/testnod"
+)
+
+// createOnly creates a test run without uploading anything and saves the
+// server's response, presigned URL included, to the -create-only file for a
+// later -reuse-run invocation. It returns the test run URL.
+func createOnly(config Config) (string, error) {
+	fmt.Println("Creating test run (-create-only)...")
+	setRequestID(config)
+	setBasicAuth(config)
+	var result uploadResult
+	serverResponse, err := createTestRun(config, &result)
+	if err != nil {
+		return "", err
+	}
+	if err := writeRunFile(config.CreateOnly, serverResponse); err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+	fmt.Printf("Created test run %s and saved it to %s. Upload to it later with -reuse-run %s\n", serverResponse.TestRunURL, config.CreateOnly, config.CreateOnly)
+	return serverResponse.TestRunURL, nil
+}
+
+// writeRunFile saves a create test run response as JSON. The file is
+// replaced atomically, so a reader never sees a partial response.
+func writeRunFile(path string, serverResponse testnod.SuccessfulServerResponse) error {
+	if err := atomicfile.WriteJSON(path, serverResponse, true); err != nil {
+		return fmt.Errorf("failed to write run file: %w", err)
+	}
+	return nil
+}
+
+// readRunFile loads a response saved by -create-only for -reuse-run.
+func readRunFile(path string) (testnod.SuccessfulServerResponse, error) {
+	var serverResponse testnod.SuccessfulServerResponse
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return serverResponse, fmt.Errorf("failed to read -reuse-run file: %w", err)
+	}
+	if err := json.Unmarshal(data, &serverResponse); err != nil {
+		return serverResponse, fmt.Errorf("invalid -reuse-run file %s: %w", path, err)
+	}
+	if serverResponse.TestRunURL == "" {
+		return serverResponse, fmt.Errorf("invalid -reuse-run file %s: no test_run_url", path)
+	}
+	return serverResponse, nil
+}
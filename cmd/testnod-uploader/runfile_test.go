@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateOnlyReuseRun(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	fixture, err := filepath.Abs("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Abs() error = %v", err)
+	}
+	runFile := filepath.Join(t.TempDir(), "run.json")
+	server := newFakeTestNod(t)
+
+	invoke := func(args ...string) runSummary {
+		t.Helper()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd", "-token", "token"}, args...)
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags(%q) error = %v", args, err)
+		}
+		config.BaseURL = server.URL
+		return run(config)
+	}
+
+	// The first invocation creates the run before the file exists.
+	summary := invoke("-build-id", "42", "-create-only", runFile)
+	if summary.Succeeded != 1 || server.Creates != 1 || server.Uploaded != nil {
+		t.Fatalf("-create-only summary = %+v with %d create(s), want one run created and nothing uploaded", summary, server.Creates)
+	}
+	saved, err := readRunFile(runFile)
+	if err != nil {
+		t.Fatalf("readRunFile() error = %v", err)
+	}
+	if saved.TestRunURL != "https://testnod.example/runs/1" || !strings.HasSuffix(saved.PresignedURL, "/storage/key") {
+		t.Errorf("Saved run = %+v, want the run URL and presigned URL", saved)
+	}
+
+	// The second uploads to the saved presigned URL without creating another.
+	summary = invoke("-reuse-run", runFile, fixture)
+	if summary.Succeeded != 1 || server.Creates != 1 {
+		t.Fatalf("-reuse-run summary = %+v with %d create(s), want one upload and no new run", summary, server.Creates)
+	}
+	want, _ := os.ReadFile(fixture)
+	if string(server.Uploaded) != string(want) {
+		t.Errorf("Uploaded %q, want the file", server.Uploaded)
+	}
+	if len(summary.RunURLs) != 1 || summary.RunURLs[0] != saved.TestRunURL {
+		t.Errorf("Run URLs = %v, want the saved run", summary.RunURLs)
+	}
+
+	t.Run("missing run file", func(t *testing.T) {
+		summary := invoke("-reuse-run", filepath.Join(t.TempDir(), "missing.json"), fixture)
+		if summary.Failed != 1 {
+			t.Errorf("summary = %+v, want the upload to fail", summary)
+		}
+	})
+}
+
+func TestParseFlagsCreateOnlyReuseRun(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"create-only with a file", []string{"-build-id", "1", "-create-only", "run.json", "../../testdata/valid_junit.xml"}, "-create-only does not take file arguments"},
+		{"create-only with validate", []string{"-validate", "-create-only", "run.json"}, "-create-only can't be combined"},
+		{"reuse-run with skip-upload", []string{"-skip-upload", "-reuse-run", "run.json", "../../testdata/valid_junit.xml"}, "-reuse-run can't be combined"},
+		{"reuse-run with several files", []string{"-reuse-run", "run.json", "../../testdata/valid_junit.xml", "../../testdata/valid_junit.xml"}, "-reuse-run uploads a single file"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append([]string{"cmd", "-token", "token"}, tt.args...)
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"math/rand/v2"
+)
+
+// sampledIn decides whether this invocation uploads under -sample-rate. A
+// rate of 1 always uploads and 0 never does. With -sample-seed the decision
+// is reproducible; without it, it's random per invocation.
+func sampledIn(config Config) bool {
+	if config.SampleRate >= 1 {
+		return true
+	}
+	if config.sampleSeedSet {
+		seed := uint64(config.SampleSeed)
+		return rand.New(rand.NewPCG(seed, seed)).Float64() < config.SampleRate
+	}
+	return rand.Float64() < config.SampleRate
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSampledIn(t *testing.T) {
+	t.Run("rate extremes", func(t *testing.T) {
+		for _, seeded := range []bool{false, true} {
+			if !sampledIn(Config{SampleRate: 1, sampleSeedSet: seeded}) {
+				t.Errorf("sampledIn() = false with -sample-rate 1 (seeded %v), want every upload", seeded)
+			}
+			if sampledIn(Config{SampleRate: 0, sampleSeedSet: seeded}) {
+				t.Errorf("sampledIn() = true with -sample-rate 0 (seeded %v), want no uploads", seeded)
+			}
+		}
+	})
+
+	t.Run("seed is reproducible", func(t *testing.T) {
+		uploads := 0
+		for seed := range int64(100) {
+			config := Config{SampleRate: 0.5, SampleSeed: seed, sampleSeedSet: true}
+			first := sampledIn(config)
+			for range 5 {
+				if sampledIn(config) != first {
+					t.Fatalf("sampledIn() with -sample-seed %d changed its decision", seed)
+				}
+			}
+			if first {
+				uploads++
+			}
+		}
+		if uploads == 0 || uploads == 100 {
+			t.Errorf("sampledIn() uploaded %d of 100 seeds at -sample-rate 0.5, want a mix", uploads)
+		}
+	})
+}
+
+func TestParseFlagsSampleRate(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("seed", func(t *testing.T) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-token", "token", "-build-id", "1", "-sample-rate", "0.1", "-sample-seed", "0", "../../testdata/valid_junit.xml"}
+
+		config, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags() error = %v", err)
+		}
+		if config.SampleRate != 0.1 || !config.sampleSeedSet {
+			t.Errorf("parseFlags() = rate %v, seed set %v, want 0.1 and a seed", config.SampleRate, config.sampleSeedSet)
+		}
+	})
+
+	for _, rate := range []string{"-0.1", "1.5"} {
+		t.Run(rate, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cmd", "-token", "token", "-build-id", "1", "-sample-rate", rate, "../../testdata/valid_junit.xml"}
+
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-sample-rate must be between 0 and 1") {
+				t.Errorf("parseFlags() error = %v, want a range error", err)
+			}
+		})
+	}
+}
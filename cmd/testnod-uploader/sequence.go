@@ -0,0 +1,19 @@
+package main
+
+import "testnod-uploader/internal/errcode"
+
+// retrySequence reports whether an upload that failed with err, after its
+// own retries, should start over from creating the test run. sequence is the
+// number of sequence retries already made. A file that can't be read won't
+// upload any better to a fresh URL, a timeout is final with
+// -retry-on-timeout=false, and a used-up -max-attempts-total budget leaves
+// nothing to retry with.
+func retrySequence(config Config, err error, sequence int) bool {
+	if sequence >= config.SequenceRetries || config.ReuseRun != "" {
+		return false
+	}
+	if errcode.Code(err) == errcode.UploadFile || (!config.RetryOnTimeout && errcode.IsTimeout(err)) {
+		return false
+	}
+	return config.attemptBudget.remaining() != 0
+}
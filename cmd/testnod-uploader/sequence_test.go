@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"testnod-uploader/internal/testnod"
+)
+
+// expiringStorage hands out a new presigned URL with every create and fails
+// uploads to the first failUploads of them, like URLs that expired before
+// the upload got to them.
+type expiringStorage struct {
+	*httptest.Server
+	failUploads int
+
+	mu              sync.Mutex
+	idempotencyKeys []string
+	uploads         []string
+	failureNotices  []int
+}
+
+func newExpiringStorage(t *testing.T, failUploads int) *expiringStorage {
+	t.Helper()
+	s := &expiringStorage{failUploads: failUploads}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/integrations/test_runs/upload", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.idempotencyKeys = append(s.idempotencyKeys, r.Header.Get(testnod.IdempotencyKeyHeader))
+		n := len(s.idempotencyKeys)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(testnod.SuccessfulServerResponse{
+			TestRunURL:   "https://testnod.example/runs/1",
+			PresignedURL: fmt.Sprintf("http://%s/storage/%d", r.Host, n),
+			UploadID:     n,
+		})
+	})
+	mux.HandleFunc("/storage/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.uploads = append(s.uploads, r.URL.Path)
+		s.mu.Unlock()
+		var n int
+		fmt.Sscanf(r.URL.Path, "/storage/%d", &n)
+		if n <= s.failUploads {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/integrations/test_runs/upload_failed", func(w http.ResponseWriter, r *http.Request) {
+		var notice testnod.UploadFailureRequest
+		json.NewDecoder(r.Body).Decode(&notice)
+		s.mu.Lock()
+		s.failureNotices = append(s.failureNotices, notice.UploadID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *expiringStorage) uploadConfig(sequenceRetries int) Config {
+	config := (&fakeTestNod{Server: s.Server}).uploadConfig("../../testdata/valid_junit.xml")
+	config.UploadAttempts = 2
+	config.SequenceRetries = sequenceRetries
+	return config
+}
+
+func TestSequenceRetries(t *testing.T) {
+	shortenRetryDelays(t)
+
+	t.Run("fresh create after a failed upload", func(t *testing.T) {
+		server := newExpiringStorage(t, 1)
+		result, err := uploadToTestNod(server.uploadConfig(1))
+		if err != nil {
+			t.Fatalf("uploadToTestNod() error = %v", err)
+		}
+		if result.TestRunURL == "" {
+			t.Error("TestRunURL is empty, want the uploaded run")
+		}
+		if len(server.idempotencyKeys) != 2 {
+			t.Fatalf("creates = %d, want 2", len(server.idempotencyKeys))
+		}
+		if key := server.idempotencyKeys[0]; key == "" || server.idempotencyKeys[1] != key {
+			t.Errorf("Idempotency-Key headers = %q, want the same key on both creates", server.idempotencyKeys)
+		}
+		want := []string{"/storage/1", "/storage/1", "/storage/2"}
+		if strings.Join(server.uploads, " ") != strings.Join(want, " ") {
+			t.Errorf("uploads = %v, want %v", server.uploads, want)
+		}
+		if !slices.Equal(server.failureNotices, []int{1}) {
+			t.Errorf("failure notices for uploads %v, want one for the abandoned upload 1", server.failureNotices)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		server := newExpiringStorage(t, 1)
+		if _, err := uploadToTestNod(server.uploadConfig(0)); err == nil {
+			t.Fatal("uploadToTestNod() error = nil, want the upload failure")
+		}
+		if len(server.idempotencyKeys) != 1 || server.idempotencyKeys[0] != "" {
+			t.Errorf("Idempotency-Key headers = %q, want one create without the header", server.idempotencyKeys)
+		}
+	})
+
+	t.Run("gives up after the last sequence", func(t *testing.T) {
+		server := newExpiringStorage(t, 10)
+		if _, err := uploadToTestNod(server.uploadConfig(2)); err == nil {
+			t.Fatal("uploadToTestNod() error = nil, want the upload failure")
+		}
+		if len(server.idempotencyKeys) != 3 {
+			t.Errorf("creates = %d, want the first and 2 sequence retries", len(server.idempotencyKeys))
+		}
+		if !slices.Equal(server.failureNotices, []int{1, 2, 3}) {
+			t.Errorf("failure notices for uploads %v, want one for every run", server.failureNotices)
+		}
+	})
+
+	t.Run("stops when the attempt budget is used up", func(t *testing.T) {
+		server := newExpiringStorage(t, 10)
+		config := server.uploadConfig(5)
+		config.attemptBudget = newAttemptBudget(3)
+		if _, err := uploadToTestNod(config); err == nil {
+			t.Fatal("uploadToTestNod() error = nil, want the upload failure")
+		}
+		if len(server.idempotencyKeys) != 1 {
+			t.Errorf("creates = %d, want no sequence retry without attempts left", len(server.idempotencyKeys))
+		}
+	})
+}
+
+func TestParseFlagsSequenceRetries(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"negative", []string{"-sequence-retries", "-1"}, "-sequence-retries must not be negative"},
+		{"with reuse-run", []string{"-sequence-retries", "1", "-reuse-run", "run.json"}, "can't be combined with -reuse-run"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = append(append([]string{"cmd", "-token", "t", "-build-id", "1"}, tt.args...), "../../testdata/valid_junit.xml")
+			if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
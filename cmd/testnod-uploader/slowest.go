@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"testnod-uploader/internal/junit"
+)
+
+// slowTestcase is one entry of the -top-slow list.
+type slowTestcase struct {
+	Classname string  `json:"classname"`
+	Name      string  `json:"name"`
+	Time      float64 `json:"time"`
+}
+
+// slowestTestcases returns up to n testcases of doc with the longest time,
+// slowest first. Testcases without a time are skipped, and ties keep their
+// document order. Only the n slowest are kept while walking, so large files
+// aren't sorted in full.
+func slowestTestcases(doc *junit.Document, n int) []slowTestcase {
+	if n <= 0 {
+		return nil
+	}
+
+	slowest := make([]slowTestcase, 0, n)
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		t, ok := junit.ParseTime(tc.Time)
+		if !ok {
+			return
+		}
+		// Insert after every testcase at least as slow, so ties stay in
+		// document order.
+		i := len(slowest)
+		for i > 0 && slowest[i-1].Time < t {
+			i--
+		}
+		if i == n {
+			return
+		}
+		if len(slowest) < n {
+			slowest = append(slowest, slowTestcase{})
+		}
+		copy(slowest[i+1:], slowest[i:])
+		slowest[i] = slowTestcase{Classname: tc.Classname, Name: tc.Name, Time: t}
+	})
+	return slowest
+}
+
+// printSlowest writes the -top-slow list for a validated file.
+func printSlowest(w io.Writer, slowest []slowTestcase) {
+	if len(slowest) == 0 {
+		fmt.Fprintln(w, "No testcases with a time to rank.")
+		return
+	}
+
+	fmt.Fprintf(w, "Slowest %d testcase(s):\n", len(slowest))
+	for i, tc := range slowest {
+		fmt.Fprintf(w, "%3d. %10.3fs  %s  %s\n", i+1, tc.Time, tc.Classname, tc.Name)
+	}
+}
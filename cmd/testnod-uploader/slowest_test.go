@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+const slowestInput = `<testsuites>
+  <testsuite name="api">
+    <testcase classname="api.Users" name="create" time="1.5"/>
+    <testcase classname="api.Users" name="delete" time="0.2"/>
+    <testcase classname="api.Users" name="untimed"/>
+    <testcase classname="api.Users" name="garbage" time="slow"/>
+  </testsuite>
+  <testsuite name="db">
+    <testcase classname="db.Migrate" name="up" time="12.25"/>
+    <testcase classname="db.Migrate" name="down" time="1.5"/>
+    <testsuite name="nested">
+      <testcase classname="db.Seed" name="all" time="3"/>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+
+func TestSlowestTestcases(t *testing.T) {
+	doc, err := junit.Parse(strings.NewReader(slowestInput))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	format := func(slowest []slowTestcase) string {
+		var parts []string
+		for _, tc := range slowest {
+			parts = append(parts, fmt.Sprintf("%s.%s=%g", tc.Classname, tc.Name, tc.Time))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 0, want: ""},
+		{n: 1, want: "db.Migrate.up=12.25"},
+		{n: 3, want: "db.Migrate.up=12.25 db.Seed.all=3 api.Users.create=1.5"},
+		// Ties keep document order.
+		{n: 4, want: "db.Migrate.up=12.25 db.Seed.all=3 api.Users.create=1.5 db.Migrate.down=1.5"},
+		// Testcases without a time are never listed.
+		{n: 10, want: "db.Migrate.up=12.25 db.Seed.all=3 api.Users.create=1.5 db.Migrate.down=1.5 api.Users.delete=0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("n=%d", tt.n), func(t *testing.T) {
+			if got := format(slowestTestcases(doc, tt.n)); got != tt.want {
+				t.Errorf("slowestTestcases(%d) = %q, want %q", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintSlowest(t *testing.T) {
+	var out bytes.Buffer
+	printSlowest(&out, []slowTestcase{{Classname: "db.Migrate", Name: "up", Time: 12.25}})
+	if want := "Slowest 1 testcase(s):\n  1.     12.250s  db.Migrate  up\n"; out.String() != want {
+		t.Errorf("printSlowest() = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	printSlowest(&out, nil)
+	if !strings.Contains(out.String(), "No testcases with a time") {
+		t.Errorf("printSlowest(nil) = %q, want a note that nothing was ranked", out.String())
+	}
+}
+
+func TestTopSlowReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.xml")
+	if err := os.WriteFile(path, []byte(slowestInput), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	report, err := validateForReport(Config{FilePath: path, TopSlow: 2})
+	if err != nil {
+		t.Fatalf("validateForReport() error = %v", err)
+	}
+	if len(report.Slowest) != 2 || report.Slowest[0].Name != "up" || report.Slowest[1].Name != "all" {
+		t.Errorf("Slowest = %+v, want up and all", report.Slowest)
+	}
+
+	t.Run("requires -validate", func(t *testing.T) {
+		oldArgs := os.Args
+		defer func() { os.Args = oldArgs }()
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "-token", "t", "-build-id", "1", "-top-slow", "5", path}
+
+		if _, err := parseFlags(); err == nil || !strings.Contains(err.Error(), "-top-slow requires -validate") {
+			t.Errorf("parseFlags() error = %v, expected a -validate error", err)
+		}
+	})
+}
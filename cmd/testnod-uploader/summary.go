@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// runSummary aggregates per-file outcomes into the single line printed at the
+// end of every run, e.g.
+//
+//	testnod-uploader: 3 files, 2 uploaded, 1 failed, run https://testnod.com/...
+type runSummary struct {
+	// Action describes a successful file in the current mode, e.g. "uploaded".
+	Action    string
+	Files     int
+	Succeeded int
+	Failed    int
+	// Skipped counts files -resume found already uploaded, valid files
+	// -validate-only-first didn't upload because others were invalid, and
+	// files -no-upload-on-failure kept back, which are also counted in
+	// NotUploaded.
+	Skipped     int
+	NotUploaded int
+	RunURLs     []string
+}
+
+// Add counts a processed file with the test runs it was uploaded to, several
+// for a file split by -group-by.
+func (s *runSummary) Add(runURLs []string, err error) {
+	if errors.Is(err, errFailingNotUploaded) {
+		s.Skip()
+		s.NotUploaded++
+		return
+	}
+
+	s.Files++
+	if err != nil {
+		s.Failed++
+		return
+	}
+
+	s.Succeeded++
+	s.RunURLs = append(s.RunURLs, runURLs...)
+}
+
+// Skip counts a file that wasn't processed because -resume found it already
+// uploaded or -validate-only-first found another file invalid.
+func (s *runSummary) Skip() {
+	s.Files++
+	s.Skipped++
+}
+
+func (s runSummary) String() string {
+	files := "files"
+	if s.Files == 1 {
+		files = "file"
+	}
+
+	line := fmt.Sprintf("testnod-uploader: %d %s, %d %s, %d failed", s.Files, files, s.Succeeded, s.Action, s.Failed)
+	if s.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", s.Skipped)
+	}
+
+	switch len(s.RunURLs) {
+	case 0:
+	case 1:
+		line += ", run " + s.RunURLs[0]
+	default:
+		line += ", runs " + strings.Join(s.RunURLs, " ")
+	}
+
+	return line
+}
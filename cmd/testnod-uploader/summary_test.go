@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type summaryEntry struct {
+	runURLs []string
+	err     error
+}
+
+// errSkipped stands for a file -resume skipped in summaryEntry lists.
+var errSkipped = errors.New("skipped")
+
+func TestRunSummary(t *testing.T) {
+	failure := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		action  string
+		results []summaryEntry
+		want    string
+	}{
+		{
+			name:   "single successful upload",
+			action: "uploaded",
+			results: []summaryEntry{
+				{[]string{"https://testnod.com/runs/1"}, nil},
+			},
+			want: "testnod-uploader: 1 file, 1 uploaded, 0 failed, run https://testnod.com/runs/1",
+		},
+		{
+			name:   "mixed outcomes",
+			action: "uploaded",
+			results: []summaryEntry{
+				{[]string{"https://testnod.com/runs/1"}, nil},
+				{nil, failure},
+				{[]string{"https://testnod.com/runs/2"}, nil},
+			},
+			want: "testnod-uploader: 3 files, 2 uploaded, 1 failed, runs https://testnod.com/runs/1 https://testnod.com/runs/2",
+		},
+		{
+			name:   "file split into groups",
+			action: "uploaded",
+			results: []summaryEntry{
+				{[]string{"https://testnod.com/runs/1", "https://testnod.com/runs/2"}, nil},
+			},
+			want: "testnod-uploader: 1 file, 1 uploaded, 0 failed, runs https://testnod.com/runs/1 https://testnod.com/runs/2",
+		},
+		{
+			name:   "validation failure",
+			action: "valid",
+			results: []summaryEntry{
+				{nil, failure},
+			},
+			want: "testnod-uploader: 1 file, 0 valid, 1 failed",
+		},
+		{
+			name:   "skipped by -resume",
+			action: "uploaded",
+			results: []summaryEntry{
+				{[]string{"https://testnod.com/runs/1"}, nil},
+				{nil, errSkipped},
+			},
+			want: "testnod-uploader: 2 files, 1 uploaded, 0 failed, 1 skipped, run https://testnod.com/runs/1",
+		},
+		{
+			name:   "kept back by -no-upload-on-failure",
+			action: "uploaded",
+			results: []summaryEntry{
+				{nil, fmt.Errorf("results.xml has 1 failed or errored tests, %w", errFailingNotUploaded)},
+			},
+			want: "testnod-uploader: 1 file, 0 uploaded, 0 failed, 1 skipped",
+		},
+		{
+			name:   "no files",
+			action: "uploaded",
+			want:   "testnod-uploader: 0 files, 0 uploaded, 0 failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := runSummary{Action: tt.action}
+			for _, r := range tt.results {
+				if r.err == errSkipped {
+					summary.Skip()
+					continue
+				}
+				summary.Add(r.runURLs, r.err)
+			}
+
+			if got := summary.String(); got != tt.want {
+				t.Errorf("runSummary.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSummaryCounts(t *testing.T) {
+	summary := runSummary{Action: "uploaded"}
+	summary.Add([]string{"https://testnod.com/runs/1"}, nil)
+	summary.Add(nil, errors.New("upload failed"))
+
+	if summary.Files != 2 || summary.Succeeded != 1 || summary.Failed != 1 {
+		t.Errorf("Unexpected counts: files=%d succeeded=%d failed=%d", summary.Files, summary.Succeeded, summary.Failed)
+	}
+}
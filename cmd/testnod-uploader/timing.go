@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases -timing reports, in the order they run.
+const (
+	phaseValidate = "validate"
+	phaseCreate   = "create"
+	phaseUpload   = "upload"
+)
+
+var timedPhases = []string{phaseValidate, phaseCreate, phaseUpload}
+
+// phaseTimings is the -timing record of wall-clock time spent in each phase,
+// summed over every file of the invocation. A nil *phaseTimings records
+// nothing.
+type phaseTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+func newPhaseTimings(enabled bool) *phaseTimings {
+	if !enabled {
+		return nil
+	}
+	return &phaseTimings{durations: make(map[string]time.Duration)}
+}
+
+// since adds the time since start to phase. It's meant to be deferred:
+//
+//	defer config.timings.since(phaseValidate, time.Now())
+func (t *phaseTimings) since(phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations[phase] += time.Since(start)
+}
+
+// duration is the total time recorded for phase, and whether it ran at all.
+func (t *phaseTimings) duration(phase string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.durations[phase]
+	return d, ok
+}
+
+// String lists the phases that ran with their times, e.g.
+// "validate 120ms, create 340ms, upload 4.2s".
+func (t *phaseTimings) String() string {
+	var parts []string
+	for _, phase := range timedPhases {
+		if d, ok := t.duration(phase); ok {
+			parts = append(parts, phase+" "+roundDuration(d).String())
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// roundDuration keeps timings readable: microseconds below a millisecond,
+// milliseconds below a second, tenths of a second above.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
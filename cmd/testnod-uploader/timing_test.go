@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhaseTimings(t *testing.T) {
+	t.Run("upload records every phase across files", func(t *testing.T) {
+		server := newFakeTestNod(t)
+		timings := newPhaseTimings(true)
+		for range 2 {
+			config := server.uploadConfig("../../testdata/valid_junit.xml")
+			config.timings = timings
+			if _, err := uploadToTestNod(config); err != nil {
+				t.Fatalf("uploadToTestNod() error = %v", err)
+			}
+		}
+
+		for _, phase := range timedPhases {
+			d, ok := timings.duration(phase)
+			if !ok {
+				t.Errorf("duration(%q) not recorded", phase)
+			}
+			if d < 0 {
+				t.Errorf("duration(%q) = %s, want non-negative", phase, d)
+			}
+		}
+	})
+
+	t.Run("validation only records validate", func(t *testing.T) {
+		timings := newPhaseTimings(true)
+		config := Config{FilePath: "../../testdata/valid_junit.xml", ValidateFile: true, timings: timings}
+		if err := validateOnly(config); err != nil {
+			t.Fatalf("validateOnly() error = %v", err)
+		}
+		if _, ok := timings.duration(phaseValidate); !ok {
+			t.Error("validate phase not recorded")
+		}
+		for _, phase := range []string{phaseCreate, phaseUpload} {
+			if _, ok := timings.duration(phase); ok {
+				t.Errorf("duration(%q) recorded without an upload", phase)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		timings := newPhaseTimings(false)
+		timings.since(phaseValidate, time.Now())
+		if got := timings.String(); got != "" {
+			t.Errorf("String() = %q without -timing, want empty", got)
+		}
+	})
+}
+
+func TestPhaseTimingsString(t *testing.T) {
+	timings := newPhaseTimings(true)
+	timings.durations[phaseUpload] = 4213 * time.Millisecond
+	timings.durations[phaseValidate] = 120400 * time.Microsecond
+	timings.durations[phaseCreate] = 340 * time.Millisecond
+
+	want := "validate 120ms, create 340ms, upload 4.2s"
+	if got := timings.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -2,4 +2,10 @@ module testnod-uploader
 
 go 1.26.4
 
-require github.com/avast/retry-go/v5 v5.0.0
+require (
+	github.com/avast/retry-go/v5 v5.0.0
+	github.com/fsnotify/fsnotify v1.10.1
+	golang.org/x/time v0.15.0
+)
+
+require golang.org/x/sys v0.45.0 // indirect
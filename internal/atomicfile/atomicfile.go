@@ -0,0 +1,44 @@
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// tempPattern names the temporary files WriteJSON writes before renaming
+// them into place, hidden and recognisable if a crash leaves one behind.
+const tempPattern = ".testnod-*"
+
+// WriteJSON writes v as JSON, followed by a newline, to path, indented by two
+// spaces when indent is set. The data goes to a temporary file in the same
+// directory that then replaces path, so a reader never sees a partial file.
+func WriteJSON(path string, v any, indent bool) error {
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPattern)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
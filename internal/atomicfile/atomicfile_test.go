@@ -0,0 +1,63 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+	value := map[string]int{"a": 1}
+
+	for _, tt := range []struct {
+		indent bool
+		want   string
+	}{
+		{false, "{\"a\":1}\n"},
+		{true, "{\n  \"a\": 1\n}\n"},
+	} {
+		if err := WriteJSON(path, value, tt.indent); err != nil {
+			t.Fatalf("WriteJSON(indent=%v) error = %v", tt.indent, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("WriteJSON(indent=%v) wrote %q, want %q", tt.indent, data, tt.want)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Directory has %d entries, want only out.json left behind", len(entries))
+	}
+}
+
+func TestWriteJSONErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := WriteJSON(filepath.Join(dir, "out.json"), func() {}, false); err == nil {
+		t.Error("WriteJSON() of a func error = nil, want an encoding error")
+	}
+	if err := WriteJSON(filepath.Join(dir, "missing", "out.json"), 1, false); err == nil {
+		t.Error("WriteJSON() into a missing directory error = nil, want an error")
+	}
+	// A directory in the way makes the rename fail after the temporary file
+	// was written; it must not be left behind.
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteJSON(blocked, 1, false); err == nil {
+		t.Error("WriteJSON() over a non-empty directory error = nil, want an error")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".testnod-*")); len(matches) != 0 {
+		t.Errorf("Temporary files left behind: %v", matches)
+	}
+}
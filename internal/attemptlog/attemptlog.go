@@ -0,0 +1,108 @@
+package attemptlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"testnod-uploader/internal/errcode"
+)
+
+// Steps recorded in the log.
+const (
+	Create = "create"
+	Upload = "upload"
+)
+
+// Statuses of attempts that succeeded and of failed attempts without an
+// error code. Other failed attempts use their code, e.g. E_UPLOAD_503.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Entry is one line of the log.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	File       string    `json:"file"`
+	Step       string    `json:"step"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// Log appends a JSON line for every create and upload attempt to a file,
+// so intermittent failures can be investigated after the run. Entries from
+// earlier runs are kept. A nil *Log ignores every record.
+type Log struct {
+	mu        sync.Mutex
+	file      *os.File
+	requestID string
+}
+
+// Open opens path for appending, creating it if needed.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open attempt log: %w", err)
+	}
+	return &Log{file: f}, nil
+}
+
+// SetRequestID sets the -request-id recorded with every later entry.
+func (l *Log) SetRequestID(id string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requestID = id
+}
+
+// Record appends an entry for one attempt of step on file. err is nil for
+// the attempt that succeeded.
+func (l *Log) Record(file string, step string, attempt int, duration time.Duration, err error) error {
+	if l == nil {
+		return nil
+	}
+
+	entry := Entry{
+		Time:       time.Now().UTC(),
+		File:       file,
+		Step:       step,
+		Attempt:    attempt,
+		Status:     StatusOK,
+		DurationMS: duration.Milliseconds(),
+	}
+	if err != nil {
+		entry.Status = errcode.Code(err)
+		if entry.Status == "" {
+			entry.Status = StatusError
+		}
+		entry.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.RequestID = l.requestID
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write attempt log: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,89 @@
+package attemptlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"testnod-uploader/internal/errcode"
+)
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to parse line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attempts.jsonl")
+	os.WriteFile(path, []byte(`{"step":"create","attempt":1,"status":"ok"}`+"\n"), 0o644)
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	log.Record("results.xml", Upload, 1, 1500*time.Millisecond, errcode.Errorf("E_UPLOAD_503", "received non-OK response: 503"))
+	log.Record("results.xml", Upload, 2, 20*time.Millisecond, errors.New("connection reset"))
+	log.Record("results.xml", Upload, 3, 10*time.Millisecond, nil)
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries := readEntries(t, path)
+	if len(entries) != 4 {
+		t.Fatalf("Got %d lines, want the earlier run's line and 3 attempts", len(entries))
+	}
+
+	tests := []struct {
+		entry    Entry
+		status   string
+		duration int64
+		hasError bool
+	}{
+		{entries[1], "E_UPLOAD_503", 1500, true},
+		{entries[2], StatusError, 20, true},
+		{entries[3], StatusOK, 10, false},
+	}
+	for i, tt := range tests {
+		if tt.entry.Attempt != i+1 || tt.entry.Step != Upload || tt.entry.File != "results.xml" {
+			t.Errorf("entry %d = %+v, want attempt %d of the upload of results.xml", i, tt.entry, i+1)
+		}
+		if tt.entry.Status != tt.status || tt.entry.DurationMS != tt.duration || (tt.entry.Error != "") != tt.hasError {
+			t.Errorf("entry %d = %+v, want status %s, %dms, error %v", i, tt.entry, tt.status, tt.duration, tt.hasError)
+		}
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var log *Log
+	if err := log.Record("results.xml", Create, 1, time.Second, nil); err != nil {
+		t.Errorf("Record() on a nil log error = %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("Close() on a nil log error = %v", err)
+	}
+}
+
+func TestOpenMissingDirectory(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing", "attempts.jsonl")); err == nil {
+		t.Error("Open() expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,127 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"testnod-uploader/internal/atomicfile"
+)
+
+// Entry is a file that was uploaded successfully. A file is identified by
+// its path and the SHA-256 of its content, so a file that changed since it
+// was uploaded is uploaded again.
+type Entry struct {
+	Path        string    `json:"path"`
+	SHA256      string    `json:"sha256"`
+	TestRunURLs []string  `json:"test_run_urls,omitempty"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// checkpoint is the JSON written to the checkpoint file.
+type checkpoint struct {
+	Files []Entry `json:"files"`
+}
+
+// File records which files of a batch were uploaded, so an interrupted batch
+// can be resumed without uploading them again. Every Record rewrites the
+// whole file through a temporary file that is renamed over it, so an
+// interrupted run never leaves partial JSON behind. A nil *File treats every
+// file as not done and ignores records.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Load reads the checkpoint file at path. A missing file is an empty
+// checkpoint, created on the first Record.
+func Load(path string) (*File, error) {
+	f := &File{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+	}
+	f.entries = c.Files
+	return f, nil
+}
+
+// Hash returns the hex SHA-256 of the file at path, as stored in entries.
+func Hash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Done reports whether the file at path with content hash was already
+// uploaded.
+func (f *File) Done(path, hash string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range f.entries {
+		if e.Path == path && e.SHA256 == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Record adds the file at path with content hash as uploaded to the test runs
+// at runURLs and rewrites the checkpoint file. An earlier entry for the same
+// path is replaced.
+func (f *File) Record(path, hash string, runURLs []string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry := Entry{Path: path, SHA256: hash, TestRunURLs: runURLs, UploadedAt: time.Now().UTC()}
+	replaced := false
+	for i := range f.entries {
+		if f.entries[i].Path == path {
+			f.entries[i] = entry
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		f.entries = append(f.entries, entry)
+	}
+	return f.write()
+}
+
+func (f *File) write() error {
+	if err := atomicfile.WriteJSON(f.path, checkpoint{Files: f.entries}, true); err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	hash, err := Hash(path)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	return hash
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoint.json")
+	a := filepath.Join(dir, "a.xml")
+	hashA := writeFile(t, a, "<testsuite/>")
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+	if f.Done(a, hashA) {
+		t.Error("Done() = true before anything was recorded")
+	}
+	if err := f.Record(a, hashA, []string{"https://testnod.example/runs/1"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reloaded.Done(a, hashA) {
+		t.Error("Done() = false for a recorded file after reloading")
+	}
+
+	t.Run("changed content", func(t *testing.T) {
+		changed := writeFile(t, a, "<testsuite name=\"changed\"/>")
+		if reloaded.Done(a, changed) {
+			t.Error("Done() = true for a file whose content changed")
+		}
+		if err := reloaded.Record(a, changed, nil); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		if len(reloaded.entries) != 1 {
+			t.Errorf("entries = %+v, want the entry for %s replaced", reloaded.entries, a)
+		}
+	})
+
+	t.Run("no temporary files left", func(t *testing.T) {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".testnod-") {
+				t.Errorf("temporary file %s left behind", e.Name())
+			}
+		}
+	})
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	os.WriteFile(path, []byte("{"), 0o644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Load() error = %v, want a parse error naming the file", err)
+	}
+}
+
+func TestNilFile(t *testing.T) {
+	var f *File
+	if f.Done("a.xml", "hash") {
+		t.Error("Done() = true on a nil *File")
+	}
+	if err := f.Record("a.xml", "hash", nil); err != nil {
+		t.Errorf("Record() on a nil *File error = %v", err)
+	}
+}
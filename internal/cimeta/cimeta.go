@@ -0,0 +1,124 @@
+package cimeta
+
+import (
+	"os"
+
+	"testnod-uploader/internal/testnod"
+)
+
+// Getenv looks up an environment variable, returning "" when it's unset.
+// Providers take it as a parameter so tests can simulate any CI
+// environment.
+type Getenv func(name string) string
+
+// MetadataProvider reads test run metadata from a CI provider's environment
+// variables. New providers only need to be appended to Providers.
+type MetadataProvider interface {
+	// Name identifies the provider in debug output.
+	Name() string
+
+	// Detect reports whether the process is running on this provider.
+	Detect(getenv Getenv) bool
+
+	// Metadata returns the metadata the provider knows. Fields it can't
+	// determine are left empty.
+	Metadata(getenv Getenv) testnod.TestRunMetadata
+}
+
+// Providers are tried in order by Detect.
+var Providers = []MetadataProvider{
+	GitHubActions{},
+	GitLabCI{},
+}
+
+// Detect returns the first provider in providers that detects its
+// environment.
+func Detect(providers []MetadataProvider, getenv Getenv) (MetadataProvider, bool) {
+	for _, p := range providers {
+		if p.Detect(getenv) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Fill sets every empty field of metadata from the provider's metadata and
+// returns the names of the fields it set.
+func Fill(metadata *testnod.TestRunMetadata, p MetadataProvider, getenv Getenv) []string {
+	detected := p.Metadata(getenv)
+
+	var filled []string
+	fill := func(name string, value *string, fromProvider string) {
+		if *value == "" && fromProvider != "" {
+			*value = fromProvider
+			filled = append(filled, name)
+		}
+	}
+	fill("branch", &metadata.Branch, detected.Branch)
+	fill("commit_sha", &metadata.CommitSHA, detected.CommitSHA)
+	fill("run_url", &metadata.RunURL, detected.RunURL)
+	fill("build_id", &metadata.BuildID, detected.BuildID)
+	fill("environment", &metadata.Environment, detected.Environment)
+	return filled
+}
+
+// OSGetenv is Getenv for the process environment.
+func OSGetenv(name string) string {
+	return os.Getenv(name)
+}
+
+// firstSet returns the value of the first variable in names that is set.
+func firstSet(getenv Getenv, names ...string) string {
+	for _, name := range names {
+		if value := getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// GitHubActions reads the default environment of GitHub Actions.
+type GitHubActions struct{}
+
+func (GitHubActions) Name() string { return "GitHub Actions" }
+
+func (GitHubActions) Detect(getenv Getenv) bool {
+	return getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Metadata uses the pull request's source branch for pull_request events,
+// where GITHUB_REF_NAME is the merge ref, and links the run URL to the
+// workflow run.
+func (GitHubActions) Metadata(getenv Getenv) testnod.TestRunMetadata {
+	metadata := testnod.TestRunMetadata{
+		Branch:    firstSet(getenv, "GITHUB_HEAD_REF", "GITHUB_REF_NAME"),
+		CommitSHA: getenv("GITHUB_SHA"),
+		BuildID:   getenv("GITHUB_RUN_ID"),
+	}
+	server, repository, runID := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID")
+	if server != "" && repository != "" && runID != "" {
+		metadata.RunURL = server + "/" + repository + "/actions/runs/" + runID
+	}
+	return metadata
+}
+
+// GitLabCI reads GitLab CI/CD's predefined variables.
+type GitLabCI struct{}
+
+func (GitLabCI) Name() string { return "GitLab CI" }
+
+func (GitLabCI) Detect(getenv Getenv) bool {
+	return getenv("GITLAB_CI") == "true"
+}
+
+// Metadata uses the merge request's source branch in merge request
+// pipelines, and the deployment environment of jobs that have one.
+func (GitLabCI) Metadata(getenv Getenv) testnod.TestRunMetadata {
+	return testnod.TestRunMetadata{
+		Branch:      firstSet(getenv, "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "CI_COMMIT_REF_NAME"),
+		CommitSHA:   getenv("CI_COMMIT_SHA"),
+		RunURL:      getenv("CI_PIPELINE_URL"),
+		BuildID:     getenv("CI_PIPELINE_ID"),
+		Environment: getenv("CI_ENVIRONMENT_NAME"),
+	}
+}
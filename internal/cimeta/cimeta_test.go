@@ -0,0 +1,102 @@
+package cimeta
+
+import (
+	"slices"
+	"testing"
+
+	"testnod-uploader/internal/testnod"
+)
+
+func env(vars map[string]string) Getenv {
+	return func(name string) string { return vars[name] }
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"github", map[string]string{"GITHUB_ACTIONS": "true"}, "GitHub Actions"},
+		{"gitlab", map[string]string{"GITLAB_CI": "true"}, "GitLab CI"},
+		{"first provider wins", map[string]string{"GITLAB_CI": "true", "GITHUB_ACTIONS": "true"}, "GitHub Actions"},
+		{"not true", map[string]string{"GITHUB_ACTIONS": "false"}, ""},
+		{"no ci", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := Detect(Providers, env(tt.vars))
+			got := ""
+			if ok {
+				got = p.Name()
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider MetadataProvider
+		vars     map[string]string
+		want     testnod.TestRunMetadata
+	}{
+		{
+			name:     "github push",
+			provider: GitHubActions{},
+			vars: map[string]string{
+				"GITHUB_REF_NAME":   "main",
+				"GITHUB_SHA":        "abc123",
+				"GITHUB_RUN_ID":     "42",
+				"GITHUB_SERVER_URL": "https://github.com",
+				"GITHUB_REPOSITORY": "acme/app",
+			},
+			want: testnod.TestRunMetadata{Branch: "main", CommitSHA: "abc123", BuildID: "42", RunURL: "https://github.com/acme/app/actions/runs/42"},
+		},
+		{
+			name:     "github pull request",
+			provider: GitHubActions{},
+			vars:     map[string]string{"GITHUB_REF_NAME": "7/merge", "GITHUB_HEAD_REF": "feature", "GITHUB_RUN_ID": "42"},
+			want:     testnod.TestRunMetadata{Branch: "feature", BuildID: "42"},
+		},
+		{
+			name:     "gitlab merge request",
+			provider: GitLabCI{},
+			vars: map[string]string{
+				"CI_COMMIT_REF_NAME":                  "refs/merge-requests/3/head",
+				"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature",
+				"CI_COMMIT_SHA":                       "def456",
+				"CI_PIPELINE_URL":                     "https://gitlab.com/acme/app/-/pipelines/9",
+				"CI_PIPELINE_ID":                      "9",
+				"CI_ENVIRONMENT_NAME":                 "staging",
+			},
+			want: testnod.TestRunMetadata{Branch: "feature", CommitSHA: "def456", RunURL: "https://gitlab.com/acme/app/-/pipelines/9", BuildID: "9", Environment: "staging"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.Metadata(env(tt.vars)); got != tt.want {
+				t.Errorf("Metadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFill(t *testing.T) {
+	vars := env(map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "main", "CI_COMMIT_SHA": "def456", "CI_PIPELINE_ID": "9"})
+	metadata := testnod.TestRunMetadata{Branch: "from-flag"}
+
+	filled := Fill(&metadata, GitLabCI{}, vars)
+	want := testnod.TestRunMetadata{Branch: "from-flag", CommitSHA: "def456", BuildID: "9"}
+	if metadata != want {
+		t.Errorf("Fill() metadata = %+v, want %+v", metadata, want)
+	}
+	if !slices.Equal(filled, []string{"commit_sha", "build_id"}) {
+		t.Errorf("Fill() = %v, want commit_sha and build_id", filled)
+	}
+}
@@ -3,3 +3,5 @@
 package debug
 
 func Log(format string, args ...any) {}
+
+func SetPrefix(prefix string) {}
@@ -7,6 +7,17 @@ import (
 	"os"
 )
 
+var prefix string
+
 func Log(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "[DEBUG] "+format+"\n", args...)
+	fmt.Fprintf(os.Stderr, "[DEBUG] %s%s\n", prefix, fmt.Sprintf(format, args...))
+}
+
+// SetPrefix adds prefix, followed by a space, to every later line, e.g. the
+// -request-id. Empty removes it.
+func SetPrefix(p string) {
+	prefix = ""
+	if p != "" {
+		prefix = p + " "
+	}
 }
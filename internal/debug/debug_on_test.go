@@ -61,3 +61,27 @@ func TestLogWritesToStderr(t *testing.T) {
 		})
 	}
 }
+
+func TestSetPrefix(t *testing.T) {
+	origStderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stderr = w
+
+	SetPrefix("[request-id=abc123]")
+	Log("count: %d", 1)
+	SetPrefix("")
+	Log("count: %d", 2)
+
+	w.Close()
+	os.Stderr = origStderr
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	want := "[DEBUG] [request-id=abc123] count: 1\n[DEBUG] count: 2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Log() output = %q, want %q", got, want)
+	}
+}
@@ -9,4 +9,6 @@ func TestLogNoOp(t *testing.T) {
 	Log("test message")
 	Log("formatted %s %d", "value", 42)
 	Log("")
+	SetPrefix("[request-id=abc123]")
+	Log("test message")
 }
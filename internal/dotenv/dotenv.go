@@ -0,0 +1,123 @@
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Var is one KEY=VALUE assignment of a .env file.
+type Var struct {
+	Key   string
+	Value string
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parse reads .env assignments from r, in order. Blank lines and lines
+// starting with # are ignored, and an "export " prefix is allowed. Values may
+// be single-quoted, taken literally, or double-quoted, where \n, \t, \" and \\
+// are unescaped. An unquoted value ends at a " #" comment and is trimmed.
+func Parse(r io.Reader) ([]Var, error) {
+	var vars []Var
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !keyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		vars = append(vars, Var{Key: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'', '"':
+		end := closingQuote(raw, quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the closing quote", rest)
+		}
+		value := raw[1:end]
+		if quote == '"' {
+			value = unescape(value)
+		}
+		return value, nil
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+// closingQuote returns the index of the quote ending raw's quoted value, or
+// -1. Double quotes can be escaped with a backslash.
+func closingQuote(raw string, quote byte) int {
+	for i := 1; i < len(raw); i++ {
+		switch {
+		case quote == '"' && raw[i] == '\\':
+			i++
+		case raw[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+var unescaper = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// Load sets the variables of the .env file at path that aren't already set
+// in the process environment, and returns the keys it set.
+func Load(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read -env-file: %w", err)
+	}
+	defer file.Close()
+
+	vars, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -env-file %s: %w", path, err)
+	}
+
+	var loaded []string
+	for _, v := range vars {
+		if _, set := os.LookupEnv(v.Key); set {
+			continue
+		}
+		if err := os.Setenv(v.Key, v.Value); err != nil {
+			return loaded, fmt.Errorf("failed to set %s from -env-file: %w", v.Key, err)
+		}
+		loaded = append(loaded, v.Key)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,89 @@
+package dotenv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# CI-like variables for local runs
+GITLAB_CI=true
+export CI_COMMIT_REF_NAME=feature/login
+CI_COMMIT_SHA = abc123   # trailing comment
+EMPTY=
+SINGLE='literal \n # not a comment'
+DOUBLE="line one\nsay \"hi\" # kept"
+URL=https://example.com/#anchor
+
+  INDENTED=yes
+`
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []Var{
+		{"GITLAB_CI", "true"},
+		{"CI_COMMIT_REF_NAME", "feature/login"},
+		{"CI_COMMIT_SHA", "abc123"},
+		{"EMPTY", ""},
+		{"SINGLE", `literal \n # not a comment`},
+		{"DOUBLE", "line one\nsay \"hi\" # kept"},
+		{"URL", "https://example.com/#anchor"},
+		{"INDENTED", "yes"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %q, want %q", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "no equals", input: "JUST_A_WORD", wantErr: "line 1: expected KEY=VALUE"},
+		{name: "invalid key", input: "# ok\n1KEY=x", wantErr: "line 2: expected KEY=VALUE"},
+		{name: "unterminated quote", input: `KEY="open`, wantErr: "unterminated \" quote"},
+		{name: "text after quote", input: `KEY='a' b`, wantErr: "after the closing quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("DOTENV_TEST_NEW=from-file\nDOTENV_TEST_SET=from-file\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	t.Setenv("DOTENV_TEST_SET", "from-env")
+	t.Setenv("DOTENV_TEST_NEW", "")
+	os.Unsetenv("DOTENV_TEST_NEW")
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"DOTENV_TEST_NEW"}) {
+		t.Errorf("Load() = %v, want only the unset variable loaded", loaded)
+	}
+	if got := os.Getenv("DOTENV_TEST_NEW"); got != "from-file" {
+		t.Errorf("DOTENV_TEST_NEW = %q, want from-file", got)
+	}
+	if got := os.Getenv("DOTENV_TEST_SET"); got != "from-env" {
+		t.Errorf("DOTENV_TEST_SET = %q, want the existing value kept", got)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Load() expected an error for a missing file")
+	}
+}
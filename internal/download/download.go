@@ -0,0 +1,87 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go/v5"
+
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/jitter"
+)
+
+const retryAttempts = 3
+
+var (
+	httpClient = &http.Client{Timeout: 60 * time.Second}
+	retryDelay = 1 * time.Second
+)
+
+// IsURL reports whether a file argument should be downloaded rather than
+// read from disk.
+func IsURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// Fetch downloads fileURL into a temporary file and returns its path. The
+// caller is responsible for removing it. Downloads larger than maxBytes are
+// rejected.
+func Fetch(fileURL string, maxBytes int64) (string, error) {
+	var tmpPath string
+
+	err := retry.New(
+		retry.Delay(retryDelay),
+		retry.DelayType(jitter.Backoff),
+		retry.Attempts(retryAttempts),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(attempt uint, err error) {
+			debug.Log("retry attempt %d: %v", attempt, err)
+		}),
+	).Do(
+		func() error {
+			resp, err := httpClient.Get(fileURL)
+			if err != nil {
+				return fmt.Errorf("failed to download file: %w", err)
+			}
+			defer resp.Body.Close()
+
+			debug.Log("download response: status=%d content-length=%d", resp.StatusCode, resp.ContentLength)
+
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to download file: %s", resp.Status)
+			}
+			if resp.ContentLength > maxBytes {
+				return retry.Unrecoverable(fmt.Errorf("file is %d bytes, larger than the %d byte limit", resp.ContentLength, maxBytes))
+			}
+
+			tmpFile, err := os.CreateTemp("", "testnod-download-*"+path.Ext(resp.Request.URL.Path))
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("failed to create temp file: %w", err))
+			}
+			defer tmpFile.Close()
+
+			// Read one byte past the limit to tell "exactly at" from "over"
+			// when the server doesn't send a Content-Length.
+			written, err := io.Copy(tmpFile, io.LimitReader(resp.Body, maxBytes+1))
+			if err != nil {
+				os.Remove(tmpFile.Name())
+				return fmt.Errorf("failed to download file: %w", err)
+			}
+			if written > maxBytes {
+				os.Remove(tmpFile.Name())
+				return retry.Unrecoverable(fmt.Errorf("file is larger than the %d byte limit", maxBytes))
+			}
+
+			debug.Log("downloaded %d bytes to %s", written, tmpFile.Name())
+			tmpPath = tmpFile.Name()
+			return nil
+		},
+	)
+
+	return tmpPath, err
+}
@@ -0,0 +1,146 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setShortRetryDelay(t *testing.T) {
+	t.Helper()
+	original := retryDelay
+	retryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { retryDelay = original })
+}
+
+const junitContent = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="test" tests="1"><testcase name="a" classname="b"/></testsuite>`
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"https://artifacts.example/results.xml", true},
+		{"http://artifacts.example/results.xml", true},
+		{"results.xml", false},
+		{"/tmp/http://results.xml", false},
+		{"ftp://artifacts.example/results.xml", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsURL(tt.arg); got != tt.want {
+			t.Errorf("IsURL(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestFetch_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(junitContent))
+	}))
+	defer server.Close()
+
+	path, err := Fetch(server.URL+"/builds/42/results.xml", 1<<20)
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	if !strings.HasSuffix(path, ".xml") {
+		t.Errorf("Fetch() path = %s, expected the URL's extension to be kept", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(data) != junitContent {
+		t.Errorf("Downloaded content = %q, want %q", data, junitContent)
+	}
+}
+
+func TestFetch_RetriesServerErrors(t *testing.T) {
+	setShortRetryDelay(t)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(junitContent))
+	}))
+	defer server.Close()
+
+	path, err := Fetch(server.URL+"/results.xml", 1<<20)
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestFetch_NotFound(t *testing.T) {
+	setShortRetryDelay(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := Fetch(server.URL+"/missing.xml", 1<<20)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetch() error = %v, expected a 404 error", err)
+	}
+}
+
+func TestFetch_SizeLimit(t *testing.T) {
+	setShortRetryDelay(t)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "content length over limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(junitContent))
+			},
+		},
+		{
+			name: "chunked body over limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(junitContent[:10]))
+				w.(http.Flusher).Flush()
+				w.Write([]byte(junitContent[10:]))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			_, err := Fetch(server.URL+"/results.xml", 16)
+			if err == nil || !strings.Contains(err.Error(), "16 byte limit") {
+				t.Errorf("Fetch() error = %v, expected size limit error", err)
+			}
+			if attempts != 1 {
+				t.Errorf("Expected oversized downloads not to be retried, got %d attempts", attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"testnod-uploader/internal/debug"
+)
+
+const redacted = "[REDACTED]"
+
+// authorizationHeader matches the value of a dumped Authorization header,
+// which carries -basic-user/-basic-pass credentials.
+var authorizationHeader = regexp.MustCompile(`(?m)^(Authorization: )[^\r\n]*`)
+
+// Transport writes every request and response passing through it into Dir,
+// so the exact exchange can be attached to a support ticket. Token is
+// replaced with a placeholder wherever it appears, as is the value of any
+// Authorization header.
+type Transport struct {
+	Base            http.RoundTripper
+	Dir             string
+	Step            string
+	Token           string
+	DumpRequestBody bool
+}
+
+var sequence atomic.Int64
+
+// NewTransport creates dir if needed and returns a Transport wrapping base.
+func NewTransport(base http.RoundTripper, dir string, step string, token string, dumpRequestBody bool) (*Transport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dump directory: %w", err)
+	}
+
+	return &Transport{
+		Base:            base,
+		Dir:             dir,
+		Step:            step,
+		Token:           token,
+		DumpRequestBody: dumpRequestBody,
+	}, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	prefix := fmt.Sprintf("%s-%03d-%s", time.Now().UTC().Format("20060102T150405.000"), sequence.Add(1), t.Step)
+
+	requestDump, err := httputil.DumpRequestOut(req, t.DumpRequestBody)
+	if err != nil {
+		debug.Log("failed to dump request: %v", err)
+	} else {
+		t.write(prefix+"-request.txt", requestDump)
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		t.write(prefix+"-response.txt", []byte(fmt.Sprintf("request failed: %v\n", err)))
+		return resp, err
+	}
+
+	responseDump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		debug.Log("failed to dump response: %v", err)
+	} else {
+		t.write(prefix+"-response.txt", responseDump)
+	}
+
+	return resp, nil
+}
+
+// write never fails the request: a dump is a diagnostic aid, not part of the
+// upload.
+func (t *Transport) write(name string, data []byte) {
+	if t.Token != "" {
+		data = bytes.ReplaceAll(data, []byte(t.Token), []byte(redacted))
+	}
+	data = authorizationHeader.ReplaceAll(data, []byte("${1}"+redacted))
+
+	path := filepath.Join(t.Dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		debug.Log("failed to write dump file %s: %v", path, err)
+		return
+	}
+	debug.Log("wrote dump file: %s", path)
+}
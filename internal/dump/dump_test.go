@@ -0,0 +1,155 @@
+package dump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func readDumps(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dump dir: %v", err)
+	}
+
+	dumps := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("Failed to read dump file: %v", err)
+		}
+		dumps[entry.Name()] = string(data)
+	}
+	return dumps
+}
+
+func TestTransport_WritesRedactedDumps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":123,"echo":"secret-token"}`))
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "nested", "debug")
+	transport, err := NewTransport(http.DefaultTransport, dir, "testnod-api", "secret-token", true)
+	if err != nil {
+		t.Fatalf("NewTransport() unexpected error: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/integrations/test_runs/upload", strings.NewReader(`{"tags":[]}`))
+	req.Header.Set("Project-Token", "secret-token")
+	req.SetBasicAuth("ci", "basic-secret")
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	dumps := readDumps(t, dir)
+	if len(dumps) != 2 {
+		t.Fatalf("Expected 2 dump files, got %d", len(dumps))
+	}
+
+	var names []string
+	for name := range dumps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !strings.HasSuffix(names[0], "-testnod-api-request.txt") || !strings.HasSuffix(names[1], "-testnod-api-response.txt") {
+		t.Fatalf("Unexpected dump file names: %v", names)
+	}
+
+	request := dumps[names[0]]
+	if !strings.Contains(request, "POST /integrations/test_runs/upload") {
+		t.Errorf("Request dump missing request line:\n%s", request)
+	}
+	if !strings.Contains(request, "Authorization: "+redacted+"\r\n") {
+		t.Errorf("Request dump missing redacted Authorization header:\n%s", request)
+	}
+	if !strings.Contains(request, `{"tags":[]}`) {
+		t.Errorf("Request dump missing body:\n%s", request)
+	}
+
+	response := dumps[names[1]]
+	if !strings.Contains(response, "201 Created") {
+		t.Errorf("Response dump missing status line:\n%s", response)
+	}
+	if !strings.Contains(response, `"id":123`) {
+		t.Errorf("Response dump missing body:\n%s", response)
+	}
+
+	for name, content := range dumps {
+		if strings.Contains(content, "secret-token") || strings.Contains(content, "Y2k6YmFzaWMtc2VjcmV0") {
+			t.Errorf("Dump %s contains the unredacted token:\n%s", name, content)
+		}
+		if !strings.Contains(content, redacted) {
+			t.Errorf("Dump %s expected to contain %s", name, redacted)
+		}
+	}
+}
+
+func TestTransport_WithoutRequestBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	transport, err := NewTransport(http.DefaultTransport, dir, "presigned-upload", "", false)
+	if err != nil {
+		t.Fatalf("NewTransport() unexpected error: %v", err)
+	}
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("<testsuite/>"))
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	for name, content := range readDumps(t, dir) {
+		if strings.Contains(content, "<testsuite/>") {
+			t.Errorf("Dump %s should not include the request body:\n%s", name, content)
+		}
+	}
+}
+
+func TestTransport_RequestError(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewTransport(http.DefaultTransport, dir, "testnod-api", "", true)
+	if err != nil {
+		t.Fatalf("NewTransport() unexpected error: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:1/unreachable", nil)
+	if _, err := (&http.Client{Transport: transport}).Do(req); err == nil {
+		t.Fatal("Expected request to fail")
+	}
+
+	found := false
+	for name, content := range readDumps(t, dir) {
+		if strings.HasSuffix(name, "-response.txt") && strings.Contains(content, "request failed") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a response dump recording the request failure")
+	}
+}
+
+func TestNewTransport_InvalidDir(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+
+	if _, err := NewTransport(http.DefaultTransport, filepath.Join(file, "sub"), "testnod-api", "", true); err == nil {
+		t.Error("NewTransport() expected error when the directory can't be created")
+	}
+}
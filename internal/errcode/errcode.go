@@ -0,0 +1,91 @@
+package errcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Codes are part of the tool's interface: users grep for them and the docs
+// reference them, so never change or reuse one. HTTP failures use the
+// E_CREATE_<status> and E_UPLOAD_<status> forms built by HTTPStatus, e.g.
+// E_UPLOAD_403.
+const (
+	ValidateOpen        = "E_VALIDATE_OPEN"
+	ValidateNotXML      = "E_VALIDATE_NOT_XML"
+	ValidateMalformed   = "E_VALIDATE_MALFORMED"
+	ValidateDTD         = "E_VALIDATE_DTD"
+	ValidateDepth       = "E_VALIDATE_DEPTH"
+	ValidateMaxTestcase = "E_VALIDATE_MAX_TESTCASES"
+	ValidateRoot        = "E_VALIDATE_ROOT"
+	ValidateWarnings    = "E_VALIDATE_WARNINGS"
+	ValidateEncoding    = "E_VALIDATE_ENCODING"
+	ValidateTime        = "E_VALIDATE_TIME"
+
+	CreateTimeout     = "E_CREATE_TIMEOUT"
+	CreateNetwork     = "E_CREATE_NETWORK"
+	CreateBadResponse = "E_CREATE_BAD_RESPONSE"
+	NoPresignedURL    = "E_CREATE_NO_PRESIGNED_URL"
+	NoCoverageURL     = "E_CREATE_NO_COVERAGE_URL"
+
+	UploadTimeout = "E_UPLOAD_TIMEOUT"
+	UploadNetwork = "E_UPLOAD_NETWORK"
+	UploadFile    = "E_UPLOAD_FILE"
+
+	CoverageInvalid = "E_COVERAGE_INVALID"
+)
+
+// Error attaches a stable code to an error without changing its message.
+type Error struct {
+	code string
+	err  error
+}
+
+func Wrap(code string, err error) error {
+	return &Error{code: code, err: err}
+}
+
+func Errorf(code string, format string, args ...any) error {
+	return &Error{code: code, err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string { return e.err.Error() }
+func (e *Error) Unwrap() error { return e.err }
+func (e *Error) Code() string  { return e.code }
+
+// Code returns the code of the first coded error in err's chain, or "" if
+// there is none.
+func Code(err error) string {
+	var coded interface{ Code() string }
+	if errors.As(err, &coded) {
+		return coded.Code()
+	}
+	return ""
+}
+
+// HTTPStatus is the code for a step ("E_CREATE" or "E_UPLOAD") failing with
+// an HTTP status.
+func HTTPStatus(step string, status int) string {
+	return fmt.Sprintf("%s_%d", step, status)
+}
+
+// IsTimeout reports whether err is a network or context timeout, as opposed
+// to another failure to reach the server.
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// Format puts err's code, if it has one, in front of its message, e.g.
+// "[E_UPLOAD_403] failed to upload file: ...". With color the code is red.
+func Format(err error, color bool) string {
+	code := Code(err)
+	if code == "" {
+		return err.Error()
+	}
+	if color {
+		return fmt.Sprintf("\x1b[31m[%s]\x1b[0m %s", code, err)
+	}
+	return fmt.Sprintf("[%s] %s", code, err)
+}
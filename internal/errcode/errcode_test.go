@@ -0,0 +1,69 @@
+package errcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	err := Errorf(ValidateRoot, "file does not contain a <testsuite> or <testsuites> element")
+	wrapped := fmt.Errorf("pre-upload hook: %w", err)
+
+	if got := Code(wrapped); got != ValidateRoot {
+		t.Errorf("Code() = %q, want %q", got, ValidateRoot)
+	}
+	if wrapped.Error() != "pre-upload hook: file does not contain a <testsuite> or <testsuites> element" {
+		t.Errorf("Error() = %q, want the message unchanged", wrapped.Error())
+	}
+	if got := Code(errors.New("plain")); got != "" {
+		t.Errorf("Code() = %q for an uncoded error, want empty", got)
+	}
+
+	cause := errors.New("cause")
+	if !errors.Is(Wrap(UploadFile, cause), cause) {
+		t.Error("Expected Wrap to keep the cause in the chain")
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	if got := HTTPStatus("E_UPLOAD", http.StatusForbidden); got != "E_UPLOAD_403" {
+		t.Errorf("HTTPStatus() = %q, want E_UPLOAD_403", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	err := Errorf(HTTPStatus("E_UPLOAD", 403), "failed to upload file: status 403")
+
+	if got := Format(err, false); got != "[E_UPLOAD_403] failed to upload file: status 403" {
+		t.Errorf("Format() = %q", got)
+	}
+	if got := Format(err, true); got != "\x1b[31m[E_UPLOAD_403]\x1b[0m failed to upload file: status 403" {
+		t.Errorf("Format() with color = %q", got)
+	}
+	if got := Format(errors.New("plain"), true); got != "plain" {
+		t.Errorf("Format() of an uncoded error = %q, want the message alone", got)
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := (&http.Client{Timeout: 10 * time.Millisecond}).Get(server.URL)
+	if !IsTimeout(err) {
+		t.Errorf("IsTimeout(%v) = false, want true", err)
+	}
+	if !IsTimeout(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)) {
+		t.Error("IsTimeout() = false for a deadline, want true")
+	}
+	if IsTimeout(errors.New("connection refused")) {
+		t.Error("IsTimeout() = true for another error, want false")
+	}
+}
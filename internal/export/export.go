@@ -0,0 +1,111 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+
+	"testnod-uploader/internal/junit"
+)
+
+// Report is the simplified JSON schema produced by -export json. Counts use
+// the suite's declared attributes, falling back to counting its testcases.
+type Report struct {
+	Suites []Suite `json:"suites"`
+}
+
+type Suite struct {
+	Name      string     `json:"name"`
+	Tests     int        `json:"tests"`
+	Failures  int        `json:"failures"`
+	Errors    int        `json:"errors"`
+	Skipped   int        `json:"skipped"`
+	Time      float64    `json:"time"`
+	Timestamp string     `json:"timestamp,omitempty"`
+	Testcases []Testcase `json:"testcases,omitempty"`
+	Suites    []Suite    `json:"suites,omitempty"`
+}
+
+type Testcase struct {
+	Name      string       `json:"name"`
+	Classname string       `json:"classname"`
+	Time      float64      `json:"time"`
+	Status    junit.Status `json:"status"`
+	Message   string       `json:"message,omitempty"`
+	Details   string       `json:"details,omitempty"`
+}
+
+func NewReport(doc *junit.Document) Report {
+	report := Report{Suites: []Suite{}}
+	for _, s := range doc.Suites {
+		report.Suites = append(report.Suites, newSuite(s))
+	}
+	return report
+}
+
+func JSON(doc *junit.Document) ([]byte, error) {
+	return json.MarshalIndent(NewReport(doc), "", "  ")
+}
+
+func newSuite(s junit.Suite) Suite {
+	suite := Suite{
+		Name:      s.Name,
+		Timestamp: s.Timestamp,
+	}
+	suite.Time, _ = junit.ParseTime(s.Time)
+
+	var failures, errors, skipped int
+	for _, tc := range s.Testcases {
+		testcase := newTestcase(tc)
+		switch testcase.Status {
+		case junit.StatusFailed:
+			failures++
+		case junit.StatusErrored:
+			errors++
+		case junit.StatusSkipped:
+			skipped++
+		}
+		suite.Testcases = append(suite.Testcases, testcase)
+	}
+
+	for _, nested := range s.Suites {
+		suite.Suites = append(suite.Suites, newSuite(nested))
+	}
+
+	suite.Tests = countOr(s.Tests, len(s.Testcases))
+	suite.Failures = countOr(s.Failures, failures)
+	suite.Errors = countOr(s.Errors, errors)
+	suite.Skipped = countOr(s.Skipped, skipped)
+	return suite
+}
+
+func newTestcase(tc junit.Testcase) Testcase {
+	testcase := Testcase{
+		Name:      tc.Name,
+		Classname: tc.Classname,
+		Status:    tc.Status(),
+	}
+	testcase.Time, _ = junit.ParseTime(tc.Time)
+
+	var result *junit.Result
+	switch testcase.Status {
+	case junit.StatusErrored:
+		result = &tc.Errors[0]
+	case junit.StatusFailed:
+		result = &tc.Failures[0]
+	case junit.StatusSkipped:
+		result = &tc.Skipped[0]
+	}
+	if result != nil {
+		testcase.Message = result.Message
+		testcase.Details = strings.TrimSpace(result.Text)
+	}
+
+	return testcase
+}
+
+func countOr(declared string, counted int) int {
+	if n, ok := junit.ParseCount(declared); ok {
+		return n
+	}
+	return counted
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+func exportFile(t *testing.T, path string) Report {
+	t.Helper()
+	doc, err := junit.ParseFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", path, err)
+	}
+
+	data, err := JSON(doc)
+	if err != nil {
+		t.Fatalf("JSON() unexpected error: %v", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("JSON() produced invalid JSON: %v\n%s", err, data)
+	}
+	return report
+}
+
+func TestJSON_SingleSuite(t *testing.T) {
+	got := exportFile(t, "../../testdata/valid_junit.xml")
+
+	want := Report{Suites: []Suite{{
+		Name:     "com.example.TestSuite",
+		Tests:    3,
+		Failures: 1,
+		Errors:   0,
+		Skipped:  1,
+		Time:     0.123,
+		Testcases: []Testcase{
+			{Name: "testSuccess", Classname: "com.example.TestSuite", Time: 0.001, Status: junit.StatusPassed},
+			{
+				Name:      "testFailure",
+				Classname: "com.example.TestSuite",
+				Time:      0.002,
+				Status:    junit.StatusFailed,
+				Message:   "Expected true but was false",
+				Details:   "java.lang.AssertionError: Expected true but was false\n      at com.example.TestSuite.testFailure(TestSuite.java:15)",
+			},
+			{Name: "testSkipped", Classname: "com.example.TestSuite", Time: 0, Status: junit.StatusSkipped},
+		},
+	}}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON() mismatch.\nGot:      %+v\nExpected: %+v", got, want)
+	}
+}
+
+func TestJSON_MultipleSuites(t *testing.T) {
+	got := exportFile(t, "../../testdata/valid_junit_multiple_suites.xml")
+
+	want := Report{Suites: []Suite{
+		{
+			Name:  "com.example.FirstTest",
+			Tests: 2,
+			Time:  0.05,
+			Testcases: []Testcase{
+				{Name: "test1", Classname: "com.example.FirstTest", Time: 0.025, Status: junit.StatusPassed},
+				{Name: "test2", Classname: "com.example.FirstTest", Time: 0.025, Status: junit.StatusPassed},
+			},
+		},
+		{
+			Name:  "com.example.SecondTest",
+			Tests: 1,
+			Time:  0.03,
+			Testcases: []Testcase{
+				{Name: "test3", Classname: "com.example.SecondTest", Time: 0.03, Status: junit.StatusPassed},
+			},
+		},
+	}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON() mismatch.\nGot:      %+v\nExpected: %+v", got, want)
+	}
+}
+
+func TestJSON_CountsFallBackToTestcases(t *testing.T) {
+	doc, err := junit.Parse(strings.NewReader(`<testsuites>
+  <testsuite name="outer">
+    <testsuite name="inner">
+      <testcase name="a" classname="c"><error message="boom"/></testcase>
+      <testcase name="b" classname="c"/>
+    </testsuite>
+  </testsuite>
+</testsuites>`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	report := NewReport(doc)
+	inner := report.Suites[0].Suites[0]
+	if inner.Tests != 2 || inner.Errors != 1 || inner.Failures != 0 {
+		t.Errorf("Expected counts computed from testcases, got %+v", inner)
+	}
+	if inner.Testcases[0].Message != "boom" {
+		t.Errorf("Expected error message to be exported, got %q", inner.Testcases[0].Message)
+	}
+}
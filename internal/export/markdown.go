@@ -0,0 +1,87 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"testnod-uploader/internal/junit"
+)
+
+// Markdown renders the documents as a Markdown summary for a pull request
+// comment: a table with a row per suite, nested suites included, followed by
+// a list of the failed and errored testcases.
+func Markdown(docs ...*junit.Document) []byte {
+	var rows []Suite
+	var failing []failingTestcase
+	for _, doc := range docs {
+		for _, s := range NewReport(doc).Suites {
+			flatten(s, "", &rows, &failing)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("| Suite | Tests | Failures | Errors | Time |\n")
+	b.WriteString("|-------|------:|---------:|-------:|-----:|\n")
+	for _, s := range rows {
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %.3fs |\n", markdownCell(s.Name), s.Tests, s.Failures, s.Errors, s.Time)
+	}
+
+	b.WriteString("\n### Failing tests\n\n")
+	if len(failing) == 0 {
+		b.WriteString("No failing tests.\n")
+	}
+	for _, f := range failing {
+		fmt.Fprintf(&b, "- `%s` (%s", testcaseName(f.Testcase), markdownCell(f.suite))
+		if f.Status == junit.StatusErrored {
+			b.WriteString(", error")
+		}
+		b.WriteString(")")
+		if message := firstLine(f.Message); message != "" {
+			b.WriteString(": " + markdownCell(message))
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+type failingTestcase struct {
+	Testcase
+	suite string
+}
+
+// flatten appends s and its nested suites, named "outer / inner", to rows,
+// and their failed and errored testcases to failing.
+func flatten(s Suite, parent string, rows *[]Suite, failing *[]failingTestcase) {
+	if parent != "" {
+		s.Name = parent + " / " + s.Name
+	}
+	*rows = append(*rows, s)
+	for _, tc := range s.Testcases {
+		if tc.Status == junit.StatusFailed || tc.Status == junit.StatusErrored {
+			*failing = append(*failing, failingTestcase{tc, s.Name})
+		}
+	}
+	for _, nested := range s.Suites {
+		flatten(nested, s.Name, rows, failing)
+	}
+}
+
+func testcaseName(tc Testcase) string {
+	name := tc.Name
+	if tc.Classname != "" {
+		name = tc.Classname + "." + tc.Name
+	}
+	return strings.ReplaceAll(name, "`", "'")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// markdownCell keeps text from breaking out of a table cell or list item.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
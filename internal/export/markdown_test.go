@@ -0,0 +1,68 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+func TestMarkdown(t *testing.T) {
+	single, err := junit.ParseFile("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	multiple, err := junit.ParseFile("../../testdata/valid_junit_multiple_suites.xml")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	got := string(Markdown(multiple, single))
+	want := `| Suite | Tests | Failures | Errors | Time |
+|-------|------:|---------:|-------:|-----:|
+| com.example.FirstTest | 2 | 0 | 0 | 0.050s |
+| com.example.SecondTest | 1 | 0 | 0 | 0.030s |
+| com.example.TestSuite | 3 | 1 | 0 | 0.123s |
+
+### Failing tests
+
+- ` + "`com.example.TestSuite.testFailure`" + ` (com.example.TestSuite): Expected true but was false
+`
+	if got != want {
+		t.Errorf("Markdown() mismatch.\nGot:\n%s\nExpected:\n%s", got, want)
+	}
+}
+
+func TestMarkdown_NestedSuitesAndEscaping(t *testing.T) {
+	doc, err := junit.Parse(strings.NewReader(`<testsuites>
+  <testsuite name="outer">
+    <testsuite name="a|b">
+      <testcase name="x" classname="c"><error message="boom&#10;second line"/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	got := string(Markdown(doc))
+	for _, want := range []string{
+		"| outer | 0 | 0 | 0 | 0.000s |\n",
+		`| outer / a\|b | 1 | 0 | 1 | 0.000s |` + "\n",
+		"- `c.x` (outer / a\\|b, error): boom\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Markdown() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestMarkdown_NoFailures(t *testing.T) {
+	doc, err := junit.ParseFile("../../testdata/valid_junit_multiple_suites.xml")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := string(Markdown(doc)); !strings.HasSuffix(got, "### Failing tests\n\nNo failing tests.\n") {
+		t.Errorf("Markdown() = %q, want no failing tests listed", got)
+	}
+}
@@ -0,0 +1,40 @@
+package ghannotate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Enabled reports whether the process runs inside GitHub Actions, which sets
+// GITHUB_ACTIONS=true for every step.
+func Enabled(getenv func(string) string) bool {
+	return getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Error writes an ::error:: workflow command for message. A non-empty file
+// attaches the annotation to that file.
+func Error(w io.Writer, file, message string) {
+	if file == "" {
+		fmt.Fprintf(w, "::error::%s\n", escapeData(message))
+		return
+	}
+	fmt.Fprintf(w, "::error file=%s::%s\n", escapeProperty(file), escapeData(message))
+}
+
+// Notice writes a ::notice:: workflow command for message.
+func Notice(w io.Writer, message string) {
+	fmt.Fprintf(w, "::notice::%s\n", escapeData(message))
+}
+
+// escapeData escapes a workflow command's message, so that multi-line
+// messages stay one command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a workflow command property value, which
+// additionally can't contain the ':' and ',' separators.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
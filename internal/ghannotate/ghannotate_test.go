@@ -0,0 +1,45 @@
+package ghannotate
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		file    string
+		message string
+		want    string
+	}{
+		{"without file", "", "upload failed", "::error::upload failed\n"},
+		{"with file", "reports/junit.xml", "[E_UPLOAD_500] failed to upload file", "::error file=reports/junit.xml::[E_UPLOAD_500] failed to upload file\n"},
+		{"multi-line message", "", "line 1\r\nline 2: 100%", "::error::line 1%0D%0Aline 2: 100%25\n"},
+		{"file with separators", "C:\\results,1.xml", "invalid", "::error file=C%3A\\results%2C1.xml::invalid\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			Error(&buf, tt.file, tt.message)
+			if buf.String() != tt.want {
+				t.Errorf("Error() wrote %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNotice(t *testing.T) {
+	var buf bytes.Buffer
+	Notice(&buf, "TestNod test run: https://testnod.example/runs/1")
+	if want := "::notice::TestNod test run: https://testnod.example/runs/1\n"; buf.String() != want {
+		t.Errorf("Notice() wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	for value, want := range map[string]bool{"true": true, "": false, "false": false} {
+		getenv := func(string) string { return value }
+		if got := Enabled(getenv); got != want {
+			t.Errorf("Enabled() with GITHUB_ACTIONS=%q = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gzipsniff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// magic is the first two bytes of every gzip stream.
+var magic = []byte{0x1f, 0x8b}
+
+// Reader returns a reader of r's decompressed content if r starts with the
+// gzip magic bytes, and of r itself otherwise. The file name plays no part,
+// so a gzipped file named results.xml is still read as XML. Nothing is
+// consumed from r beyond what the returned reader reads.
+func Reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !bytes.Equal(head, magic) {
+		return br, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip content: %w", err)
+	}
+	return gz, nil
+}
+
+// IsGzip reports whether the file at path starts with the gzip magic bytes.
+func IsGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, len(magic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return bytes.Equal(head[:n], magic), nil
+}
+
+// Decompress writes the decompressed content of the gzip file at path to a
+// temporary XML file and returns its path. The caller removes it.
+func Decompress(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+
+	out, err := os.CreateTemp("", "testnod-decompressed-*.xml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = io.Copy(out, gz)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return out.Name(), nil
+}
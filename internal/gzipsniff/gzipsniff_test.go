@@ -0,0 +1,93 @@
+package gzipsniff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	xml := []byte("<testsuites></testsuites>")
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "plain", input: xml},
+		{name: "gzip", input: gzipBytes(t, xml)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Reader(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Reader() error = %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, xml) {
+				t.Errorf("Reader() content = %q, want %q", got, xml)
+			}
+		})
+	}
+
+	t.Run("short input", func(t *testing.T) {
+		r, err := Reader(bytes.NewReader([]byte{0x1f}))
+		if err != nil {
+			t.Fatalf("Reader() error = %v", err)
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, []byte{0x1f}) {
+			t.Errorf("Reader() content = %v, want the input unchanged", got)
+		}
+	})
+
+	t.Run("corrupt gzip header", func(t *testing.T) {
+		if _, err := Reader(bytes.NewReader([]byte{0x1f, 0x8b, 0x00})); err == nil {
+			t.Error("Reader() expected an error for a truncated gzip header")
+		}
+	})
+}
+
+func TestIsGzipAndDecompress(t *testing.T) {
+	dir := t.TempDir()
+	xml := []byte("<testsuites></testsuites>")
+	plainPath := filepath.Join(dir, "plain.xml")
+	gzipPath := filepath.Join(dir, "compressed.xml")
+	os.WriteFile(plainPath, xml, 0o644)
+	os.WriteFile(gzipPath, gzipBytes(t, xml), 0o644)
+
+	if compressed, err := IsGzip(plainPath); err != nil || compressed {
+		t.Errorf("IsGzip(plain) = %v, %v, want false", compressed, err)
+	}
+	if compressed, err := IsGzip(gzipPath); err != nil || !compressed {
+		t.Errorf("IsGzip(gzip) = %v, %v, want true", compressed, err)
+	}
+	if _, err := IsGzip(filepath.Join(dir, "missing.xml")); err == nil {
+		t.Error("IsGzip() expected an error for a missing file")
+	}
+
+	decompressedPath, err := Decompress(gzipPath)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	defer os.Remove(decompressedPath)
+	if got, _ := os.ReadFile(decompressedPath); !bytes.Equal(got, xml) {
+		t.Errorf("Decompress() content = %q, want %q", got, xml)
+	}
+}
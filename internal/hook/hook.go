@@ -0,0 +1,40 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"testnod-uploader/internal/debug"
+)
+
+// Placeholder is replaced with the path of the file in a hook command.
+const Placeholder = "{file}"
+
+// Run runs command through the system shell, sh or cmd.exe on Windows, with
+// every {file} replaced by filePath, quoted for that shell. It returns the
+// combined stdout and stderr, and an error if the command exits non-zero or
+// runs longer than timeout.
+func Run(command string, filePath string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	expanded := strings.ReplaceAll(command, Placeholder, quote(filePath))
+	debug.Log("running hook: %s", expanded)
+
+	cmd := shellCommand(ctx, expanded)
+	// Don't wait for background processes the hook left holding the output
+	// pipes once the hook itself has been killed.
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("hook timed out after %s", timeout)
+	}
+	if err != nil {
+		return output, fmt.Errorf("hook failed: %w", err)
+	}
+	return output, nil
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package hook
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+func TestRunMutatesFile(t *testing.T) {
+	path := writeFile(t, "it's results.xml", `<testsuite><testcase name="a" classname="secret.A"/></testsuite>`)
+
+	output, err := Run(`sed -i.bak 's/secret/public/' {file} && echo cleaned {file}`, path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v\n%s", err, output)
+	}
+
+	if !strings.Contains(string(output), "cleaned "+path) {
+		t.Errorf("Run() output = %q, expected the hook's output with the path", output)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `classname="public.A"`) {
+		t.Errorf("Expected the hook to modify the file, got:\n%s", data)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	path := writeFile(t, "results.xml", "<testsuite/>")
+
+	output, err := Run(`echo "refusing to upload {file}" >&2; exit 3`, path, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Run() error = %v, expected exit status 3", err)
+	}
+	if !strings.Contains(string(output), "refusing to upload") {
+		t.Errorf("Run() output = %q, expected stderr to be captured", output)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	path := writeFile(t, "results.xml", "<testsuite/>")
+
+	start := time.Now()
+	_, err := Run("sleep 10", path, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() error = %v, expected a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %s, expected the hook to be killed", elapsed)
+	}
+}
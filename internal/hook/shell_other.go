@@ -0,0 +1,19 @@
+//go:build !windows
+
+package hook
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// quote single-quotes s for sh, which takes everything between single quotes
+// literally.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,23 @@
+package hook
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand runs command with cmd.exe. The command line is passed as is:
+// exec's usual argument escaping would backslash-escape the quotes around the
+// file path, which cmd.exe doesn't understand. /S makes cmd.exe strip only
+// the outer pair of quotes, keeping the ones inside the command.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + command + `"`}
+	return cmd
+}
+
+// quote double-quotes s for cmd.exe. Windows paths can't contain double
+// quotes, so there's nothing to escape inside them.
+func quote(s string) string {
+	return `"` + s + `"`
+}
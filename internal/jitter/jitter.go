@@ -0,0 +1,39 @@
+package jitter
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go/v5"
+)
+
+var (
+	mu  sync.Mutex
+	rng = rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
+)
+
+// Seed reseeds the source RandomDelay draws from, so the retry delays that
+// follow are the same on every run with the same seed. Without it the source
+// is seeded from the clock.
+func Seed(seed uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	rng = rand.New(rand.NewPCG(seed, 0))
+}
+
+// RandomDelay is retry.RandomDelay drawing from the seedable source instead
+// of the global one: a random delay up to the retrier's MaxJitter.
+func RandomDelay(_ uint, _ error, config retry.DelayContext) time.Duration {
+	maxJitter := config.MaxJitter()
+	if maxJitter <= 0 {
+		return 0
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return time.Duration(rng.Int64N(int64(maxJitter)))
+}
+
+// Backoff is retry-go's default delay type, exponential backoff plus
+// jitter, with the jitter from RandomDelay.
+var Backoff = retry.CombineDelay(retry.BackOffDelay, RandomDelay)
@@ -0,0 +1,50 @@
+package jitter
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type delayContext struct{}
+
+func (delayContext) Delay() time.Duration     { return time.Second }
+func (delayContext) MaxJitter() time.Duration { return 100 * time.Millisecond }
+func (delayContext) MaxBackOffN() uint        { return 62 }
+func (delayContext) MaxDelay() time.Duration  { return 0 }
+
+func delays(seed uint64) []time.Duration {
+	Seed(seed)
+	var got []time.Duration
+	for n := uint(1); n <= 5; n++ {
+		got = append(got, Backoff(n, nil, delayContext{}))
+	}
+	return got
+}
+
+func TestSeed(t *testing.T) {
+	first := delays(42)
+	if second := delays(42); !slices.Equal(first, second) {
+		t.Errorf("delays with seed 42 = %v then %v, want the same sequence", first, second)
+	}
+	if other := delays(43); slices.Equal(first, other) {
+		t.Errorf("delays with seeds 42 and 43 are both %v, want them to diverge", first)
+	}
+
+	for i, d := range first {
+		base := time.Second << i
+		if d < base || d >= base+100*time.Millisecond {
+			t.Errorf("delay %d = %s, want %s plus under 100ms of jitter", i+1, d, base)
+		}
+	}
+}
+
+func TestRandomDelayWithoutJitter(t *testing.T) {
+	if d := RandomDelay(1, nil, noJitter{}); d != 0 {
+		t.Errorf("RandomDelay() = %s with no MaxJitter, want 0", d)
+	}
+}
+
+type noJitter struct{ delayContext }
+
+func (noJitter) MaxJitter() time.Duration { return 0 }
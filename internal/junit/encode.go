@@ -0,0 +1,153 @@
+package junit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Marshal serializes the document as indented XML with an XML declaration.
+// Bare documents are written with their single <testsuite> as the root, so a
+// parse and Marshal round trip keeps the file's shape.
+func Marshal(doc *Document) ([]byte, error) {
+	var root any = doc
+	if doc.Bare && len(doc.Suites) == 1 {
+		root = &doc.Suites[0]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	for _, comment := range doc.Prolog {
+		buf.WriteString("<!--" + comment + "-->\n")
+	}
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// Canonicalize sorts every element's unknown attributes by name so that
+// Marshal produces identical bytes for files that only differ in attribute
+// order or formatting. Known attributes are always written in a fixed order.
+// The content of elements outside the JUnit schema is kept verbatim.
+func Canonicalize(doc *Document) {
+	doc.forEachAttrs(func(attrs []xml.Attr) {
+		sort.SliceStable(attrs, func(i, j int) bool {
+			if attrs[i].Name.Space != attrs[j].Name.Space {
+				return attrs[i].Name.Space < attrs[j].Name.Space
+			}
+			return attrs[i].Name.Local < attrs[j].Name.Local
+		})
+	})
+}
+
+// restorePrefixes undoes the namespace translation encoding/xml applies to
+// attribute and element names while decoding. Left alone, Marshal would write
+// xsi:schemaLocation with a generated prefix bound to the schema URL.
+func (d *Document) restorePrefixes() {
+	prefixes := map[string]string{}
+	d.forEachAttrs(func(attrs []xml.Attr) {
+		for _, attr := range attrs {
+			if attr.Name.Space == "xmlns" {
+				prefixes[attr.Value] = attr.Name.Local
+			}
+		}
+	})
+
+	d.forEachAttrs(func(attrs []xml.Attr) {
+		for i, attr := range attrs {
+			if attr.Name.Space == "xmlns" {
+				attrs[i].Name = xml.Name{Local: "xmlns:" + attr.Name.Local}
+				continue
+			}
+			attrs[i].Name = withPrefix(attr.Name, prefixes)
+		}
+	})
+
+	d.forEachExtra(func(e *Element) {
+		e.XMLName = withPrefix(e.XMLName, prefixes)
+	})
+}
+
+func withPrefix(name xml.Name, prefixes map[string]string) xml.Name {
+	// encoding/xml writes the xml namespace and the default namespace
+	// correctly on its own.
+	if name.Space == "" || name.Space == xmlNamespace {
+		return name
+	}
+	if prefix, ok := prefixes[name.Space]; ok {
+		return xml.Name{Local: prefix + ":" + name.Local}
+	}
+	return name
+}
+
+// forEachExtra calls fn for every element outside the JUnit schema. Their
+// content is kept as raw XML, so only the outermost element is visited.
+func (d *Document) forEachExtra(fn func(e *Element)) {
+	visit := func(extra []Element) {
+		for i := range extra {
+			fn(&extra[i])
+		}
+	}
+
+	visit(d.Extra)
+	d.WalkSuites(func(s *Suite) {
+		visit(s.Extra)
+		for i := range s.Testcases {
+			visit(s.Testcases[i].Extra)
+		}
+	})
+}
+
+// forEachAttrs calls fn with the unknown attributes of every element in the
+// document that has a typed representation, and of the outermost elements
+// outside the JUnit schema.
+func (d *Document) forEachAttrs(fn func(attrs []xml.Attr)) {
+	fn(d.Attrs)
+	d.forEachExtra(func(e *Element) { fn(e.Attrs) })
+	d.WalkSuites(func(s *Suite) {
+		fn(s.Attrs)
+		s.Properties.forEachAttrs(fn)
+		forEachOutputAttrs(s.SystemOut, fn)
+		forEachOutputAttrs(s.SystemErr, fn)
+
+		for i := range s.Testcases {
+			tc := &s.Testcases[i]
+			fn(tc.Attrs)
+			tc.Properties.forEachAttrs(fn)
+			for j := range tc.Failures {
+				fn(tc.Failures[j].Attrs)
+			}
+			for j := range tc.Errors {
+				fn(tc.Errors[j].Attrs)
+			}
+			for j := range tc.Skipped {
+				fn(tc.Skipped[j].Attrs)
+			}
+			forEachOutputAttrs(tc.SystemOut, fn)
+			forEachOutputAttrs(tc.SystemErr, fn)
+		}
+	})
+}
+
+func (p *Properties) forEachAttrs(fn func(attrs []xml.Attr)) {
+	if p == nil {
+		return
+	}
+	for i := range p.Properties {
+		fn(p.Properties[i].Attrs)
+	}
+}
+
+func forEachOutputAttrs(outputs []Output, fn func(attrs []xml.Attr)) {
+	for i := range outputs {
+		fn(outputs[i].Attrs)
+	}
+}
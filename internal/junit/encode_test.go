@@ -0,0 +1,181 @@
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+func marshalString(t *testing.T, input string) string {
+	t.Helper()
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+	Canonicalize(doc)
+
+	data, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	return string(data)
+}
+
+func TestCanonicalizeLogicallyEqualInputs(t *testing.T) {
+	first := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="all">
+  <testsuite name="suite" tests="2" failures="1" id="7" package="com.example">
+    <testcase name="a" classname="A" time="0.1"/>
+    <testcase name="b" classname="A" time="0.2">
+      <failure message="boom" type="AssertionError"><![CDATA[x < y & z]]></failure>
+    </testcase>
+    <system-out>hello</system-out>
+  </testsuite>
+</testsuites>`
+
+	second := `<testsuites name='all'><testsuite package="com.example" id="7" failures="1" tests="2" name="suite">
+<testcase time="0.1" classname="A" name="a"></testcase>
+		<testcase classname="A" name="b" time="0.2"><failure type="AssertionError" message="boom">x &lt; y &amp; z</failure></testcase>
+<system-out><![CDATA[hello]]></system-out></testsuite></testsuites>`
+
+	got1, got2 := marshalString(t, first), marshalString(t, second)
+	if got1 != got2 {
+		t.Errorf("Expected identical output for logically equal inputs:\n%s\n---\n%s", got1, got2)
+	}
+}
+
+func TestMarshalPreservesContent(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="suite" tests="1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="junit.xsd">
+  <properties>
+    <property name="env" value="ci"/>
+  </properties>
+  <testcase name="a" classname="A" custom="yes">
+    <error message="oops"><![CDATA[trace with ]]]]><![CDATA[> inside]]></error>
+    <rerunFailure message="flaky"><stackTrace>line 1</stackTrace></rerunFailure>
+  </testcase>
+  <testsuite name="nested">
+    <testcase name="b" classname="B"/>
+  </testsuite>
+</testsuite>`
+
+	got := marshalString(t, input)
+
+	for _, want := range []string{
+		`<testsuite name="suite" tests="1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="junit.xsd">`,
+		`<property name="env" value="ci"></property>`,
+		`<testcase name="a" classname="A" custom="yes">`,
+		`trace with ]]`,
+		`> inside`,
+		`<rerunFailure message="flaky"><stackTrace>line 1</stackTrace></rerunFailure>`,
+		`<testsuite name="nested">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Marshal() output missing %q:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "<testsuites") {
+		t.Errorf("Expected a bare document to keep its <testsuite> root:\n%s", got)
+	}
+
+	// The output must parse back to the same document.
+	doc, err := Parse(strings.NewReader(got))
+	if err != nil {
+		t.Fatalf("Parse() of marshaled output failed: %v\n%s", err, got)
+	}
+	if text := doc.Suites[0].Testcases[0].Errors[0].Text; text != "trace with ]]> inside" {
+		t.Errorf("Error text = %q, want %q", text, "trace with ]]> inside")
+	}
+	if again := marshalString(t, got); again != got {
+		t.Errorf("Expected canonical output to be stable:\n%s\n---\n%s", got, again)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "repeated system-out and system-err",
+			input: `<testsuite name="suite">
+  <testcase name="a" classname="A">
+    <system-out>attempt 1</system-out>
+    <system-out>attempt 2</system-out>
+    <system-err>warn 1</system-err>
+    <system-err>warn 2</system-err>
+  </testcase>
+  <system-out>setup</system-out>
+  <system-out>teardown</system-out>
+</testsuite>`,
+			want: []string{
+				`<system-out><![CDATA[attempt 1]]></system-out>`,
+				`<system-out><![CDATA[attempt 2]]></system-out>`,
+				`<system-err><![CDATA[warn 1]]></system-err>`,
+				`<system-err><![CDATA[warn 2]]></system-err>`,
+				`<system-out><![CDATA[setup]]></system-out>`,
+				`<system-out><![CDATA[teardown]]></system-out>`,
+			},
+		},
+		{
+			name: "repeated skipped",
+			input: `<testsuite name="suite">
+  <testcase name="a" classname="A">
+    <skipped message="first reason"/>
+    <skipped message="second reason"/>
+  </testcase>
+</testsuite>`,
+			want: []string{
+				`<skipped message="first reason"></skipped>`,
+				`<skipped message="second reason"></skipped>`,
+			},
+		},
+		{
+			name: "comments",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<!-- generated by the test runner -->
+<testsuites>
+  <!-- run 42 -->
+  <testsuite name="suite">
+    <!-- suite note -->
+    <testcase name="a" classname="A">
+      <!-- testcase note -->
+    </testcase>
+  </testsuite>
+</testsuites>`,
+			want: []string{
+				`<!-- generated by the test runner -->`,
+				`<!-- run 42 -->`,
+				`<!-- suite note -->`,
+				`<!-- testcase note -->`,
+			},
+		},
+		{
+			name:    "missing classname",
+			input:   `<testsuite name="suite"><testcase name="a"/></testsuite>`,
+			want:    []string{`<testcase name="a"></testcase>`},
+			notWant: []string{`classname`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := marshalString(t, tt.input)
+			for _, want := range tt.want {
+				if strings.Count(got, want) != 1 {
+					t.Errorf("Marshal() output should contain %q once:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("Marshal() output should not contain %q:\n%s", notWant, got)
+				}
+			}
+			if again := marshalString(t, got); again != got {
+				t.Errorf("Expected a second round trip to be stable:\n%s\n---\n%s", got, again)
+			}
+		})
+	}
+}
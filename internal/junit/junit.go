@@ -0,0 +1,246 @@
+package junit
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/gzipsniff"
+)
+
+// Document is a parsed JUnit XML file. Files with a bare <testsuite> root are
+// represented as a document with a single suite and Bare set to true.
+//
+// Comments inside a typed element are kept in its Comment field. encoding/xml
+// joins all of an element's comments into that one field, and Marshal writes
+// it ahead of the element's children.
+type Document struct {
+	XMLName  xml.Name   `xml:"testsuites"`
+	Name     string     `xml:"name,attr,omitempty"`
+	Tests    string     `xml:"tests,attr,omitempty"`
+	Failures string     `xml:"failures,attr,omitempty"`
+	Errors   string     `xml:"errors,attr,omitempty"`
+	Skipped  string     `xml:"skipped,attr,omitempty"`
+	Time     string     `xml:"time,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Comment  string     `xml:",comment"`
+	Suites   []Suite    `xml:"testsuite"`
+	Extra    []Element  `xml:",any"`
+
+	Bare bool `xml:"-"`
+	// Prolog holds the comments before the root element, which Marshal
+	// writes back after the XML declaration.
+	Prolog []string `xml:"-"`
+}
+
+// Suite is a <testsuite> element. Suites may be nested.
+type Suite struct {
+	XMLName    xml.Name    `xml:"testsuite"`
+	Name       string      `xml:"name,attr,omitempty"`
+	Tests      string      `xml:"tests,attr,omitempty"`
+	Failures   string      `xml:"failures,attr,omitempty"`
+	Errors     string      `xml:"errors,attr,omitempty"`
+	Skipped    string      `xml:"skipped,attr,omitempty"`
+	Time       string      `xml:"time,attr,omitempty"`
+	Timestamp  string      `xml:"timestamp,attr,omitempty"`
+	Hostname   string      `xml:"hostname,attr,omitempty"`
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Comment    string      `xml:",comment"`
+	Properties *Properties `xml:"properties"`
+	Testcases  []Testcase  `xml:"testcase"`
+	Suites     []Suite     `xml:"testsuite"`
+	SystemOut  []Output    `xml:"system-out"`
+	SystemErr  []Output    `xml:"system-err"`
+	Extra      []Element   `xml:",any"`
+}
+
+// Testcase is a <testcase> element. Elements that may repeat, such as
+// <system-out> written once per retry, are kept as slices in document order.
+type Testcase struct {
+	XMLName    xml.Name    `xml:"testcase"`
+	Name       string      `xml:"name,attr"`
+	Classname  string      `xml:"classname,attr,omitempty"`
+	Time       string      `xml:"time,attr,omitempty"`
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Comment    string      `xml:",comment"`
+	Properties *Properties `xml:"properties"`
+	Failures   []Result    `xml:"failure"`
+	Errors     []Result    `xml:"error"`
+	Skipped    []Result    `xml:"skipped"`
+	SystemOut  []Output    `xml:"system-out"`
+	SystemErr  []Output    `xml:"system-err"`
+	Extra      []Element   `xml:",any"`
+}
+
+// Result is a <failure>, <error> or <skipped> element.
+type Result struct {
+	Message string     `xml:"message,attr,omitempty"`
+	Type    string     `xml:"type,attr,omitempty"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",cdata"`
+}
+
+// Output is a <system-out> or <system-err> element.
+type Output struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Text  string     `xml:",cdata"`
+}
+
+type Properties struct {
+	Properties []Property `xml:"property"`
+}
+
+type Property struct {
+	Name  string     `xml:"name,attr"`
+	Value string     `xml:"value,attr,omitempty"`
+	Attrs []xml.Attr `xml:",any,attr"`
+	Text  string     `xml:",chardata"`
+}
+
+// Element holds any element the typed structs don't know about, so it
+// survives a parse and re-serialize round trip untouched.
+type Element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+func ParseFile(filePath string) (*Document, error) {
+	debug.Log("parsing file: %s", filePath)
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	content, err := gzipsniff.Reader(f)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+func Parse(r io.Reader) (*Document, error) {
+	decoder := xml.NewDecoder(r)
+	var prolog []string
+
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error parsing XML: %w", err)
+		}
+
+		if c, ok := t.(xml.Comment); ok {
+			prolog = append(prolog, string(c))
+			continue
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "testsuites":
+			var doc Document
+			if err := decoder.DecodeElement(&doc, &se); err != nil {
+				return nil, fmt.Errorf("error parsing XML: %w", err)
+			}
+			doc.Prolog = prolog
+			doc.restorePrefixes()
+			return &doc, nil
+		case "testsuite":
+			var suite Suite
+			if err := decoder.DecodeElement(&suite, &se); err != nil {
+				return nil, fmt.Errorf("error parsing XML: %w", err)
+			}
+			doc := &Document{Suites: []Suite{suite}, Bare: true, Prolog: prolog}
+			doc.restorePrefixes()
+			return doc, nil
+		default:
+			return nil, fmt.Errorf("unexpected root element <%s>, expected <testsuite> or <testsuites>", se.Name.Local)
+		}
+	}
+
+	return nil, fmt.Errorf("file does not contain a <testsuite> or <testsuites> element")
+}
+
+// WalkSuites calls fn for every suite in the document, including nested ones,
+// in document order.
+func (d *Document) WalkSuites(fn func(s *Suite)) {
+	for i := range d.Suites {
+		walkSuite(&d.Suites[i], fn)
+	}
+}
+
+// WalkTestcases calls fn for every testcase in the document, together with
+// the suite that directly contains it, in document order.
+func (d *Document) WalkTestcases(fn func(s *Suite, tc *Testcase)) {
+	d.WalkSuites(func(s *Suite) {
+		for i := range s.Testcases {
+			fn(s, &s.Testcases[i])
+		}
+	})
+}
+
+func walkSuite(s *Suite, fn func(s *Suite)) {
+	fn(s)
+	for i := range s.Suites {
+		walkSuite(&s.Suites[i], fn)
+	}
+}
+
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusErrored Status = "errored"
+	StatusSkipped Status = "skipped"
+)
+
+// Status reports the outcome of the testcase. A testcase carrying both an
+// <error> and a <failure> counts as errored.
+func (tc Testcase) Status() Status {
+	switch {
+	case len(tc.Errors) > 0:
+		return StatusErrored
+	case len(tc.Failures) > 0:
+		return StatusFailed
+	case len(tc.Skipped) > 0:
+		return StatusSkipped
+	}
+	return StatusPassed
+}
+
+// ParseCount parses a count attribute such as tests="3". The second return
+// value is false when the attribute is absent or not an integer.
+func ParseCount(value string) (int, bool) {
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// ParseTime parses a time attribute in seconds. The second return value is
+// false when the attribute is absent or not a number.
+func ParseTime(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,203 @@
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="all" tests="3">
+  <testsuite name="com.example.MyTest" tests="3" failures="1" errors="0" skipped="1" time="0.123" id="7">
+    <properties>
+      <property name="java.version" value="17"/>
+    </properties>
+    <testcase name="testSuccess" classname="com.example.MyTest" time="0.001"/>
+    <testcase name="testFailure" classname="com.example.MyTest" time="0.002">
+      <failure message="Expected true" type="AssertionError"><![CDATA[at MyTest.java:15]]></failure>
+    </testcase>
+    <testcase name="testSkipped" classname="com.example.MyTest">
+      <skipped/>
+    </testcase>
+    <system-out>hello</system-out>
+  </testsuite>
+</testsuites>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	if doc.Bare {
+		t.Error("Expected document with <testsuites> root not to be bare")
+	}
+	if doc.Name != "all" || doc.Tests != "3" {
+		t.Errorf("Unexpected root attributes: name=%q tests=%q", doc.Name, doc.Tests)
+	}
+	if len(doc.Suites) != 1 {
+		t.Fatalf("Expected 1 suite, got %d", len(doc.Suites))
+	}
+
+	suite := doc.Suites[0]
+	if suite.Name != "com.example.MyTest" || suite.Time != "0.123" {
+		t.Errorf("Unexpected suite attributes: name=%q time=%q", suite.Name, suite.Time)
+	}
+	if len(suite.Attrs) != 1 || suite.Attrs[0].Name.Local != "id" || suite.Attrs[0].Value != "7" {
+		t.Errorf("Expected unknown attribute id=7 to be kept, got %v", suite.Attrs)
+	}
+	if suite.Properties == nil || len(suite.Properties.Properties) != 1 {
+		t.Errorf("Expected 1 property, got %+v", suite.Properties)
+	}
+	if len(suite.SystemOut) != 1 || suite.SystemOut[0].Text != "hello" {
+		t.Errorf("Expected system-out %q, got %+v", "hello", suite.SystemOut)
+	}
+	if len(suite.Testcases) != 3 {
+		t.Fatalf("Expected 3 testcases, got %d", len(suite.Testcases))
+	}
+
+	failure := suite.Testcases[1].Failures
+	if len(failure) != 1 || failure[0].Message != "Expected true" || failure[0].Text != "at MyTest.java:15" {
+		t.Errorf("Unexpected failure: %+v", failure)
+	}
+
+	wantStatuses := []Status{StatusPassed, StatusFailed, StatusSkipped}
+	for i, want := range wantStatuses {
+		if got := suite.Testcases[i].Status(); got != want {
+			t.Errorf("Testcases[%d].Status() = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestParseBareSuite(t *testing.T) {
+	input := `<testsuite name="bare"><testcase name="a" classname="c"><error message="boom"/></testcase></testsuite>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	if !doc.Bare {
+		t.Error("Expected document with <testsuite> root to be bare")
+	}
+	if len(doc.Suites) != 1 || doc.Suites[0].Name != "bare" {
+		t.Fatalf("Expected a single suite named bare, got %+v", doc.Suites)
+	}
+	if got := doc.Suites[0].Testcases[0].Status(); got != StatusErrored {
+		t.Errorf("Status() = %q, want %q", got, StatusErrored)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		errMatch string
+	}{
+		{
+			name:     "wrong root element",
+			input:    `<root><testsuite/></root>`,
+			errMatch: "unexpected root element <root>",
+		},
+		{
+			name:     "no elements",
+			input:    `<?xml version="1.0"?>`,
+			errMatch: "does not contain a <testsuite>",
+		},
+		{
+			name:     "malformed",
+			input:    `<testsuite><testcase></testsuite>`,
+			errMatch: "error parsing XML",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			if err == nil {
+				t.Fatal("Parse() expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.errMatch) {
+				t.Errorf("Parse() error = %v, expected to contain %q", err, tt.errMatch)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	doc, err := ParseFile("../../testdata/valid_junit_multiple_suites.xml")
+	if err != nil {
+		t.Fatalf("ParseFile() unexpected error: %v", err)
+	}
+	if len(doc.Suites) < 2 {
+		t.Errorf("Expected multiple suites, got %d", len(doc.Suites))
+	}
+
+	if _, err := ParseFile("/path/that/does/not/exist.xml"); err == nil || !strings.Contains(err.Error(), "failed to open file") {
+		t.Errorf("ParseFile() error = %v, expected to contain 'failed to open file'", err)
+	}
+}
+
+func TestWalkSuites(t *testing.T) {
+	input := `<testsuites>
+  <testsuite name="outer">
+    <testsuite name="inner"/>
+  </testsuite>
+  <testsuite name="second"/>
+</testsuites>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	var names []string
+	doc.WalkSuites(func(s *Suite) { names = append(names, s.Name) })
+
+	if got, want := strings.Join(names, ","), "outer,inner,second"; got != want {
+		t.Errorf("WalkSuites() visited %q, want %q", got, want)
+	}
+}
+
+func TestWalkTestcases(t *testing.T) {
+	input := `<testsuites>
+  <testsuite name="outer">
+    <testcase name="a"/>
+    <testsuite name="inner">
+      <testcase name="b"/>
+    </testsuite>
+  </testsuite>
+  <testsuite name="second">
+    <testcase name="c"/>
+  </testsuite>
+</testsuites>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+
+	var visited []string
+	doc.WalkTestcases(func(s *Suite, tc *Testcase) { visited = append(visited, s.Name+"/"+tc.Name) })
+
+	if got, want := strings.Join(visited, ","), "outer/a,inner/b,second/c"; got != want {
+		t.Errorf("WalkTestcases() visited %q, want %q", got, want)
+	}
+}
+
+func TestParseCountAndTime(t *testing.T) {
+	if n, ok := ParseCount("12"); !ok || n != 12 {
+		t.Errorf("ParseCount(12) = %d, %v", n, ok)
+	}
+	if _, ok := ParseCount(""); ok {
+		t.Error("ParseCount(\"\") expected not ok")
+	}
+	if _, ok := ParseCount("abc"); ok {
+		t.Error("ParseCount(abc) expected not ok")
+	}
+	if f, ok := ParseTime("-1.5"); !ok || f != -1.5 {
+		t.Errorf("ParseTime(-1.5) = %v, %v", f, ok)
+	}
+	if _, ok := ParseTime(""); ok {
+		t.Error("ParseTime(\"\") expected not ok")
+	}
+}
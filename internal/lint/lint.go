@@ -0,0 +1,148 @@
+package lint
+
+import (
+	"fmt"
+
+	"testnod-uploader/internal/junit"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+type Issue struct {
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: [%s] %s", i.Severity, i.Rule, i.Message)
+}
+
+// Rule is a single lint check. New checks only need to be appended to Rules.
+type Rule struct {
+	Name     string
+	Severity Severity
+	Check    func(doc *junit.Document) []string
+}
+
+var Rules = []Rule{
+	{Name: "duplicate-testcase", Severity: Warning, Check: checkDuplicateTestcases},
+	{Name: "empty-classname", Severity: Warning, Check: checkEmptyClassnames},
+	{Name: "negative-time", Severity: Error, Check: checkNegativeTimes},
+	{Name: "count-mismatch", Severity: Error, Check: checkCounts},
+}
+
+func Run(doc *junit.Document, rules []Rule) []Issue {
+	var issues []Issue
+	for _, rule := range rules {
+		for _, message := range rule.Check(doc) {
+			issues = append(issues, Issue{Severity: rule.Severity, Rule: rule.Name, Message: message})
+		}
+	}
+	return issues
+}
+
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func checkDuplicateTestcases(doc *junit.Document) []string {
+	var messages []string
+	doc.WalkSuites(func(s *junit.Suite) {
+		seen := make(map[string]bool)
+		for _, tc := range s.Testcases {
+			key := tc.Classname + "\x00" + tc.Name
+			if seen[key] {
+				messages = append(messages, fmt.Sprintf("suite %q has duplicate testcase %q (classname %q)", s.Name, tc.Name, tc.Classname))
+				continue
+			}
+			seen[key] = true
+		}
+	})
+	return messages
+}
+
+func checkEmptyClassnames(doc *junit.Document) []string {
+	var messages []string
+	doc.WalkSuites(func(s *junit.Suite) {
+		for _, tc := range s.Testcases {
+			if tc.Classname == "" {
+				messages = append(messages, fmt.Sprintf("suite %q testcase %q has an empty classname", s.Name, tc.Name))
+			}
+		}
+	})
+	return messages
+}
+
+func checkNegativeTimes(doc *junit.Document) []string {
+	var messages []string
+	doc.WalkSuites(func(s *junit.Suite) {
+		if t, ok := junit.ParseTime(s.Time); ok && t < 0 {
+			messages = append(messages, fmt.Sprintf("suite %q has negative time %s", s.Name, s.Time))
+		}
+		for _, tc := range s.Testcases {
+			if t, ok := junit.ParseTime(tc.Time); ok && t < 0 {
+				messages = append(messages, fmt.Sprintf("suite %q testcase %q has negative time %s", s.Name, tc.Name, tc.Time))
+			}
+		}
+	})
+	return messages
+}
+
+// checkCounts compares a suite's declared tests/failures/errors/skipped
+// attributes against its direct testcases. Suites that only wrap nested
+// suites are skipped, since their counts are aggregates.
+func checkCounts(doc *junit.Document) []string {
+	var messages []string
+	doc.WalkSuites(func(s *junit.Suite) {
+		if len(s.Suites) > 0 {
+			return
+		}
+
+		var failures, errors, skipped int
+		for _, tc := range s.Testcases {
+			switch tc.Status() {
+			case junit.StatusErrored:
+				errors++
+			case junit.StatusFailed:
+				failures++
+			case junit.StatusSkipped:
+				skipped++
+			}
+		}
+
+		counts := []struct {
+			attr     string
+			declared string
+			actual   int
+		}{
+			{"tests", s.Tests, len(s.Testcases)},
+			{"failures", s.Failures, failures},
+			{"errors", s.Errors, errors},
+			{"skipped", s.Skipped, skipped},
+		}
+		for _, c := range counts {
+			if n, ok := junit.ParseCount(c.declared); ok && n != c.actual {
+				messages = append(messages, fmt.Sprintf("suite %q declares %s=%d but contains %d", s.Name, c.attr, n, c.actual))
+			}
+		}
+	})
+	return messages
+}
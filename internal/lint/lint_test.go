@@ -0,0 +1,144 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"testnod-uploader/internal/junit"
+)
+
+func parse(t *testing.T, input string) *junit.Document {
+	t.Helper()
+	doc, err := junit.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse test input: %v", err)
+	}
+	return doc
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantRule     string
+		wantSeverity Severity
+		wantMessage  string
+	}{
+		{
+			name: "duplicate testcase",
+			input: `<testsuite name="s" tests="2">
+  <testcase name="a" classname="c"/>
+  <testcase name="a" classname="c"/>
+</testsuite>`,
+			wantRule:     "duplicate-testcase",
+			wantSeverity: Warning,
+			wantMessage:  `suite "s" has duplicate testcase "a"`,
+		},
+		{
+			name: "empty classname",
+			input: `<testsuite name="s" tests="1">
+  <testcase name="a" classname=""/>
+</testsuite>`,
+			wantRule:     "empty-classname",
+			wantSeverity: Warning,
+			wantMessage:  `testcase "a" has an empty classname`,
+		},
+		{
+			name: "negative testcase time",
+			input: `<testsuite name="s" tests="1">
+  <testcase name="a" classname="c" time="-5.0"/>
+</testsuite>`,
+			wantRule:     "negative-time",
+			wantSeverity: Error,
+			wantMessage:  `testcase "a" has negative time -5.0`,
+		},
+		{
+			name:         "negative suite time",
+			input:        `<testsuite name="s" time="-1"></testsuite>`,
+			wantRule:     "negative-time",
+			wantSeverity: Error,
+			wantMessage:  `suite "s" has negative time -1`,
+		},
+		{
+			name: "tests count mismatch",
+			input: `<testsuite name="s" tests="3">
+  <testcase name="a" classname="c"/>
+</testsuite>`,
+			wantRule:     "count-mismatch",
+			wantSeverity: Error,
+			wantMessage:  `suite "s" declares tests=3 but contains 1`,
+		},
+		{
+			name: "failures count mismatch",
+			input: `<testsuite name="s" tests="1" failures="0">
+  <testcase name="a" classname="c"><failure message="x"/></testcase>
+</testsuite>`,
+			wantRule:     "count-mismatch",
+			wantSeverity: Error,
+			wantMessage:  `suite "s" declares failures=0 but contains 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Run(parse(t, tt.input), Rules)
+
+			if len(issues) != 1 {
+				t.Fatalf("Expected exactly 1 issue, got %d: %v", len(issues), issues)
+			}
+			issue := issues[0]
+			if issue.Rule != tt.wantRule {
+				t.Errorf("Rule = %q, want %q", issue.Rule, tt.wantRule)
+			}
+			if issue.Severity != tt.wantSeverity {
+				t.Errorf("Severity = %v, want %v", issue.Severity, tt.wantSeverity)
+			}
+			if !strings.Contains(issue.Message, tt.wantMessage) {
+				t.Errorf("Message = %q, expected to contain %q", issue.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRunCleanDocument(t *testing.T) {
+	doc := parse(t, `<testsuites>
+  <testsuite name="outer" tests="5">
+    <testsuite name="inner" tests="2" failures="1" errors="0" skipped="0" time="0.5">
+      <testcase name="a" classname="c" time="0.2"/>
+      <testcase name="b" classname="c" time="0.3"><failure/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`)
+
+	if issues := Run(doc, Rules); len(issues) != 0 {
+		t.Errorf("Expected no issues, got %v", issues)
+	}
+}
+
+func TestRunCustomRule(t *testing.T) {
+	rule := Rule{
+		Name:     "always",
+		Severity: Warning,
+		Check:    func(doc *junit.Document) []string { return []string{"first", "second"} },
+	}
+
+	issues := Run(parse(t, `<testsuite/>`), []Rule{rule})
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %d", len(issues))
+	}
+	if got := issues[0].String(); got != "warning: [always] first" {
+		t.Errorf("Issue.String() = %q", got)
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	if HasErrors(nil) {
+		t.Error("HasErrors(nil) = true, want false")
+	}
+	if HasErrors([]Issue{{Severity: Warning}}) {
+		t.Error("HasErrors(warnings only) = true, want false")
+	}
+	if !HasErrors([]Issue{{Severity: Warning}, {Severity: Error}}) {
+		t.Error("HasErrors(with error) = false, want true")
+	}
+}
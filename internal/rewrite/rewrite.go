@@ -0,0 +1,415 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"testnod-uploader/internal/junit"
+)
+
+// PrefixClassnames prepends prefix to every testcase classname so that
+// results from different services don't collide. Empty classnames stay empty
+// unless fillEmpty is set, in which case they become prefix+fillEmpty. It
+// returns the number of testcases changed.
+func PrefixClassnames(doc *junit.Document, prefix string, fillEmpty string) int {
+	changed := 0
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		if tc.Classname == "" {
+			if fillEmpty == "" {
+				return
+			}
+			tc.Classname = fillEmpty
+		}
+		tc.Classname = prefix + tc.Classname
+		changed++
+	})
+	return changed
+}
+
+// driveLetter matches a Windows drive letter at the start of a path.
+var driveLetter = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// NormalizePaths turns backslashes into forward slashes in every testcase
+// classname and name, so results from Windows and Unix runners line up.
+// With stripDrive, a leading drive letter such as "C:" is removed as well,
+// leaving the path rooted at "/". It returns the number of testcases changed.
+func NormalizePaths(doc *junit.Document, stripDrive bool) int {
+	normalize := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, "/")
+		if stripDrive && driveLetter.MatchString(s) {
+			s = s[2:]
+		}
+		return s
+	}
+
+	changed := 0
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		classname, name := normalize(tc.Classname), normalize(tc.Name)
+		if classname != tc.Classname || name != tc.Name {
+			tc.Classname, tc.Name = classname, name
+			changed++
+		}
+	})
+	return changed
+}
+
+// Redacted replaces every match of a redaction pattern.
+const Redacted = "***"
+
+// Redact replaces matches of any pattern in failure and error messages and
+// text, and in system-out and system-err output, with Redacted. It returns
+// the number of elements changed.
+func Redact(doc *junit.Document, patterns []*regexp.Regexp) int {
+	changed := 0
+	redact := func(s *string) {
+		redacted := *s
+		for _, pattern := range patterns {
+			redacted = pattern.ReplaceAllLiteralString(redacted, Redacted)
+		}
+		if redacted != *s {
+			*s = redacted
+			changed++
+		}
+	}
+	redactResults := func(results []junit.Result) {
+		for i := range results {
+			redact(&results[i].Message)
+			redact(&results[i].Text)
+		}
+	}
+	redactOutput := func(outputs []junit.Output) {
+		for i := range outputs {
+			redact(&outputs[i].Text)
+		}
+	}
+
+	doc.WalkSuites(func(s *junit.Suite) {
+		redactOutput(s.SystemOut)
+		redactOutput(s.SystemErr)
+		for i := range s.Testcases {
+			tc := &s.Testcases[i]
+			redactResults(tc.Failures)
+			redactResults(tc.Errors)
+			redactOutput(tc.SystemOut)
+			redactOutput(tc.SystemErr)
+		}
+	})
+	return changed
+}
+
+// DuplicateSuiteNames returns every testsuite name, nested suites included,
+// that is used by more than one suite, in the order the duplicates appear.
+// Unnamed suites are ignored.
+func DuplicateSuiteNames(doc *junit.Document) []string {
+	seen := make(map[string]int)
+	var duplicates []string
+	doc.WalkSuites(func(s *junit.Suite) {
+		if s.Name == "" {
+			return
+		}
+		seen[s.Name]++
+		if seen[s.Name] == 2 {
+			duplicates = append(duplicates, s.Name)
+		}
+	})
+	return duplicates
+}
+
+// RenameDuplicateSuites appends a counter to every repeat of a testsuite
+// name, so the second "api" becomes "api (2)", skipping counters that would
+// collide with another suite's name. It returns the number of suites renamed.
+func RenameDuplicateSuites(doc *junit.Document) int {
+	taken := make(map[string]bool)
+	doc.WalkSuites(func(s *junit.Suite) {
+		taken[s.Name] = true
+	})
+
+	seen := make(map[string]bool)
+	renamed := 0
+	doc.WalkSuites(func(s *junit.Suite) {
+		if s.Name == "" {
+			return
+		}
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			return
+		}
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s (%d)", s.Name, n)
+			if !taken[candidate] {
+				taken[candidate] = true
+				seen[candidate] = true
+				s.Name = candidate
+				break
+			}
+		}
+		renamed++
+	})
+	return renamed
+}
+
+// FilterSuites keeps only the top-level testsuites whose name matches
+// pattern, with their nested suites, and recomputes the document's tests,
+// failures, errors, skipped and time attributes from what's left. It returns
+// the number of suites kept.
+func FilterSuites(doc *junit.Document, pattern *regexp.Regexp) int {
+	kept := doc.Suites[:0]
+	for _, s := range doc.Suites {
+		if pattern.MatchString(s.Name) {
+			kept = append(kept, s)
+		}
+	}
+	doc.Suites = kept
+	recomputeTotals(doc)
+	return len(doc.Suites)
+}
+
+// WrapSuite turns a bare <testsuite> document into one with a <testsuites>
+// root carrying aggregate tests, failures, errors, skipped and time
+// attributes. Documents that already have a <testsuites> root are left
+// alone. It reports whether the document was wrapped.
+func WrapSuite(doc *junit.Document) bool {
+	if !doc.Bare {
+		return false
+	}
+	doc.Bare = false
+	recomputeTotals(doc)
+	return true
+}
+
+// recomputeTotals sets the document's aggregate attributes from its
+// testcases and top-level suites.
+func recomputeTotals(doc *junit.Document) {
+	var tests, failures, errors, skipped int
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		tests++
+		switch tc.Status() {
+		case junit.StatusFailed:
+			failures++
+		case junit.StatusErrored:
+			errors++
+		case junit.StatusSkipped:
+			skipped++
+		}
+	})
+	doc.Tests = strconv.Itoa(tests)
+	doc.Failures = strconv.Itoa(failures)
+	doc.Errors = strconv.Itoa(errors)
+	doc.Skipped = strconv.Itoa(skipped)
+
+	// Time is only known if the suites report it.
+	var total float64
+	timed := false
+	for _, s := range doc.Suites {
+		if t, ok := junit.ParseTime(s.Time); ok {
+			total += t
+			timed = true
+		}
+	}
+	doc.Time = ""
+	if timed {
+		doc.Time = strconv.FormatFloat(total, 'f', -1, 64)
+	}
+}
+
+// CollapseRetries merges testcases that share a classname and name within a
+// suite, as emitted by runners that retry tests, into one testcase. The
+// merged testcase takes the place of the first attempt with the outcome of
+// the last, and the system-out of every attempt concatenated in order. The
+// tests, failures, errors and skipped attributes of its suites and the
+// document are reduced by the attempts removed. It returns the number of
+// testcases removed.
+func CollapseRetries(doc *junit.Document) int {
+	var removed counts
+	for i := range doc.Suites {
+		removed.add(collapseSuite(&doc.Suites[i]))
+	}
+	removed.subtractFrom(&doc.Tests, &doc.Failures, &doc.Errors, &doc.Skipped)
+	return removed.tests
+}
+
+// counts tallies removed testcases by outcome.
+type counts struct {
+	tests, failures, errors, skipped int
+}
+
+func (c *counts) add(other counts) {
+	c.tests += other.tests
+	c.failures += other.failures
+	c.errors += other.errors
+	c.skipped += other.skipped
+}
+
+func (c *counts) count(tc junit.Testcase) {
+	c.tests++
+	switch tc.Status() {
+	case junit.StatusFailed:
+		c.failures++
+	case junit.StatusErrored:
+		c.errors++
+	case junit.StatusSkipped:
+		c.skipped++
+	}
+}
+
+// subtractFrom lowers each count attribute that is set to a valid number.
+func (c counts) subtractFrom(tests, failures, errors, skipped *string) {
+	for _, attr := range []struct {
+		value *string
+		n     int
+	}{{tests, c.tests}, {failures, c.failures}, {errors, c.errors}, {skipped, c.skipped}} {
+		if current, ok := junit.ParseCount(*attr.value); ok && attr.n > 0 {
+			*attr.value = strconv.Itoa(max(current-attr.n, 0))
+		}
+	}
+}
+
+// collapseSuite collapses the retries in s and its nested suites and
+// returns the removed attempts.
+func collapseSuite(s *junit.Suite) counts {
+	var removed counts
+	for i := range s.Suites {
+		removed.add(collapseSuite(&s.Suites[i]))
+	}
+
+	type key struct{ classname, name string }
+	first := make(map[key]int)
+	kept := s.Testcases[:0]
+	for _, tc := range s.Testcases {
+		k := key{tc.Classname, tc.Name}
+		i, seen := first[k]
+		if !seen {
+			first[k] = len(kept)
+			kept = append(kept, tc)
+			continue
+		}
+		removed.count(kept[i])
+		kept[i] = mergeAttempt(kept[i], tc)
+	}
+	s.Testcases = kept
+
+	removed.subtractFrom(&s.Tests, &s.Failures, &s.Errors, &s.Skipped)
+	return removed
+}
+
+// mergeAttempt returns the later attempt with the system-out of both, joined
+// into a single element.
+func mergeAttempt(earlier, later junit.Testcase) junit.Testcase {
+	text := outputText(earlier.SystemOut)
+	if text == "" {
+		return later
+	}
+	merged := junit.Output{Text: text}
+	if len(later.SystemOut) > 0 {
+		merged.Attrs = later.SystemOut[0].Attrs
+		if laterText := outputText(later.SystemOut); laterText != "" {
+			merged.Text = strings.TrimSuffix(merged.Text, "\n") + "\n" + laterText
+		}
+	}
+	later.SystemOut = []junit.Output{merged}
+	return later
+}
+
+// outputText joins the text of repeated <system-out> elements line by line.
+func outputText(outputs []junit.Output) string {
+	var text string
+	for _, o := range outputs {
+		if o.Text == "" {
+			continue
+		}
+		if text != "" {
+			text = strings.TrimSuffix(text, "\n") + "\n"
+		}
+		text += o.Text
+	}
+	return text
+}
+
+// Group is the part of a document whose testcases share a group key.
+type Group struct {
+	Key string
+	Doc *junit.Document
+}
+
+// ClassnamePrefix returns a testcase's classname up to its first dot, e.g.
+// "payments" for "payments.api.Charges". Classnames without a dot are their
+// own prefix.
+func ClassnamePrefix(tc junit.Testcase) string {
+	prefix, _, _ := strings.Cut(tc.Classname, ".")
+	return prefix
+}
+
+// Partition splits doc into one document per key returned by keyOf, in the
+// order the keys first appear. Each document keeps the suites that contain
+// testcases of its group, with only those testcases, and has its tests,
+// failures, errors and skipped counts recomputed. Suite times can't be
+// split, so they're kept as they were.
+func Partition(doc *junit.Document, keyOf func(tc junit.Testcase) string) []Group {
+	var keys []string
+	seen := make(map[string]bool)
+	doc.WalkTestcases(func(_ *junit.Suite, tc *junit.Testcase) {
+		if key := keyOf(*tc); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	})
+
+	groups := make([]Group, 0, len(keys))
+	for _, key := range keys {
+		part := *doc
+		part.Suites = filterSuites(doc.Suites, func(tc junit.Testcase) bool { return keyOf(tc) == key })
+		recomputeTotals(&part)
+		groups = append(groups, Group{Key: key, Doc: &part})
+	}
+	return groups
+}
+
+// filterSuites returns copies of suites holding only the testcases keep
+// accepts, dropping suites left without any.
+func filterSuites(suites []junit.Suite, keep func(tc junit.Testcase) bool) []junit.Suite {
+	var kept []junit.Suite
+	for _, s := range suites {
+		s.Suites = filterSuites(s.Suites, keep)
+		var testcases []junit.Testcase
+		for _, tc := range s.Testcases {
+			if keep(tc) {
+				testcases = append(testcases, tc)
+			}
+		}
+		s.Testcases = testcases
+		if len(s.Testcases) == 0 && len(s.Suites) == 0 {
+			continue
+		}
+		recomputeSuiteCounts(&s)
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// recomputeSuiteCounts sets the tests, failures, errors and skipped
+// attributes the suite already has from its testcases, nested suites
+// included.
+func recomputeSuiteCounts(s *junit.Suite) {
+	var c counts
+	var walk func(s *junit.Suite)
+	walk = func(s *junit.Suite) {
+		for _, tc := range s.Testcases {
+			c.count(tc)
+		}
+		for i := range s.Suites {
+			walk(&s.Suites[i])
+		}
+	}
+	walk(s)
+
+	for _, attr := range []struct {
+		value *string
+		n     int
+	}{{&s.Tests, c.tests}, {&s.Failures, c.failures}, {&s.Errors, c.errors}, {&s.Skipped, c.skipped}} {
+		if *attr.value != "" {
+			*attr.value = strconv.Itoa(attr.n)
+		}
+	}
+}
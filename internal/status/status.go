@@ -0,0 +1,126 @@
+package status
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"testnod-uploader/internal/atomicfile"
+)
+
+// Phases reported in the status file, in the order a successful upload goes
+// through them.
+const (
+	Validating = "validating"
+	Creating   = "creating"
+	Uploading  = "uploading"
+	Done       = "done"
+	Failed     = "failed"
+)
+
+// Status is the JSON written to the status file.
+type Status struct {
+	Phase            string    `json:"phase"`
+	File             string    `json:"file"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	Error            string    `json:"error,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// byteInterval limits how often byte counts alone rewrite the file. Phase
+// changes are always written.
+var byteInterval = 250 * time.Millisecond
+
+// File keeps a status file up to date for consumers that poll it. Every
+// write goes to a temporary file in the same directory that is renamed over
+// the status file, so readers never see partial JSON. A nil *File ignores
+// every update.
+type File struct {
+	path string
+
+	mu        sync.Mutex
+	current   Status
+	lastWrite time.Time
+}
+
+func New(path string) *File {
+	return &File{path: path}
+}
+
+// Start records that file is being validated, replacing the status of the
+// previous file.
+func (f *File) Start(file string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current = Status{Phase: Validating, File: file}
+	return f.write()
+}
+
+// SetPhase records that the current file entered phase and resets the byte
+// count.
+func (f *File) SetPhase(phase string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current.Phase = phase
+	f.current.BytesTransferred = 0
+	return f.write()
+}
+
+// Finish records that the current file was processed successfully.
+func (f *File) Finish() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current.Phase = Done
+	return f.write()
+}
+
+// Fail records that the current file failed with err.
+func (f *File) Fail(err error) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current.Phase = Failed
+	f.current.Error = err.Error()
+	return f.write()
+}
+
+// SetBytes records how many bytes of the current file have been
+// transferred. The file is rewritten at most every byteInterval.
+func (f *File) SetBytes(n int64) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.current.BytesTransferred = n
+	if time.Since(f.lastWrite) < byteInterval {
+		return nil
+	}
+	return f.write()
+}
+
+func (f *File) write() error {
+	f.current.UpdatedAt = time.Now().UTC()
+	if err := atomicfile.WriteJSON(f.path, f.current, false); err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+
+	f.lastWrite = time.Now()
+	return nil
+}
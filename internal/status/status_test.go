@@ -0,0 +1,104 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readStatus(t *testing.T, path string) Status {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read status file: %v", err)
+	}
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("Status file is not valid JSON: %v\n%s", err, data)
+	}
+	return s
+}
+
+func TestFileTransitions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status.json")
+	f := New(path)
+
+	if err := f.Start("results.xml"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if s := readStatus(t, path); s.Phase != Validating || s.File != "results.xml" || s.UpdatedAt.IsZero() {
+		t.Errorf("status = %+v, want validating results.xml", s)
+	}
+
+	f.SetPhase(Creating)
+	if s := readStatus(t, path); s.Phase != Creating || s.File != "results.xml" {
+		t.Errorf("status = %+v, want creating results.xml", s)
+	}
+
+	f.SetPhase(Uploading)
+	f.SetBytes(10)
+	if s := readStatus(t, path); s.BytesTransferred != 0 {
+		t.Errorf("BytesTransferred = %d, want 0 right after a phase change", s.BytesTransferred)
+	}
+
+	original := byteInterval
+	byteInterval = 0
+	t.Cleanup(func() { byteInterval = original })
+	f.SetBytes(2048)
+	if s := readStatus(t, path); s.Phase != Uploading || s.BytesTransferred != 2048 {
+		t.Errorf("status = %+v, want uploading with 2048 bytes", s)
+	}
+
+	f.Fail(errors.New("upload failed"))
+	if s := readStatus(t, path); s.Phase != Failed || s.Error != "upload failed" || s.BytesTransferred != 2048 {
+		t.Errorf("status = %+v, want failed with the error", s)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the status file in the directory, found %d entries", len(entries))
+	}
+}
+
+func TestFileNil(t *testing.T) {
+	var f *File
+	if err := f.Start("x.xml"); err != nil {
+		t.Errorf("Start() on nil error = %v", err)
+	}
+	if err := f.SetPhase(Creating); err != nil {
+		t.Errorf("SetPhase() on nil error = %v", err)
+	}
+	if err := f.SetBytes(1); err != nil {
+		t.Errorf("SetBytes() on nil error = %v", err)
+	}
+	if err := f.Finish(); err != nil {
+		t.Errorf("Finish() on nil error = %v", err)
+	}
+	if err := f.Fail(errors.New("x")); err != nil {
+		t.Errorf("Fail() on nil error = %v", err)
+	}
+}
+
+func TestFileThrottlesBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	f := New(path)
+	f.Start("results.xml")
+	f.SetPhase(Uploading)
+
+	original := byteInterval
+	byteInterval = time.Hour
+	t.Cleanup(func() { byteInterval = original })
+
+	f.SetBytes(100)
+	if s := readStatus(t, path); s.BytesTransferred != 0 {
+		t.Errorf("BytesTransferred = %d, want the throttled count unwritten", s.BytesTransferred)
+	}
+	f.Finish()
+	if s := readStatus(t, path); s.Phase != Done || s.BytesTransferred != 100 {
+		t.Errorf("status = %+v, want done with 100 bytes despite the throttle", s)
+	}
+}
@@ -2,23 +2,36 @@ package testnod
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/avast/retry-go/v5"
 
 	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/jitter"
+	"testnod-uploader/internal/tracing"
+	"testnod-uploader/internal/transport"
 )
 
 type CreateTestRunRequest struct {
 	Tags    []Tag   `json:"tags"`
 	TestRun TestRun `json:"test_run"`
+	// Coverage asks for a CoveragePresignedURL to upload a coverage report
+	// to alongside the test results.
+	Coverage bool `json:"coverage,omitempty"`
 }
 
 type TestRun struct {
 	Metadata TestRunMetadata `json:"metadata"`
+
+	// Note is a free-form comment shown with the run, e.g. "re-run after
+	// infra fix".
+	Note string `json:"note,omitempty"`
 }
 
 type Tag struct {
@@ -30,6 +43,10 @@ type TestRunMetadata struct {
 	CommitSHA string `json:"commit_sha"`
 	RunURL    string `json:"run_url"`
 	BuildID   string `json:"build_id"`
+
+	// Environment names where the run happened (ci, staging, nightly) for
+	// filtering, separately from free-form tags.
+	Environment string `json:"environment,omitempty"`
 }
 
 type SuccessfulServerResponse struct {
@@ -39,33 +56,149 @@ type SuccessfulServerResponse struct {
 	UploadID     int    `json:"upload_id"`
 	TestRunURL   string `json:"test_run_url"`
 	PresignedURL string `json:"presigned_url"`
+	// CoveragePresignedURL is only returned when the request set Coverage.
+	CoveragePresignedURL string `json:"coverage_presigned_url,omitempty"`
+
+	// Headers holds the response headers selected with SetCapturedHeaders.
+	Headers http.Header `json:"-"`
 }
 
 const retryAttempts = 3
 
 var (
-	httpClient = &http.Client{Timeout: 30 * time.Second}
-	retryDelay = 1 * time.Second
+	httpClient      = &http.Client{Timeout: 30 * time.Second}
+	retryDelay      = 1 * time.Second
+	createAttempts  = retryAttempts
+	capturedHeaders []string
+	attemptObserver func(attempt int, duration time.Duration, err error)
+	retryIf         func(err error) bool
+	requestID       string
+	idempotencyKey  string
+	schemaVersion   = SchemaVersion
+	basicUser       string
+	basicPass       string
 )
 
+// SetRetryDelay sets the base delay between the retries of CreateTestRun and NotifyUploadFailure.
+// It returns the previous delay.
+func SetRetryDelay(d time.Duration) time.Duration {
+	previous := retryDelay
+	retryDelay = d
+	return previous
+}
+
+// SetTransport replaces the transport used by CreateTestRun and NotifyUploadFailure,
+// keeping the client's timeout.
+func SetTransport(transport http.RoundTripper) {
+	httpClient = &http.Client{Timeout: httpClient.Timeout, Transport: transport}
+}
+
+// SetCapturedHeaders selects which CreateTestRun response headers are copied
+// into SuccessfulServerResponse.Headers. Other headers are discarded.
+func SetCapturedHeaders(names ...string) {
+	capturedHeaders = names
+}
+
+// SetCreateAttempts sets how many times CreateTestRun tries before giving up.
+// NotifyUploadFailure always uses the default.
+func SetCreateAttempts(n int) {
+	createAttempts = n
+}
+
+// RequestIDHeader carries the ID set with SetRequestID.
+const RequestIDHeader = "X-Request-Id"
+
+// SetRequestID sets the ID sent in the X-Request-Id header of every API
+// request, so they can be matched with TestNod's server logs. Empty sends no
+// header.
+func SetRequestID(id string) {
+	requestID = id
+}
+
+// SchemaVersion is the version of the CreateTestRunRequest schema this
+// client speaks, sent in the SchemaVersionHeader of CreateTestRun so the
+// server can adapt to or reject older clients. Bump it with incompatible
+// changes to the request.
+const SchemaVersion = "1"
+
+// SchemaVersionHeader carries SchemaVersion, or the version set with
+// SetSchemaVersion.
+const SchemaVersionHeader = "X-TestNod-Schema-Version"
+
+// SetSchemaVersion overrides the schema version CreateTestRun declares.
+// Empty restores the default, SchemaVersion.
+func SetSchemaVersion(version string) {
+	if version == "" {
+		version = SchemaVersion
+	}
+	schemaVersion = version
+}
+
+// IdempotencyKeyHeader carries the key set with SetIdempotencyKey.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// SetIdempotencyKey sets the key sent in an Idempotency-Key header with
+// every CreateTestRun until it's changed, so repeated creates for the same
+// file carry the same key. Empty sends no header.
+func SetIdempotencyKey(key string) {
+	idempotencyKey = key
+}
+
+// SetBasicAuth sets the credentials sent in an Authorization: Basic header
+// with every API request, alongside the Project-Token, for a proxy in front
+// of TestNod that requires them. An empty user sends no header.
+func SetBasicAuth(user, pass string) {
+	basicUser = user
+	basicPass = pass
+}
+
+// SetRetryIf registers fn to decide, after a failed CreateTestRun attempt
+// with attempts left, whether to try again. Pass nil to retry every error.
+func SetRetryIf(fn func(err error) bool) {
+	retryIf = fn
+}
+
+// SetAttemptObserver registers fn to be called after every CreateTestRun
+// attempt with the attempt's number, starting at 1, how long it took and its
+// error (nil for the attempt that succeeded). Pass nil to remove it.
+func SetAttemptObserver(fn func(attempt int, duration time.Duration, err error)) {
+	attemptObserver = fn
+}
+
 func CreateTestRun(uploadURL string, projectToken string, requestBody CreateTestRunRequest) (SuccessfulServerResponse, error) {
 	requestBodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
 		return SuccessfulServerResponse{}, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
+	return CreateTestRunRaw(uploadURL, projectToken, requestBodyBytes)
+}
+
+// CreateTestRunRaw is CreateTestRun for callers that need control over the
+// exact request JSON, e.g. for a server with a customized schema. The body is
+// sent verbatim with the same headers and retries.
+func CreateTestRunRaw(uploadURL string, projectToken string, requestBodyBytes []byte) (SuccessfulServerResponse, error) {
 	var resp *http.Response
+	attempts := 0
 
-	err = retry.New(
+	err := retry.New(
 		retry.Delay(retryDelay),
-		retry.Attempts(retryAttempts),
+		retry.DelayType(jitter.Backoff),
+		retry.Attempts(uint(createAttempts)),
 		retry.LastErrorOnly(true),
+		retry.RetryIf(retryIf),
 		retry.OnRetry(func(attempt uint, err error) {
 			debug.Log("retry attempt %d: %v", attempt, err)
 			fmt.Println("Could not create test run, retrying...")
 		}),
 	).Do(
-		func() error {
+		func() (err error) {
+			attempts++
+			if attemptObserver != nil {
+				start := time.Now()
+				defer func() { attemptObserver(attempts, time.Since(start), err) }()
+			}
+
 			req, err := http.NewRequest("POST", uploadURL, bytes.NewBuffer(requestBodyBytes))
 			if err != nil {
 				return fmt.Errorf("failed to create request: %w", err)
@@ -74,17 +207,32 @@ func CreateTestRun(uploadURL string, projectToken string, requestBody CreateTest
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Accept", "application/json")
 			req.Header.Set("Project-Token", projectToken)
+			if requestID != "" {
+				req.Header.Set(RequestIDHeader, requestID)
+			}
+			if idempotencyKey != "" {
+				req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+			}
+			req.Header.Set(SchemaVersionHeader, schemaVersion)
+			if basicUser != "" {
+				req.SetBasicAuth(basicUser, basicPass)
+			}
+			tracing.Inject(req.Header)
 
 			debug.Log("request: %s %s content-type=%s", req.Method, req.URL, req.Header.Get("Content-Type"))
 			resp, err = httpClient.Do(req)
 			if err != nil {
-				return fmt.Errorf("failed to perform request: %w", err)
+				code := errcode.CreateNetwork
+				if errcode.IsTimeout(err) {
+					code = errcode.CreateTimeout
+				}
+				return errcode.Errorf(code, "failed to perform request: %w", err)
 			}
 			debug.Log("response: status=%d", resp.StatusCode)
 
 			if resp.StatusCode != http.StatusCreated {
-				resp.Body.Close()
-				return fmt.Errorf("received non-OK response: %s", resp.Status)
+				transport.DrainAndClose(resp.Body)
+				return errcode.Errorf(errcode.HTTPStatus("E_CREATE", resp.StatusCode), "received non-OK response: %s", resp.Status)
 			}
 
 			return nil
@@ -93,16 +241,38 @@ func CreateTestRun(uploadURL string, projectToken string, requestBody CreateTest
 
 	if err != nil {
 		if resp != nil {
-			resp.Body.Close()
+			transport.DrainAndClose(resp.Body)
 		}
 		return SuccessfulServerResponse{}, err
 	}
 
-	defer resp.Body.Close()
+	defer transport.DrainAndClose(resp.Body)
+
+	// Go's transport only decompresses transparently when it negotiated
+	// gzip itself, so a proxy that compresses unprompted leaves it to us.
+	body := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		debug.Log("response is gzip-encoded, decompressing")
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return SuccessfulServerResponse{}, errcode.Errorf(errcode.CreateBadResponse, "failed to decompress response body: %w", err)
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
 
 	var successfulServerResponse SuccessfulServerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&successfulServerResponse); err != nil {
-		return SuccessfulServerResponse{}, fmt.Errorf("failed to decode response body: %w", err)
+	if err := json.NewDecoder(body).Decode(&successfulServerResponse); err != nil {
+		return SuccessfulServerResponse{}, errcode.Errorf(errcode.CreateBadResponse, "failed to decode response body: %w", err)
+	}
+
+	for _, name := range capturedHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			if successfulServerResponse.Headers == nil {
+				successfulServerResponse.Headers = make(http.Header)
+			}
+			successfulServerResponse.Headers[http.CanonicalHeaderKey(name)] = values
+		}
 	}
 
 	debug.Log("response body: id=%d project=%s test_run_id=%d upload_id=%d test_run_url=%s", successfulServerResponse.ID, successfulServerResponse.Project, successfulServerResponse.TestRunID, successfulServerResponse.UploadID, successfulServerResponse.TestRunURL)
@@ -130,6 +300,7 @@ func NotifyUploadFailure(baseURL string, projectToken string, uploadID int, test
 
 	err = retry.New(
 		retry.Delay(retryDelay),
+		retry.DelayType(jitter.Backoff),
 		retry.Attempts(retryAttempts),
 		retry.LastErrorOnly(true),
 		retry.OnRetry(func(attempt uint, err error) {
@@ -146,13 +317,19 @@ func NotifyUploadFailure(baseURL string, projectToken string, uploadID int, test
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Accept", "application/json")
 			req.Header.Set("Project-Token", projectToken)
+			if requestID != "" {
+				req.Header.Set(RequestIDHeader, requestID)
+			}
+			if basicUser != "" {
+				req.SetBasicAuth(basicUser, basicPass)
+			}
 
 			debug.Log("request: %s %s", req.Method, req.URL)
 			resp, err := httpClient.Do(req)
 			if err != nil {
 				return fmt.Errorf("failed to perform request: %w", err)
 			}
-			defer resp.Body.Close()
+			defer transport.DrainAndClose(resp.Body)
 
 			debug.Log("response: status=%d", resp.StatusCode)
 
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"testnod-uploader/internal/debug"
+)
+
+var (
+	traceparent string
+	tracestate  string
+)
+
+// InitFromEnv reads the W3C trace context of the calling CI pipeline from
+// TRACEPARENT (and TRACESTATE) so Inject can forward it with the uploader's
+// requests. The uploader records no spans of its own; the requests simply
+// carry the pipeline's context. A malformed TRACEPARENT is ignored.
+func InitFromEnv() {
+	traceparent, tracestate = "", ""
+
+	value := strings.TrimSpace(os.Getenv("TRACEPARENT"))
+	if value == "" {
+		return
+	}
+	if !validTraceparent(value) {
+		debug.Log("tracing: ignoring invalid TRACEPARENT %q", value)
+		return
+	}
+
+	traceparent = value
+	tracestate = strings.TrimSpace(os.Getenv("TRACESTATE"))
+	debug.Log("tracing: forwarding traceparent=%s", traceparent)
+}
+
+// Inject adds the traceparent header, and tracestate when set, to an outgoing
+// request. Nothing is added when InitFromEnv found no valid TRACEPARENT.
+func Inject(header http.Header) {
+	if traceparent == "" {
+		return
+	}
+	header.Set("traceparent", traceparent)
+	if tracestate != "" {
+		header.Set("tracestate", tracestate)
+	}
+}
+
+// validTraceparent checks the version-00 layout
+// "vv-<32 hex trace id>-<16 hex parent id>-<2 hex flags>". Version ff and
+// all-zero IDs are invalid per the W3C Trace Context spec.
+func validTraceparent(value string) bool {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 {
+		return false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || len(traceID) != 32 || len(parentID) != 16 || len(flags) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if !isLowerHex(part) {
+			return false
+		}
+	}
+	return version != "ff" && !allZero(traceID) && !allZero(parentID)
+}
+
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestInjectForwardsEnv(t *testing.T) {
+	t.Setenv("TRACEPARENT", testTraceparent)
+	t.Setenv("TRACESTATE", "vendor=value")
+	InitFromEnv()
+	t.Cleanup(func() { traceparent, tracestate = "", "" })
+
+	header := http.Header{}
+	Inject(header)
+	if got := header.Get("traceparent"); got != testTraceparent {
+		t.Errorf("traceparent = %q, want TRACEPARENT unchanged", got)
+	}
+	if got := header.Get("tracestate"); got != "vendor=value" {
+		t.Errorf("tracestate = %q, want TRACESTATE unchanged", got)
+	}
+}
+
+func TestInjectWithoutValidTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"unset", ""},
+		{"garbage", "not-a-traceparent"},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+		{"uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{"zero parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRACEPARENT", tt.value)
+			t.Setenv("TRACESTATE", "vendor=value")
+			InitFromEnv()
+
+			header := http.Header{}
+			Inject(header)
+			if len(header) != 0 {
+				t.Errorf("Expected no trace headers, got %v", header)
+			}
+		})
+	}
+}
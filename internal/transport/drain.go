@@ -0,0 +1,18 @@
+package transport
+
+import "io"
+
+// maxDrainBytes caps how much of an unread response body DrainAndClose
+// reads. Past that, such as for a proxy's multi-megabyte error page, a new
+// connection is cheaper than reading the rest.
+const maxDrainBytes = 1 << 20
+
+// DrainAndClose reads what's left of a response body before closing it, so
+// the client's transport can reuse the keep-alive connection for the next
+// request; closing a body that wasn't read to EOF closes the connection
+// instead. With many files in a batch, every create test run request would
+// otherwise risk a new TCP and TLS handshake.
+func DrainAndClose(body io.ReadCloser) error {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	return body.Close()
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDrainAndClose(t *testing.T) {
+	t.Run("reads the rest", func(t *testing.T) {
+		r := strings.NewReader(strings.Repeat("x", 4096))
+		body := &closeRecorder{Reader: r}
+		DrainAndClose(body)
+		if r.Len() != 0 || !body.closed {
+			t.Errorf("%d bytes left, closed = %v; want the body read to the end and closed", r.Len(), body.closed)
+		}
+	})
+
+	t.Run("gives up past the cap", func(t *testing.T) {
+		r := strings.NewReader(strings.Repeat("x", maxDrainBytes+100))
+		body := &closeRecorder{Reader: r}
+		DrainAndClose(body)
+		if r.Len() != 100 || !body.closed {
+			t.Errorf("%d bytes left, closed = %v; want 100 left unread and the body closed", r.Len(), body.closed)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package transport
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimited is a RoundTripper that waits for a token from Limiter before
+// each request. Transports sharing a Limiter share its budget.
+type RateLimited struct {
+	Base    http.RoundTripper
+	Limiter *rate.Limiter
+}
+
+// NewLimiter returns a token bucket allowing perSecond requests per second
+// with no bursts above one request.
+func NewLimiter(perSecond float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
+
+func (t *RateLimited) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.Base.RoundTrip(req)
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	const perSecond = 20
+	limiter := NewLimiter(perSecond)
+	api := &http.Client{Transport: &RateLimited{Base: http.DefaultTransport, Limiter: limiter}}
+	upload := &http.Client{Transport: &RateLimited{Base: http.DefaultTransport, Limiter: limiter}}
+
+	const requests = 10
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range requests {
+		client := api
+		if i%2 == 1 {
+			client = upload
+		}
+		wg.Go(func() {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// The first token is available immediately, so n requests take at least
+	// (n-1)/rate across both clients.
+	minimum := time.Duration(requests-1) * time.Second / perSecond
+	if elapsed < minimum {
+		t.Errorf("%d requests took %v, want at least %v at %d/s", requests, elapsed, minimum, perSecond)
+	}
+	if observed := float64(requests-1) / elapsed.Seconds(); observed > perSecond*1.05 {
+		t.Errorf("observed %.1f requests/s, want at most %d", observed, perSecond)
+	}
+}
+
+func TestRateLimitedCanceledContext(t *testing.T) {
+	limiter := NewLimiter(0.001)
+	limiter.Allow() // spend the only token
+	client := &http.Client{Transport: &RateLimited{Base: http.DefaultTransport, Limiter: limiter}, Timeout: 50 * time.Millisecond}
+
+	if _, err := client.Get("http://127.0.0.1:1"); err == nil {
+		t.Error("Expected the wait to be abandoned when the request times out")
+	}
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Direct is the proxy value that bypasses any proxy configured in the
+// environment.
+const Direct = "direct"
+
+type Options struct {
+	// Proxy is a proxy URL, Direct, or empty to use HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY from the environment.
+	Proxy string
+
+	// ClientCert and ClientKey are PEM files holding a certificate pair
+	// presented to servers that require mutual TLS. Both or neither must be
+	// set.
+	ClientCert string
+	ClientKey  string
+
+	// InsecureSkipVerify accepts any server certificate, e.g. one re-signed
+	// by a TLS-intercepting corporate proxy. Only the transport it's set on
+	// is affected.
+	InsecureSkipVerify bool
+
+	// DisableHTTP2 keeps connections on HTTP/1.1, working around proxies and
+	// load balancers with broken HTTP/2 support.
+	DisableHTTP2 bool
+
+	// MaxIdleConns, MaxIdleConnsPerHost and MaxConnsPerHost size the
+	// connection pool as in http.Transport. Zero keeps the defaults.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+}
+
+// New builds a transport from http.DefaultTransport's settings. Each network
+// step gets its own transport so they can be configured independently.
+func New(opts Options) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch opts.Proxy {
+	case "":
+		t.Proxy = http.ProxyFromEnvironment
+	case Direct:
+		t.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("a client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig(t).Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.InsecureSkipVerify {
+		tlsConfig(t).InsecureSkipVerify = true
+	}
+
+	if opts.MaxIdleConns > 0 {
+		t.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+
+	if opts.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto turns h2 off. The TLS config cloned
+		// from http.DefaultTransport may already advertise h2 over ALPN,
+		// which would have servers pick a protocol we no longer speak.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if t.TLSClientConfig != nil {
+			t.TLSClientConfig.NextProtos = slices.DeleteFunc(slices.Clone(t.TLSClientConfig.NextProtos), func(proto string) bool {
+				return proto == "h2"
+			})
+		}
+	}
+
+	return t, nil
+}
+
+func tlsConfig(t *http.Transport) *tls.Config {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	return t.TLSClientConfig
+}
@@ -0,0 +1,277 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew_Proxy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://testnod.com/integrations/test_runs/upload", nil)
+
+	t.Run("explicit proxy", func(t *testing.T) {
+		tr, err := New(Options{Proxy: "http://proxy.internal:3128"})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+
+		proxyURL, err := tr.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy() unexpected error: %v", err)
+		}
+		if proxyURL == nil || proxyURL.String() != "http://proxy.internal:3128" {
+			t.Errorf("Proxy() = %v, want http://proxy.internal:3128", proxyURL)
+		}
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		tr, err := New(Options{Proxy: Direct})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		if tr.Proxy != nil {
+			t.Error("Expected no proxy function for direct connections")
+		}
+	})
+
+	t.Run("environment default", func(t *testing.T) {
+		tr, err := New(Options{})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		if tr.Proxy == nil {
+			t.Error("Expected the environment proxy function by default")
+		}
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		for _, proxy := range []string{"proxy.internal:3128", "://bad", "http://"} {
+			_, err := New(Options{Proxy: proxy})
+			if err == nil || !strings.Contains(err.Error(), "invalid proxy URL") {
+				t.Errorf("New(%q) error = %v, expected invalid proxy URL", proxy, err)
+			}
+		}
+	})
+}
+
+func TestNew_IndependentTransports(t *testing.T) {
+	a, _ := New(Options{Proxy: "http://a.internal"})
+	b, _ := New(Options{Proxy: Direct})
+
+	if a == b {
+		t.Fatal("Expected distinct transports")
+	}
+	if http.DefaultTransport.(*http.Transport).Proxy == nil {
+		t.Error("New() must not modify http.DefaultTransport")
+	}
+}
+
+func TestNew_InsecureSkipVerify(t *testing.T) {
+	strict, _ := New(Options{})
+	insecure, _ := New(Options{InsecureSkipVerify: true})
+
+	if strict.TLSClientConfig != nil && strict.TLSClientConfig.InsecureSkipVerify {
+		t.Error("New() skips verification without InsecureSkipVerify")
+	}
+	if insecure.TLSClientConfig == nil || !insecure.TLSClientConfig.InsecureSkipVerify {
+		t.Error("New() verifies certificates with InsecureSkipVerify")
+	}
+	if http.DefaultTransport.(*http.Transport).TLSClientConfig != nil && http.DefaultTransport.(*http.Transport).TLSClientConfig.InsecureSkipVerify {
+		t.Error("New() must not modify http.DefaultTransport")
+	}
+}
+
+// writeCertPair writes a PEM certificate signed by parent (or self-signed when
+// parent is nil) and its key to dir, returning the parsed certificate and key.
+func writeCertPair(t *testing.T, dir string, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return cert, key
+}
+
+func TestNew_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeCertPair(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	writeCertPair(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "uploader"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	var seenClient string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenClient = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusCreated)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(server.Certificate())
+
+	do := func(tr *http.Transport) error {
+		tlsConfig(tr).RootCAs = serverCAs
+		resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	t.Run("certificate presented", func(t *testing.T) {
+		tr, err := New(Options{ClientCert: filepath.Join(dir, "client.crt"), ClientKey: filepath.Join(dir, "client.key")})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		if err := do(tr); err != nil {
+			t.Fatalf("Request with client certificate failed: %v", err)
+		}
+		if seenClient != "uploader" {
+			t.Errorf("Server saw client %q, want uploader", seenClient)
+		}
+	})
+
+	t.Run("no certificate rejected", func(t *testing.T) {
+		tr, err := New(Options{})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		if err := do(tr); err == nil {
+			t.Error("Expected the server to reject a request without a client certificate")
+		}
+	})
+
+	t.Run("mismatched pair", func(t *testing.T) {
+		_, err := New(Options{ClientCert: filepath.Join(dir, "client.crt"), ClientKey: filepath.Join(dir, "ca.key")})
+		if err == nil || !strings.Contains(err.Error(), "failed to load client certificate") {
+			t.Errorf("New() error = %v, expected a load error", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := New(Options{ClientCert: filepath.Join(dir, "missing.crt"), ClientKey: filepath.Join(dir, "client.key")})
+		if err == nil || !strings.Contains(err.Error(), "failed to load client certificate") {
+			t.Errorf("New() error = %v, expected a load error", err)
+		}
+	})
+
+	t.Run("key without certificate", func(t *testing.T) {
+		_, err := New(Options{ClientKey: filepath.Join(dir, "client.key")})
+		if err == nil || !strings.Contains(err.Error(), "must be given together") {
+			t.Errorf("New() error = %v, expected a pairing error", err)
+		}
+	})
+}
+
+func TestNew_ConnectionPool(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	tr, err := New(Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if tr.MaxIdleConns != defaults.MaxIdleConns || tr.MaxIdleConnsPerHost != defaults.MaxIdleConnsPerHost || tr.MaxConnsPerHost != defaults.MaxConnsPerHost {
+		t.Errorf("New(Options{}) pool = %d/%d/%d, want the defaults %d/%d/%d",
+			tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost,
+			defaults.MaxIdleConns, defaults.MaxIdleConnsPerHost, defaults.MaxConnsPerHost)
+	}
+
+	tr, err = New(Options{MaxIdleConns: 200, MaxIdleConnsPerHost: 50, MaxConnsPerHost: 64})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if tr.MaxIdleConns != 200 || tr.MaxIdleConnsPerHost != 50 || tr.MaxConnsPerHost != 64 {
+		t.Errorf("pool = %d/%d/%d, want 200/50/64", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+}
+
+func TestNew_DisableHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tests := []struct {
+		name      string
+		disable   bool
+		wantProto string
+	}{
+		{name: "default", disable: false, wantProto: "HTTP/2.0"},
+		{name: "disabled", disable: true, wantProto: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := New(Options{Proxy: Direct, DisableHTTP2: tt.disable})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if tt.disable && (tr.ForceAttemptHTTP2 || tr.TLSNextProto == nil || len(tr.TLSNextProto) != 0) {
+				t.Errorf("ForceAttemptHTTP2 = %v, TLSNextProto = %v, want false and a non-nil empty map", tr.ForceAttemptHTTP2, tr.TLSNextProto)
+			}
+			tlsConfig(tr).RootCAs = roots
+
+			resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.Proto != tt.wantProto {
+				t.Errorf("negotiated %s, want %s", resp.Proto, tt.wantProto)
+			}
+		})
+	}
+}
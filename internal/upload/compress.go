@@ -0,0 +1,76 @@
+package upload
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Uncompressed is the compression level that uploads the file as-is, without
+// gzip. It's the default.
+const Uncompressed = gzip.HuffmanOnly - 1
+
+var compressionLevel = Uncompressed
+
+// SetCompressionLevel makes UploadJUnitXmlFile gzip the body at level (one
+// of the compress/gzip levels) and send it with Content-Encoding: gzip.
+// Uncompressed turns compression off.
+func SetCompressionLevel(level int) {
+	compressionLevel = level
+}
+
+var namedLevels = map[string]int{
+	"nocompression":      gzip.NoCompression,
+	"bestspeed":          gzip.BestSpeed,
+	"bestcompression":    gzip.BestCompression,
+	"defaultcompression": gzip.DefaultCompression,
+	"huffmanonly":        gzip.HuffmanOnly,
+}
+
+// ParseCompressionLevel accepts 0-9 or the name of a compress/gzip level
+// constant such as BestSpeed, ignoring case.
+func ParseCompressionLevel(s string) (int, error) {
+	if level, ok := namedLevels[strings.ToLower(s)]; ok {
+		return level, nil
+	}
+	level, err := strconv.Atoi(s)
+	if err != nil || level < gzip.NoCompression || level > gzip.BestCompression {
+		return 0, fmt.Errorf("invalid compression level %q (0-9, NoCompression, BestSpeed, BestCompression, DefaultCompression or HuffmanOnly)", s)
+	}
+	return level, nil
+}
+
+// compressFile gzips filePath into a temporary file and returns its path.
+// The caller removes it.
+func compressFile(filePath string, level int) (string, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp("", "testnod-upload-*.xml.gz")
+	if err != nil {
+		return "", fmt.Errorf("failed to create compressed file: %w", err)
+	}
+
+	gz, err := gzip.NewWriterLevel(out, level)
+	if err == nil {
+		_, err = io.Copy(gz, in)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to compress file: %w", err)
+	}
+
+	return out.Name(), nil
+}
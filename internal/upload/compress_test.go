@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCompressionLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "0", want: gzip.NoCompression},
+		{input: "9", want: gzip.BestCompression},
+		{input: "BestSpeed", want: gzip.BestSpeed},
+		{input: "defaultcompression", want: gzip.DefaultCompression},
+		{input: "HuffmanOnly", want: gzip.HuffmanOnly},
+		{input: "10", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "fast", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCompressionLevel(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCompressionLevel(%q) = %d, want an error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCompressionLevel(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+// writeJUnitFixture writes a large file with enough variety that the gzip
+// levels compress it differently.
+func writeJUnitFixture(t *testing.T) (string, []byte) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<testsuite name=\"large\">\n")
+	for i := range 5000 {
+		fmt.Fprintf(&b, "  <testcase name=\"test_%d_%x\" classname=\"pkg%d.Case\" time=\"%.3f\"/>\n", i, rng.Int63(), rng.Intn(50), rng.Float64())
+	}
+	b.WriteString("</testsuite>\n")
+
+	path := filepath.Join(t.TempDir(), "large.xml")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	return path, []byte(b.String())
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Body is not valid gzip: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	return out
+}
+
+func TestCompressFileLevels(t *testing.T) {
+	path, content := writeJUnitFixture(t)
+
+	sizes := make(map[int]int)
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		compressed, err := compressFile(path, level)
+		if err != nil {
+			t.Fatalf("compressFile(level %d) error = %v", level, err)
+		}
+		defer os.Remove(compressed)
+
+		data, err := os.ReadFile(compressed)
+		if err != nil {
+			t.Fatalf("Failed to read compressed file: %v", err)
+		}
+		if !bytes.Equal(gunzip(t, data), content) {
+			t.Errorf("Level %d did not round-trip the file", level)
+		}
+		sizes[level] = len(data)
+	}
+
+	if sizes[gzip.BestSpeed] <= sizes[gzip.BestCompression] {
+		t.Errorf("Expected BestSpeed (%d bytes) to be larger than BestCompression (%d bytes)", sizes[gzip.BestSpeed], sizes[gzip.BestCompression])
+	}
+}
+
+func TestUploadJUnitXmlFile_Compressed(t *testing.T) {
+	path, content := writeJUnitFixture(t)
+	t.Cleanup(func() { compressionLevel = Uncompressed })
+	SetCompressionLevel(gzip.BestCompression)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Expected Content-Encoding gzip, got %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.ContentLength != int64(len(body)) || len(body) >= len(content) {
+			t.Errorf("Expected a compressed body with a matching Content-Length, got %d bytes (Content-Length %d)", len(body), r.ContentLength)
+		}
+		if !bytes.Equal(gunzip(t, body), content) {
+			t.Error("Uploaded body did not decompress to the original file")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := UploadJUnitXmlFile(path, server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() error = %v", err)
+	}
+}
@@ -5,38 +5,216 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/avast/retry-go/v5"
 
 	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/jitter"
+	"testnod-uploader/internal/tracing"
+	"testnod-uploader/internal/transport"
 )
 
 const retryAttempts = 3
 
 var (
-	httpClient = &http.Client{Timeout: 60 * time.Second}
-	retryDelay = 1 * time.Second
+	httpClient      = &http.Client{Timeout: 60 * time.Second}
+	retryDelay      = 1 * time.Second
+	uploadAttempts  = retryAttempts
+	attemptObserver func(attempt int, duration time.Duration, err error)
+	retryIf         func(err error) bool
+	progressFn      func(sent int64)
+	uploadMethod    = http.MethodPut
+	successStatuses []int
+	storageBackend  = BackendS3
+	requestID       string
+	basicUser       string
+	basicPass       string
 )
 
+// Storage backends the presigned URL can point at. They differ in the
+// headers an upload needs.
+const (
+	BackendS3    = "s3"
+	BackendAzure = "azure"
+	BackendGCS   = "gcs"
+)
+
+// backendHeaders are the headers each storage backend requires on top of
+// Content-Type and Content-Length. Azure Blob Storage rejects a PUT to a SAS
+// URL without a blob type; S3 and GCS signed URLs need nothing extra as long
+// as they were signed for the application/xml content type.
+var backendHeaders = map[string]map[string]string{
+	BackendS3:    nil,
+	BackendAzure: {"x-ms-blob-type": "BlockBlob"},
+	BackendGCS:   nil,
+}
+
+// IsStorageBackend reports whether name is a supported storage backend.
+func IsStorageBackend(name string) bool {
+	_, ok := backendHeaders[name]
+	return ok
+}
+
+// SetRetryDelay sets the base delay between the retries of UploadJUnitXmlFile.
+// It returns the previous delay.
+func SetRetryDelay(d time.Duration) time.Duration {
+	previous := retryDelay
+	retryDelay = d
+	return previous
+}
+
+// SetTransport replaces the transport used by UploadJUnitXmlFile,
+// keeping the client's timeout.
+func SetTransport(transport http.RoundTripper) {
+	httpClient = &http.Client{Timeout: httpClient.Timeout, Transport: transport}
+}
+
+// SetAttempts sets how many times UploadJUnitXmlFile tries before giving up.
+func SetAttempts(n int) {
+	uploadAttempts = n
+}
+
+// SetRequestID sets the ID sent in an X-Request-Id header with every upload.
+// Empty sends no header.
+func SetRequestID(id string) {
+	requestID = id
+}
+
+// SetBasicAuth sets the credentials sent in an Authorization: Basic header
+// with every upload. An empty user sends no header, the default, since a
+// presigned URL carries its own authorization.
+func SetBasicAuth(user, pass string) {
+	basicUser = user
+	basicPass = pass
+}
+
+// SetRetryIf registers fn to decide, after a failed UploadJUnitXmlFile attempt
+// with attempts left, whether to try again. Pass nil to retry every error.
+func SetRetryIf(fn func(err error) bool) {
+	retryIf = fn
+}
+
+// SetAttemptObserver registers fn to be called after every
+// UploadJUnitXmlFile attempt with the attempt's number, starting at 1, how
+// long it took and its error (nil for the attempt that succeeded). Pass nil
+// to remove it.
+func SetAttemptObserver(fn func(attempt int, duration time.Duration, err error)) {
+	attemptObserver = fn
+}
+
+// SetMethod sets the HTTP method UploadJUnitXmlFile sends the file with,
+// http.MethodPut by default. Some storage backends expect POST for
+// presigned uploads; the body and headers are the same either way.
+func SetMethod(method string) {
+	uploadMethod = method
+}
+
+// SetSuccessStatuses sets the response statuses UploadJUnitXmlFile treats as
+// a successful upload; any other status is an error. With none, the default,
+// every 2xx status succeeds, since S3-compatible stores answer a PUT with
+// 200 or 204.
+func SetSuccessStatuses(statuses []int) {
+	successStatuses = statuses
+}
+
+func isSuccess(status int) bool {
+	if len(successStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(successStatuses, status)
+}
+
+// SetStorageBackend sets the storage backend UploadJUnitXmlFile sends the
+// required headers for, BackendS3 by default.
+func SetStorageBackend(backend string) {
+	storageBackend = backend
+}
+
+// SetProgressObserver registers fn to be called with the number of body bytes
+// sent so far as the current UploadJUnitXmlFile attempt progresses. The count
+// starts over with each attempt. Pass nil to remove it.
+func SetProgressObserver(fn func(sent int64)) {
+	progressFn = fn
+}
+
+// progressReader reports the running byte count of reads through it.
+type progressReader struct {
+	r    io.Reader
+	sent int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		progressFn(p.sent)
+	}
+	return n, err
+}
+
+// CoverageContentType is the Content-Type UploadCoverageFile sends, which
+// tells TestNod's storage the file is a coverage report rather than test
+// results.
+const CoverageContentType = "application/vnd.testnod.coverage+xml"
+
 func UploadJUnitXmlFile(filePath string, uploadURL string) error {
+	return uploadFile(filePath, uploadURL, "application/xml")
+}
+
+// UploadCoverageFile uploads a coverage XML report to its own presigned URL
+// the same way UploadJUnitXmlFile uploads test results, with
+// CoverageContentType.
+func UploadCoverageFile(filePath string, uploadURL string) error {
+	return uploadFile(filePath, uploadURL, CoverageContentType)
+}
+
+func uploadFile(filePath, uploadURL, contentType string) error {
+	contentEncoding := ""
+	if compressionLevel != Uncompressed {
+		compressedPath, err := compressFile(filePath, compressionLevel)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(compressedPath)
+		debug.Log("compressed %s with gzip level %d", filePath, compressionLevel)
+		filePath = compressedPath
+		contentEncoding = "gzip"
+	}
+
+	attempts := 0
 	err := retry.New(
 		retry.Delay(retryDelay),
-		retry.Attempts(retryAttempts),
+		retry.DelayType(jitter.Backoff),
+		retry.Attempts(uint(uploadAttempts)),
 		retry.LastErrorOnly(true),
+		retry.RetryIf(retryIf),
 		retry.OnRetry(func(attempt uint, err error) {
 			debug.Log("retry attempt %d: %v", attempt, err)
 		}),
 	).Do(
-		func() error {
+		func() (err error) {
+			attempts++
+			if attemptObserver != nil {
+				start := time.Now()
+				defer func() { attemptObserver(attempts, time.Since(start), err) }()
+			}
+
 			// Open the file for each retry attempt
 			file, err := os.Open(filePath)
 			if err != nil {
-				return fmt.Errorf("failed to open file %q: %w", filePath, err)
+				return errcode.Errorf(errcode.UploadFile, "failed to open file %q: %w", filePath, err)
 			}
 			defer file.Close()
 
-			req, err := http.NewRequest("PUT", uploadURL, file)
+			var body io.Reader = file
+			if progressFn != nil {
+				body = &progressReader{r: file}
+			}
+
+			req, err := http.NewRequest(uploadMethod, uploadURL, body)
 			if err != nil {
 				return fmt.Errorf("failed to create upload request: %w", err)
 			}
@@ -46,28 +224,45 @@ func UploadJUnitXmlFile(filePath string, uploadURL string) error {
 			// will use Transfer-Encoding: chunked without a Content-Length header.
 			fileInfo, err := file.Stat()
 			if err != nil {
-				return fmt.Errorf("failed to stat file: %w", err)
+				return errcode.Errorf(errcode.UploadFile, "failed to stat file: %w", err)
 			}
 
 			req.ContentLength = fileInfo.Size()
-			req.Header.Set("Content-Type", "application/xml")
+			req.Header.Set("Content-Type", contentType)
+			if contentEncoding != "" {
+				req.Header.Set("Content-Encoding", contentEncoding)
+			}
+			for name, value := range backendHeaders[storageBackend] {
+				req.Header.Set(name, value)
+			}
+			if requestID != "" {
+				req.Header.Set("X-Request-Id", requestID)
+			}
+			if basicUser != "" {
+				req.SetBasicAuth(basicUser, basicPass)
+			}
+			tracing.Inject(req.Header)
 
 			debug.Log("file: name=%s size=%d bytes", fileInfo.Name(), fileInfo.Size())
 			debug.Log("request: %s content-length=%d", req.Method, req.ContentLength)
 			resp, err := httpClient.Do(req)
 			if err != nil {
-				return fmt.Errorf("failed to upload file: %w", err)
+				code := errcode.UploadNetwork
+				if errcode.IsTimeout(err) {
+					code = errcode.UploadTimeout
+				}
+				return errcode.Errorf(code, "failed to upload file: %w", err)
 			}
 
 			debug.Log("response: status=%d", resp.StatusCode)
 
-			if resp.StatusCode != http.StatusOK {
+			if !isSuccess(resp.StatusCode) {
 				bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-				resp.Body.Close()
-				return fmt.Errorf("failed to upload file: status %d: %s", resp.StatusCode, string(bodyBytes))
+				transport.DrainAndClose(resp.Body)
+				return errcode.Errorf(errcode.HTTPStatus("E_UPLOAD", resp.StatusCode), "failed to upload file: status %d: %s", resp.StatusCode, string(bodyBytes))
 			}
 
-			resp.Body.Close()
+			transport.DrainAndClose(resp.Body)
 			return nil
 		},
 	)
@@ -1,13 +1,19 @@
 package upload
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/tracing"
 )
 
 func setShortRetryDelay(t *testing.T) {
@@ -211,6 +217,261 @@ func TestUploadJUnitXmlFile_AllRetriesFail(t *testing.T) {
 	}
 }
 
+func TestUploadJUnitXmlFile_CustomAttempts(t *testing.T) {
+	setShortRetryDelay(t)
+	SetAttempts(5)
+	t.Cleanup(func() { SetAttempts(retryAttempts) })
+
+	attemptCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attemptCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err == nil {
+		t.Error("UploadJUnitXmlFile() expected error when all retries fail")
+	}
+
+	if attemptCount != 5 {
+		t.Errorf("Expected 5 attempts, got %d", attemptCount)
+	}
+}
+
+func TestUploadJUnitXmlFile_AttemptObserver(t *testing.T) {
+	setShortRetryDelay(t)
+	t.Cleanup(func() { SetAttemptObserver(nil) })
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var attempts []int
+	var errs []error
+	SetAttemptObserver(func(attempt int, _ time.Duration, err error) {
+		attempts = append(attempts, attempt)
+		errs = append(errs, err)
+	})
+
+	if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() unexpected error: %v", err)
+	}
+
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Fatalf("Observed attempts %v, want [1 2]", attempts)
+	}
+	if errs[0] == nil || errs[1] != nil {
+		t.Errorf("Observed errors %v, want a failure then success", errs)
+	}
+}
+
+func TestUploadJUnitXmlFile_ProgressObserver(t *testing.T) {
+	t.Cleanup(func() { SetProgressObserver(nil) })
+
+	info, err := os.Stat("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to stat fixture: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != info.Size() {
+			t.Errorf("Expected Content-Length %d, got %d", info.Size(), r.ContentLength)
+		}
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var last atomic.Int64
+	SetProgressObserver(func(sent int64) { last.Store(sent) })
+
+	if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() unexpected error: %v", err)
+	}
+
+	if got := last.Load(); got != info.Size() {
+		t.Errorf("Last reported progress = %d bytes, want %d", got, info.Size())
+	}
+}
+
+func TestUploadJUnitXmlFile_Method(t *testing.T) {
+	info, err := os.Stat("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to stat fixture: %v", err)
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			t.Cleanup(func() { SetMethod(http.MethodPut) })
+			SetMethod(method)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != method {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				if r.ContentLength != info.Size() || len(r.TransferEncoding) > 0 {
+					t.Errorf("Expected Content-Length %d without chunking, got %d %v", info.Size(), r.ContentLength, r.TransferEncoding)
+				}
+				if r.Header.Get("Content-Type") != "application/xml" {
+					t.Errorf("Expected Content-Type application/xml, got %s", r.Header.Get("Content-Type"))
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+				t.Errorf("UploadJUnitXmlFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestUploadJUnitXmlFile_BasicAuth(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() error = %v", err)
+	}
+
+	SetBasicAuth("ci", "secret")
+	t.Cleanup(func() { SetBasicAuth("", "") })
+	if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() error = %v", err)
+	}
+
+	// base64("ci:secret")
+	if want := []string{"", "Basic Y2k6c2VjcmV0"}; !slices.Equal(got, want) {
+		t.Errorf("Expected Authorization headers %q, got %q", want, got)
+	}
+}
+
+func TestUploadCoverageFile(t *testing.T) {
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := UploadCoverageFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+		t.Fatalf("UploadCoverageFile() error = %v", err)
+	}
+	if contentType != CoverageContentType {
+		t.Errorf("Expected Content-Type %s, got %s", CoverageContentType, contentType)
+	}
+}
+
+func TestUploadJUnitXmlFile_SuccessStatuses(t *testing.T) {
+	setShortRetryDelay(t)
+	SetAttempts(1)
+	t.Cleanup(func() { SetAttempts(retryAttempts) })
+
+	tests := []struct {
+		name     string
+		statuses []int
+		status   int
+		wantErr  bool
+	}{
+		{"200 by default", nil, http.StatusOK, false},
+		{"204 by default", nil, http.StatusNoContent, false},
+		{"206 by default", nil, http.StatusPartialContent, false},
+		{"300 by default", nil, http.StatusMultipleChoices, true},
+		{"200 configured", []int{200, 204}, http.StatusOK, false},
+		{"204 configured", []int{200, 204}, http.StatusNoContent, false},
+		{"206 not configured", []int{200, 204}, http.StatusPartialContent, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSuccessStatuses(tt.statuses)
+			t.Cleanup(func() { SetSuccessStatuses(nil) })
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UploadJUnitXmlFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), fmt.Sprintf("status %d", tt.status)) {
+				t.Errorf("UploadJUnitXmlFile() error = %v, want it to name status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestUploadJUnitXmlFile_StorageBackend(t *testing.T) {
+	tests := []struct {
+		backend  string
+		blobType string
+	}{
+		{BackendS3, ""},
+		{BackendAzure, "BlockBlob"},
+		{BackendGCS, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			SetStorageBackend(tt.backend)
+			t.Cleanup(func() { SetStorageBackend(BackendS3) })
+
+			var header http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+			}))
+			defer server.Close()
+
+			if err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL); err != nil {
+				t.Fatalf("UploadJUnitXmlFile() error = %v", err)
+			}
+			if got := header.Get("x-ms-blob-type"); got != tt.blobType {
+				t.Errorf("x-ms-blob-type = %q, want %q", got, tt.blobType)
+			}
+			if got := header.Get("Content-Type"); got != "application/xml" {
+				t.Errorf("Content-Type = %q, want application/xml", got)
+			}
+		})
+	}
+
+	if IsStorageBackend("ftp") || !IsStorageBackend(BackendAzure) {
+		t.Error("IsStorageBackend() doesn't match the supported backends")
+	}
+}
+
+func TestUploadJUnitXmlFile_ErrorCodes(t *testing.T) {
+	setShortRetryDelay(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := UploadJUnitXmlFile("../../testdata/valid_junit.xml", server.URL)
+	if got := errcode.Code(err); got != "E_UPLOAD_403" {
+		t.Errorf("403 error %v has code %q, want E_UPLOAD_403", err, got)
+	}
+
+	err = UploadJUnitXmlFile("does-not-exist.xml", server.URL)
+	if got := errcode.Code(err); got != errcode.UploadFile {
+		t.Errorf("missing file error %v has code %q, want %q", err, got, errcode.UploadFile)
+	}
+}
+
 func TestUploadJUnitXmlFile_EmptyFile(t *testing.T) {
 	// Create empty file
 	tmpFile, err := os.CreateTemp("", "junit_upload_test_*.xml")
@@ -349,3 +610,36 @@ func TestUploadJUnitXmlFile_Directory(t *testing.T) {
 		t.Error("UploadJUnitXmlFile() expected error for directory")
 	}
 }
+
+func TestUploadJUnitXmlFile_Tracing(t *testing.T) {
+	const want = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	t.Setenv("TRACEPARENT", want)
+	tracing.InitFromEnv()
+	t.Cleanup(func() {
+		os.Unsetenv("TRACEPARENT")
+		tracing.InitFromEnv()
+	})
+
+	tmpFile, err := os.CreateTemp("", "junit_upload_test_*.xml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.WriteString("<testsuite></testsuite>")
+	tmpFile.Close()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := UploadJUnitXmlFile(tmpFile.Name(), server.URL); err != nil {
+		t.Fatalf("UploadJUnitXmlFile() unexpected error: %v", err)
+	}
+
+	if traceparent != want {
+		t.Errorf("traceparent = %q, want TRACEPARENT unchanged", traceparent)
+	}
+}
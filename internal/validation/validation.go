@@ -1,24 +1,219 @@
 package validation
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/errcode"
+	"testnod-uploader/internal/gzipsniff"
 )
 
+// Options enables checks that need to look past the root element. With the
+// zero value, validation stops as soon as a <testsuite> or <testsuites>
+// element is found.
+type Options struct {
+	// MaxTestcases fails validation once the file contains more <testcase>
+	// elements than this. Zero means no limit.
+	MaxTestcases int
+
+	// MaxDepth fails validation once elements are nested deeper than this,
+	// counting the root element as depth 1. Zero means no limit.
+	MaxDepth int
+
+	// Encoding fails validation when the XML declaration names a different
+	// encoding or the content isn't valid in it. Only "utf-8" is supported;
+	// empty skips the check.
+	Encoding string
+
+	// MaxTime fails validation when a <testsuite> or <testcase> time
+	// attribute is negative or more than this many seconds, listing every
+	// offender. Zero skips the check.
+	MaxTime float64
+
+	// Quick stops at the first <testsuite> or <testsuites> start element
+	// even when other options or warnings would scan the whole document, so
+	// a large file is only read up to its root. MaxDepth and Encoding then
+	// only check the part that was read.
+	Quick bool
+
+	// QuickLimit fails a Quick validation that hasn't found the root element
+	// after this many bytes. Zero means no limit.
+	QuickLimit int64
+
+	// SkipExtension leaves out the warning for a file without an .xml or
+	// .junit extension, for temporary copies such as downloaded files whose
+	// name says nothing about the content.
+	SkipExtension bool
+}
+
+func (o Options) scanWholeDocument() bool {
+	return o.MaxTestcases > 0 || o.MaxDepth > 0 || o.Encoding != "" || o.MaxTime > 0
+}
+
+// maxListedTimes caps how many offending time attributes a -validate-max-time
+// error lists.
+const maxListedTimes = 10
+
+// Report is the outcome of validating a file. Errors make the file invalid
+// and always fail; Warnings point out problems TestNod can still process,
+// such as empty testsuites or testcases without a name.
+type Report struct {
+	Warnings []string
+	Errors   []error
+}
+
+// Err returns the first error, or nil if the file is valid. Warnings are
+// ignored.
+func (r Report) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return r.Errors[0]
+}
+
+func (r *Report) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
 func ValidateJUnitXMLFile(filePath string) error {
+	return ValidateJUnitXMLFileWithOptions(filePath, Options{})
+}
+
+// ValidateJUnitXMLFileWithOptions returns the first error found in the file.
+// Warnings are dropped; use ValidateJUnitXMLFileReport to get them.
+func ValidateJUnitXMLFileWithOptions(filePath string, opts Options) error {
+	return validateFile(filePath, opts, false).Err()
+}
+
+// ValidateJUnitXMLFileReport validates the file like
+// ValidateJUnitXMLFileWithOptions and also scans the whole document for
+// warnings, returning both.
+func ValidateJUnitXMLFileReport(filePath string, opts Options) Report {
+	return validateFile(filePath, opts, true)
+}
+
+func validateFile(filePath string, opts Options, warnings bool) Report {
+	var report Report
 	debug.Log("validating file: %s", filePath)
 	f, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		report.Errors = append(report.Errors, errcode.Errorf(errcode.ValidateOpen, "failed to open file: %w", err))
+		return report
 	}
 	defer f.Close()
 
-	decoder := xml.NewDecoder(f)
+	content, err := gzipsniff.Reader(f)
+	if err != nil {
+		report.Errors = append(report.Errors, errcode.Errorf(errcode.ValidateNotXML, "%s is not an XML file: %w", filePath, err))
+		return report
+	}
+
+	r := bufio.NewReader(content)
+	if err := sniffXML(r); err != nil {
+		report.Errors = append(report.Errors, errcode.Errorf(errcode.ValidateNotXML, "%s is not an XML file: %w", filePath, err))
+		return report
+	}
+
+	// Content wins over the extension, so an unusual extension only warns.
+	if !opts.SkipExtension && !hasXMLExtension(filePath) {
+		report.warn("%s does not have an .xml extension", filePath)
+	}
+
+	if err := checkEncoding(r, opts.Encoding); err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+
+	if err := validate(encodingReader(r, opts.Encoding), opts, warnings, &report); err != nil {
+		var parseErr *parseError
+		if errors.As(err, &parseErr) {
+			parseErr.snippet = snippetFromFile(filePath, parseErr.offset)
+		}
+		report.Errors = append(report.Errors, err)
+	}
+	return report
+}
+
+// hasXMLExtension reports whether filePath ends in .xml or .junit, before
+// any .gz a gzipped file has.
+func hasXMLExtension(filePath string) bool {
+	ext := filepath.Ext(filePath)
+	if strings.EqualFold(ext, ".gz") {
+		ext = filepath.Ext(strings.TrimSuffix(filePath, ext))
+	}
+	return strings.EqualFold(ext, ".xml") || strings.EqualFold(ext, ".junit")
+}
+
+// ValidateJUnitXML validates JUnit XML read from r, e.g. standard input,
+// with the same checks as ValidateJUnitXMLFileWithOptions. Like files, gzip
+// content is detected by its magic bytes and decompressed.
+func ValidateJUnitXML(r io.Reader, opts Options) error {
+	return validateReader(r, opts, false).Err()
+}
+
+// ValidateJUnitXMLReport is ValidateJUnitXMLFileReport for JUnit XML read
+// from r.
+func ValidateJUnitXMLReport(r io.Reader, opts Options) Report {
+	return validateReader(r, opts, true)
+}
+
+func validateReader(r io.Reader, opts Options, warnings bool) Report {
+	var report Report
+	content, err := gzipsniff.Reader(r)
+	if err != nil {
+		report.Errors = append(report.Errors, errcode.Errorf(errcode.ValidateNotXML, "not an XML document: %w", err))
+		return report
+	}
+
+	br := bufio.NewReader(content)
+	if err := sniffXML(br); err != nil {
+		report.Errors = append(report.Errors, errcode.Errorf(errcode.ValidateNotXML, "not an XML document: %w", err))
+		return report
+	}
+	if err := checkEncoding(br, opts.Encoding); err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+	if err := validate(encodingReader(br, opts.Encoding), opts, warnings, &report); err != nil {
+		report.Errors = append(report.Errors, err)
+	}
+	return report
+}
+
+// openSuite is a <testsuite> the validator is inside of.
+type openSuite struct {
+	name       string
+	hasContent bool
+}
+
+// validate checks the XML in r, which sniffXML has already looked at. With
+// warnings set it reads the whole document and adds warnings to report.
+func validate(r io.Reader, opts Options, warnings bool, report *Report) error {
+	decoder := xml.NewDecoder(r)
+	// Without an Entity map only the five predefined XML entities are
+	// recognized, so a file can't define entities of its own.
+	decoder.Entity = nil
+	foundRoot := false
+	testcases := 0
+	depth := 0
+	var badTimes []string
+
+	var suites []openSuite
+
+	if opts.Quick {
+		warnings = false
+	}
 
 	for {
 		t, err := decoder.Token()
@@ -26,17 +221,323 @@ func ValidateJUnitXMLFile(filePath string) error {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return fmt.Errorf("error parsing XML: %w", err)
+			var invalid *invalidUTF8Error
+			if errors.As(err, &invalid) {
+				return errcode.Errorf(errcode.ValidateEncoding, "%w (-validate-encoding)", invalid)
+			}
+			return errcode.Wrap(errcode.ValidateMalformed, &parseError{err: err, offset: decoder.InputOffset()})
 		}
 
 		switch se := t.(type) {
+		case xml.Directive:
+			if isDTD(se) {
+				return errcode.Errorf(errcode.ValidateDTD, "DTD/entities not allowed: the file contains a <!%s> declaration", firstWord(se))
+			}
+		case xml.EndElement:
+			depth--
+			if warnings && se.Name.Local == "testsuite" && len(suites) > 0 {
+				if suite := suites[len(suites)-1]; !suite.hasContent {
+					report.warn("testsuite %q has no testcases", suite.name)
+				}
+				suites = suites[:len(suites)-1]
+			}
 		case xml.StartElement:
-			if se.Name.Local == "testsuite" || se.Name.Local == "testsuites" {
+			depth++
+			if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+				return errcode.Errorf(errcode.ValidateDepth, "elements are nested more than %d levels deep (-max-depth)", opts.MaxDepth)
+			}
+
+			if !foundRoot && (se.Name.Local == "testsuite" || se.Name.Local == "testsuites") {
 				debug.Log("found valid root element: <%s>", se.Name.Local)
-				return nil
+				if opts.Quick || (!opts.scanWholeDocument() && !warnings) {
+					return nil
+				}
+				foundRoot = true
+			}
+
+			if warnings && (se.Name.Local == "testsuite" || se.Name.Local == "testcase") {
+				if len(suites) > 0 {
+					suites[len(suites)-1].hasContent = true
+				}
+				if se.Name.Local == "testsuite" {
+					suites = append(suites, openSuite{name: attr(se, "name")})
+				} else if attr(se, "name") == "" {
+					line, _ := decoder.InputPos()
+					report.warn("line %d: testcase has no name", line)
+				}
+			}
+
+			if opts.MaxTime > 0 && (se.Name.Local == "testsuite" || se.Name.Local == "testcase") {
+				if value := attr(se, "time"); !validTime(value, opts.MaxTime) {
+					line, _ := decoder.InputPos()
+					badTimes = append(badTimes, fmt.Sprintf("line %d: %s %q time=%q", line, se.Name.Local, attr(se, "name"), value))
+				}
+			}
+
+			if se.Name.Local == "testcase" {
+				testcases++
+				if opts.MaxTestcases > 0 && testcases > opts.MaxTestcases {
+					return errcode.Errorf(errcode.ValidateMaxTestcase, "file contains more than %d <testcase> elements (-max-testcases)", opts.MaxTestcases)
+				}
 			}
 		}
+
+		if opts.Quick && opts.QuickLimit > 0 && decoder.InputOffset() > opts.QuickLimit {
+			return errcode.Errorf(errcode.ValidateRoot, "no <testsuite> or <testsuites> element in the first %d bytes (-quick-validate)", opts.QuickLimit)
+		}
 	}
 
-	return fmt.Errorf("file does not contain a <testsuite> or <testsuites> element")
+	if foundRoot {
+		debug.Log("scanned whole document: testcases=%d", testcases)
+		if len(badTimes) > 0 {
+			return timeError(badTimes, opts.MaxTime)
+		}
+		return nil
+	}
+
+	return errcode.Errorf(errcode.ValidateRoot, "file does not contain a <testsuite> or <testsuites> element")
+}
+
+// validTime reports whether a time attribute is within 0 and max seconds.
+// Missing or non-numeric times aren't checked.
+func validTime(value string, max float64) bool {
+	t, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return true
+	}
+	return t >= 0 && t <= max
+}
+
+// timeError lists the offending time attributes, up to maxListedTimes.
+func timeError(badTimes []string, max float64) error {
+	listed := badTimes
+	if len(listed) > maxListedTimes {
+		listed = listed[:maxListedTimes]
+	}
+	list := strings.Join(listed, "; ")
+	if more := len(badTimes) - len(listed); more > 0 {
+		list += fmt.Sprintf("; and %d more", more)
+	}
+	return errcode.Errorf(errcode.ValidateTime, "%d time attribute(s) negative or over %g seconds (-validate-max-time): %s", len(badTimes), max, list)
+}
+
+// parseError is a decoder error with the offset it was found at. Errors for
+// files carry a snippet of the offending line.
+type parseError struct {
+	err     error
+	offset  int64
+	snippet string
+}
+
+func (e *parseError) Error() string {
+	if e.snippet == "" {
+		return "error parsing XML: " + e.err.Error()
+	}
+	return "error parsing XML: " + e.err.Error() + "\n" + e.snippet
+}
+
+func (e *parseError) Unwrap() error { return e.err }
+
+// snippetContext is how many bytes of the offending line are shown on either
+// side of a parse error.
+const snippetContext = 40
+
+// snippetFromFile re-reads the region around offset in the decompressed
+// content of the file, returning "" if it can't.
+func snippetFromFile(filePath string, offset int64) string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	content, err := gzipsniff.Reader(f)
+	if err != nil {
+		return ""
+	}
+	start := max(offset-snippetContext, 0)
+	if _, err := io.CopyN(io.Discard, content, start); err != nil {
+		return ""
+	}
+	window := make([]byte, 2*snippetContext)
+	n, _ := io.ReadFull(content, window)
+	return snippet(window[:n], int(offset-start))
+}
+
+// snippet formats the line of window containing pos, with a caret under
+// pos, e.g.
+//
+//	<testcase name="a"><failure></testcase>
+//	                             ^
+func snippet(window []byte, pos int) string {
+	pos = min(pos, len(window))
+	lineStart := bytes.LastIndexByte(window[:pos], '\n') + 1
+	lineEnd := len(window)
+	if i := bytes.IndexByte(window[pos:], '\n'); i >= 0 {
+		lineEnd = pos + i
+	}
+
+	line := strings.ReplaceAll(string(bytes.TrimRight(window[lineStart:lineEnd], "\r")), "\t", " ")
+	before := strings.ReplaceAll(string(window[lineStart:pos]), "\t", " ")
+	if strings.TrimSpace(line) == "" {
+		return ""
+	}
+	return "  " + line + "\n  " + strings.Repeat(" ", utf8.RuneCountInString(before)) + "^"
+}
+
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// isDTD reports whether a directive is a document type or entity
+// declaration. JUnit files never need either, and an internal subset is how
+// entity expansion attacks such as billion laughs are delivered.
+func isDTD(d xml.Directive) bool {
+	word := firstWord(d)
+	return word == "DOCTYPE" || word == "ENTITY"
+}
+
+func firstWord(d xml.Directive) string {
+	fields := strings.Fields(string(d))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+const sniffLength = 512
+
+// sniffXML peeks at the start of the file and fails fast when it can't be XML,
+// so binary artifacts are rejected without reading them in full. XML must
+// start with '<' once an optional byte order mark and whitespace are skipped.
+func sniffXML(r *bufio.Reader) error {
+	head, err := r.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+
+	if len(head) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+	if head[0] != '<' {
+		return fmt.Errorf("content does not start with '<'")
+	}
+	return nil
+}
+
+// IsUTF8 reports whether name is a spelling of UTF-8, the only encoding
+// -validate-encoding supports.
+func IsUTF8(name string) bool {
+	return strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "utf8")
+}
+
+var encodingDecl = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*["']([^"']*)["']`)
+
+// checkEncoding fails when the XML declaration names an encoding other than
+// want. A missing declaration or encoding attribute means UTF-8.
+func checkEncoding(r *bufio.Reader, want string) error {
+	if want == "" {
+		return nil
+	}
+	head, err := r.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+
+	if m := encodingDecl.FindSubmatch(head); m != nil && !IsUTF8(string(m[1])) {
+		return errcode.Errorf(errcode.ValidateEncoding, "file declares encoding %q, want %s (-validate-encoding)", m[1], want)
+	}
+	return nil
+}
+
+// encodingReader wraps r so content that isn't valid in want fails with an
+// *invalidUTF8Error instead of a generic parse error.
+func encodingReader(r io.Reader, want string) io.Reader {
+	if want == "" {
+		return r
+	}
+	return &utf8Reader{r: r}
+}
+
+type invalidUTF8Error struct {
+	offset int64
+}
+
+func (e *invalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid UTF-8 at byte %d", e.offset)
+}
+
+// utf8Reader passes bytes through while checking they are valid UTF-8. A
+// multi-byte sequence split across reads is held back until it completes.
+type utf8Reader struct {
+	r       io.Reader
+	pending []byte
+	offset  int64
+	err     error
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	buf := make([]byte, len(p))
+	n := copy(buf, u.pending)
+	m, err := u.r.Read(buf[n:])
+	data := buf[:n+m]
+
+	// Hold back a trailing incomplete sequence unless the input has ended.
+	keep := 0
+	if err == nil {
+		keep = incompleteSuffix(data)
+	}
+	check := data[:len(data)-keep]
+	if i := invalidIndex(check); i >= 0 {
+		u.err = &invalidUTF8Error{offset: u.offset + int64(i)}
+		return 0, u.err
+	}
+	if err == nil && len(check) == 0 && keep == len(p) {
+		// p is too small to ever hold the pending sequence.
+		return 0, io.ErrShortBuffer
+	}
+
+	u.pending = append(u.pending[:0], data[len(check):]...)
+	u.offset += int64(len(check))
+	return copy(p, check), err
+}
+
+// invalidIndex returns the offset of the first invalid sequence in b, or -1.
+func invalidIndex(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// incompleteSuffix returns the length of a truncated multi-byte sequence at
+// the end of b that more input could complete.
+func incompleteSuffix(b []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if utf8.RuneStart(c) {
+			if c >= 0xc0 && !utf8.FullRune(b[len(b)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
 }
@@ -1,9 +1,20 @@
 package validation
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"testnod-uploader/internal/errcode"
 )
 
 func TestValidateJUnitXMLFile(t *testing.T) {
@@ -237,3 +248,703 @@ func TestValidateJUnitXMLFileWithRealExamples(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateJUnitXMLFilePreflight(t *testing.T) {
+	validXML := `<testsuite name="s"><testcase name="a" classname="c"/></testsuite>`
+
+	tests := []struct {
+		name        string
+		pattern     string
+		content     []byte
+		wantErr     bool
+		wantWarning bool
+	}{
+		{
+			name:    "xml content with xml extension",
+			pattern: "junit_*.xml",
+			content: []byte(validXML),
+		},
+		{
+			name:        "xml content with unusual extension",
+			pattern:     "junit_*.results",
+			content:     []byte(validXML),
+			wantWarning: true,
+		},
+		{
+			name:    "xml content with uppercase extension",
+			pattern: "junit_*.XML",
+			content: []byte(validXML),
+		},
+		{
+			name:    "xml content with junit extension",
+			pattern: "results_*.junit",
+			content: []byte(validXML),
+		},
+		{
+			name:    "byte order mark and leading whitespace",
+			pattern: "junit_*.xml",
+			content: append([]byte("\xef\xbb\xbf\n  "), validXML...),
+		},
+		{
+			name:    "gzip archive",
+			pattern: "results_*.tar.gz",
+			content: []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "binary content misnamed as xml",
+			pattern: "junit_*.xml",
+			content: []byte("PK\x03\x04\x14\x00binary"),
+			wantErr: true,
+		},
+		{
+			name:    "empty file",
+			pattern: "junit_*.xml",
+			content: nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", tt.pattern)
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			tmpFile.Write(tt.content)
+			tmpFile.Close()
+
+			var validateErr error
+			output := captureStdout(t, func() {
+				validateErr = ValidateJUnitXMLFile(tmpFile.Name())
+			})
+			if output != "" {
+				t.Errorf("ValidateJUnitXMLFile() printed %q, want warnings left to the caller", output)
+			}
+
+			if tt.wantErr {
+				if validateErr == nil || !strings.Contains(validateErr.Error(), "not an XML file") {
+					t.Errorf("ValidateJUnitXMLFile() error = %v, expected 'not an XML file'", validateErr)
+				}
+				return
+			}
+			if validateErr != nil {
+				t.Errorf("ValidateJUnitXMLFile() unexpected error = %v", validateErr)
+			}
+
+			report := ValidateJUnitXMLFileReport(tmpFile.Name(), Options{})
+			hasWarning := slices.ContainsFunc(report.Warnings, func(w string) bool {
+				return strings.Contains(w, "does not have an .xml extension")
+			})
+			if hasWarning != tt.wantWarning {
+				t.Errorf("extension warning reported = %v, want %v (warnings %q)", hasWarning, tt.wantWarning, report.Warnings)
+			}
+		})
+	}
+}
+
+func TestHasXMLExtension(t *testing.T) {
+	for path, want := range map[string]bool{
+		"results.xml":       true,
+		"results.XML":       true,
+		"results.junit":     true,
+		"results.xml.gz":    true,
+		"results.junit.GZ":  true,
+		"results.gz":        false,
+		"results.tar.gz":    false,
+		"results":           false,
+		"results.txt":       false,
+		"dir.xml/results":   false,
+		"testnod-download-": false,
+	} {
+		if got := hasXMLExtension(path); got != want {
+			t.Errorf("hasXMLExtension(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestValidateSkipExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testnod-download-123")
+	if err := os.WriteFile(path, []byte(`<testsuite name="s"><testcase name="a" classname="c"/></testsuite>`), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	if report := ValidateJUnitXMLFileReport(path, Options{}); len(report.Warnings) != 1 {
+		t.Errorf("Warnings = %q, want the extension warning", report.Warnings)
+	}
+	if report := ValidateJUnitXMLFileReport(path, Options{SkipExtension: true}); len(report.Warnings) != 0 {
+		t.Errorf("Warnings with SkipExtension = %q, want none", report.Warnings)
+	}
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	origStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = origStdout
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+func writeTestcases(t *testing.T, count int, trailer string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<testsuite name=\"generated\">\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&b, "  <testcase name=\"test_%d\" classname=\"generated\"/>\n", i)
+	}
+	b.WriteString(trailer)
+
+	tmpFile, err := os.CreateTemp("", "junit_max_testcases_*.xml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+	tmpFile.WriteString(b.String())
+	tmpFile.Close()
+	return tmpFile.Name()
+}
+
+func TestValidateJUnitXMLFileMaxTestcases(t *testing.T) {
+	const limit = 100
+
+	t.Run("at the limit", func(t *testing.T) {
+		path := writeTestcases(t, limit, "</testsuite>")
+		if err := ValidateJUnitXMLFileWithOptions(path, Options{MaxTestcases: limit}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("under the limit", func(t *testing.T) {
+		path := writeTestcases(t, limit-1, "</testsuite>")
+		if err := ValidateJUnitXMLFileWithOptions(path, Options{MaxTestcases: limit}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("just over the limit", func(t *testing.T) {
+		path := writeTestcases(t, limit+1, "</testsuite>")
+		err := ValidateJUnitXMLFileWithOptions(path, Options{MaxTestcases: limit})
+		if err == nil || !strings.Contains(err.Error(), "more than 100 <testcase> elements") {
+			t.Errorf("expected max testcases error, got: %v", err)
+		}
+	})
+
+	t.Run("aborts before reading the rest of the file", func(t *testing.T) {
+		// The malformed trailer is never reached once the limit trips.
+		path := writeTestcases(t, limit+1, "<unclosed>")
+		err := ValidateJUnitXMLFileWithOptions(path, Options{MaxTestcases: limit})
+		if err == nil || !strings.Contains(err.Error(), "-max-testcases") {
+			t.Errorf("expected max testcases error, got: %v", err)
+		}
+	})
+
+	t.Run("no limit by default", func(t *testing.T) {
+		path := writeTestcases(t, limit+1, "</testsuite>")
+		if err := ValidateJUnitXMLFile(path); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func writeNested(t *testing.T, depth int, trailer string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString(`<testsuites>`)
+	for range depth - 1 {
+		b.WriteString(`<testsuite name="nested">`)
+	}
+	b.WriteString(trailer)
+	for range depth - 1 {
+		b.WriteString(`</testsuite>`)
+	}
+	b.WriteString(`</testsuites>`)
+
+	tmpFile, err := os.CreateTemp("", "junit_max_depth_*.xml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+	tmpFile.WriteString(b.String())
+	tmpFile.Close()
+	return tmpFile.Name()
+}
+
+func TestValidateJUnitXMLFileMaxDepth(t *testing.T) {
+	const limit = 100
+
+	t.Run("at the limit", func(t *testing.T) {
+		path := writeNested(t, limit, "")
+		if err := ValidateJUnitXMLFileWithOptions(path, Options{MaxDepth: limit}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		path := writeNested(t, limit, "<testcase/>")
+		err := ValidateJUnitXMLFileWithOptions(path, Options{MaxDepth: limit})
+		if err == nil || !strings.Contains(err.Error(), "more than 100 levels deep") {
+			t.Errorf("expected max depth error, got: %v", err)
+		}
+	})
+
+	t.Run("pathological nesting aborts early", func(t *testing.T) {
+		// The unclosed elements past the limit are never reached.
+		path := writeNested(t, 100000, "<unclosed>")
+		err := ValidateJUnitXMLFileWithOptions(path, Options{MaxDepth: limit})
+		if err == nil || !strings.Contains(err.Error(), "-max-depth") {
+			t.Errorf("expected max depth error, got: %v", err)
+		}
+	})
+
+	t.Run("moderate nesting is fine", func(t *testing.T) {
+		if err := ValidateJUnitXMLFileWithOptions("../../testdata/valid_junit_multiple_suites.xml", Options{MaxDepth: limit}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("no limit by default", func(t *testing.T) {
+		path := writeNested(t, limit, "<testcase/>")
+		if err := ValidateJUnitXMLFile(path); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestValidateJUnitXMLFileRejectsDTD(t *testing.T) {
+	billionLaughs := `<?xml version="1.0"?>
+<!DOCTYPE lolz [
+  <!ENTITY lol "lol">
+  <!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+  <!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+  <!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">
+  <!ENTITY lol4 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">
+  <!ENTITY lol5 "&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;">
+  <!ENTITY lol6 "&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;">
+  <!ENTITY lol7 "&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;&lol6;">
+  <!ENTITY lol8 "&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;&lol7;">
+  <!ENTITY lol9 "&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;&lol8;">
+]>
+<testsuite name="lolz"><testcase name="a" classname="b"><failure>&lol9;</failure></testcase></testsuite>`
+
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+	}{
+		{name: "billion laughs", content: billionLaughs},
+		{name: "billion laughs with full scan", content: billionLaughs, opts: Options{MaxDepth: 100}},
+		{name: "external DTD", content: `<?xml version="1.0"?><!DOCTYPE testsuite SYSTEM "junit.dtd"><testsuite/>`},
+		{name: "lowercase doctype", content: `<!doctype testsuite><testsuite/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "junit_dtd_*.xml")
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			tmpFile.WriteString(tt.content)
+			tmpFile.Close()
+
+			start := time.Now()
+			err = ValidateJUnitXMLFileWithOptions(tmpFile.Name(), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), "DTD/entities not allowed") {
+				t.Errorf("expected DTD error, got: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the file to be rejected quickly, took %s", elapsed)
+			}
+		})
+	}
+
+	t.Run("comments are still allowed", func(t *testing.T) {
+		tmpFile, err := os.CreateTemp("", "junit_dtd_*.xml")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v", err)
+		}
+		defer os.Remove(tmpFile.Name())
+		tmpFile.WriteString(`<?xml version="1.0"?><!-- generated --><testsuite/>`)
+		tmpFile.Close()
+
+		if err := ValidateJUnitXMLFile(tmpFile.Name()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestValidateJUnitXMLFileErrorCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+	}{
+		{name: "no root", content: `<root><testcase name="a"/></root>`, want: errcode.ValidateRoot},
+		{name: "not XML", content: "PK\x03\x04binary", want: errcode.ValidateNotXML},
+		{name: "empty", content: "", want: errcode.ValidateNotXML},
+		{name: "malformed", content: `<testsuites><testsuite name="a">`, opts: Options{MaxDepth: 10}, want: errcode.ValidateMalformed},
+		{name: "DTD", content: `<!DOCTYPE testsuite><testsuite/>`, want: errcode.ValidateDTD},
+		{name: "too deep", content: `<testsuites><testsuite><testcase/></testsuite></testsuites>`, opts: Options{MaxDepth: 2}, want: errcode.ValidateDepth},
+		{name: "too many testcases", content: `<testsuite><testcase/><testcase/></testsuite>`, opts: Options{MaxTestcases: 1}, want: errcode.ValidateMaxTestcase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "junit_code_*.xml")
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			tmpFile.WriteString(tt.content)
+			tmpFile.Close()
+
+			err = ValidateJUnitXMLFileWithOptions(tmpFile.Name(), tt.opts)
+			if got := errcode.Code(err); got != tt.want {
+				t.Errorf("error %v has code %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+
+	if got := errcode.Code(ValidateJUnitXMLFile("does-not-exist.xml")); got != errcode.ValidateOpen {
+		t.Errorf("missing file code = %q, want %q", got, errcode.ValidateOpen)
+	}
+}
+
+func TestValidateJUnitXMLFileGzip(t *testing.T) {
+	fixture, err := os.ReadFile("../../testdata/valid_junit.xml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(fixture)
+	gz.Close()
+
+	path := t.TempDir() + "/results.xml"
+	if err := os.WriteFile(path, compressed.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	if err := ValidateJUnitXMLFile(path); err != nil {
+		t.Errorf("ValidateJUnitXMLFile() on a gzipped .xml error = %v", err)
+	}
+	if err := ValidateJUnitXML(bytes.NewReader(compressed.Bytes()), Options{}); err != nil {
+		t.Errorf("ValidateJUnitXML() on gzipped input error = %v", err)
+	}
+}
+
+func TestValidateJUnitXMLFileReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileName     string
+		content      string
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:     "clean",
+			fileName: "clean.xml",
+			content:  `<testsuites><testsuite name="a"><testcase name="t"/></testsuite></testsuites>`,
+		},
+		{
+			name:     "warnings only",
+			fileName: "results.txt",
+			content:  "<testsuites>\n<testsuite name=\"empty\"></testsuite>\n<testsuite name=\"a\">\n<testcase classname=\"C\"/>\n</testsuite>\n</testsuites>",
+			wantWarnings: []string{
+				"does not have an .xml extension",
+				`testsuite "empty" has no testcases`,
+				"line 4: testcase has no name",
+			},
+		},
+		{
+			name:         "nested suites count as content",
+			fileName:     "nested.xml",
+			content:      `<testsuites><testsuite name="outer"><testsuite name="inner"><testcase name="t"/></testsuite></testsuite></testsuites>`,
+			wantWarnings: nil,
+		},
+		{
+			name:         "warnings before an error",
+			fileName:     "broken.xml",
+			content:      `<testsuites><testsuite name="empty"></testsuite><testsuite name="a"><testcase name="t"></testsuite>`,
+			wantWarnings: []string{`testsuite "empty" has no testcases`},
+			wantErr:      errcode.ValidateMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/" + tt.fileName
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("Failed to write fixture: %v", err)
+			}
+
+			report := ValidateJUnitXMLFileReport(path, Options{})
+			if len(report.Warnings) != len(tt.wantWarnings) {
+				t.Fatalf("Warnings = %q, want %q", report.Warnings, tt.wantWarnings)
+			}
+			for i, want := range tt.wantWarnings {
+				if !strings.Contains(report.Warnings[i], want) {
+					t.Errorf("Warning %d = %q, want it to contain %q", i, report.Warnings[i], want)
+				}
+			}
+			if got := errcode.Code(report.Err()); got != tt.wantErr {
+				t.Errorf("Err() code = %q, want %q", got, tt.wantErr)
+			}
+
+			// Standard input has no extension to warn about.
+			fromReader := ValidateJUnitXMLReport(strings.NewReader(tt.content), Options{})
+			wantReader := slices.DeleteFunc(slices.Clone(report.Warnings), func(w string) bool { return strings.Contains(w, "extension") })
+			if !slices.Equal(fromReader.Warnings, wantReader) || errcode.Code(fromReader.Err()) != tt.wantErr {
+				t.Errorf("ValidateJUnitXMLReport() = %q, %v; want %q, %s", fromReader.Warnings, fromReader.Err(), wantReader, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJUnitXMLFileEncoding(t *testing.T) {
+	const suite = `<testsuite name="caf` + "é" + `"><testcase name="t"/></testsuite>`
+	latin1 := []byte(`<testsuite name="caf` + "\xe9" + `"><testcase name="t"/></testsuite>`)
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{"utf-8 declared", []byte(`<?xml version="1.0" encoding="UTF-8"?>` + suite), ""},
+		{"no declaration", []byte(suite), ""},
+		{"byte order mark", []byte("\xef\xbb\xbf<?xml version='1.0' encoding='utf-8'?>" + suite), ""},
+		{"latin-1 declared", append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>`), latin1...), errcode.ValidateEncoding},
+		{"latin-1 undeclared", latin1, errcode.ValidateEncoding},
+		{"invalid after the root", []byte("<testsuite><testcase name=\"t\"/>\xff</testsuite>"), errcode.ValidateEncoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/results.xml"
+			if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+				t.Fatalf("Failed to write fixture: %v", err)
+			}
+
+			err := ValidateJUnitXMLFileWithOptions(path, Options{Encoding: "utf-8"})
+			if got := errcode.Code(err); got != tt.wantErr {
+				t.Errorf("ValidateJUnitXMLFileWithOptions() error = %v, want code %q", err, tt.wantErr)
+			}
+
+			err = ValidateJUnitXML(bytes.NewReader(tt.content), Options{Encoding: "utf-8"})
+			if got := errcode.Code(err); got != tt.wantErr {
+				t.Errorf("ValidateJUnitXML() error = %v, want code %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("declaration is reported", func(t *testing.T) {
+		err := ValidateJUnitXML(bytes.NewReader(append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>`), latin1...)), Options{Encoding: "utf-8"})
+		if err == nil || !strings.Contains(err.Error(), `declares encoding "ISO-8859-1"`) {
+			t.Errorf("error = %v, want it to name the declared encoding", err)
+		}
+	})
+}
+
+func TestValidateJUnitXMLMaxTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  string
+		wantList []string
+	}{
+		{"normal times", `<testsuite name="unit" time="12.5"><testcase name="a" time="0"/><testcase name="b" time="3600"/><testcase name="c"/></testsuite>`, "", nil},
+		{"negative", `<testsuite name="unit" time="1">
+<testcase name="a" time="-5.0"/>
+</testsuite>`, errcode.ValidateTime, []string{`line 2: testcase "a" time="-5.0"`}},
+		{"huge", `<testsuites><testsuite name="unit" time="86400">
+<testcase name="a" time="1e9"/><testcase name="b" time="2"/>
+</testsuite></testsuites>`, errcode.ValidateTime, []string{`line 1: testsuite "unit" time="86400"`, `line 2: testcase "a" time="1e9"`}},
+		{"not a number", `<testsuite name="unit" time="fast"><testcase name="a" time=""/></testsuite>`, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJUnitXML(strings.NewReader(tt.content), Options{MaxTime: 3600})
+			if got := errcode.Code(err); got != tt.wantErr {
+				t.Fatalf("ValidateJUnitXML() error = %v, want code %q", err, tt.wantErr)
+			}
+			for _, offender := range tt.wantList {
+				if !strings.Contains(err.Error(), offender) {
+					t.Errorf("error = %v, want it to list %s", err, offender)
+				}
+			}
+			if tt.wantErr != "" && strings.Contains(err.Error(), `"b"`) {
+				t.Errorf("error = %v, want only the offenders listed", err)
+			}
+
+			if err := ValidateJUnitXML(strings.NewReader(tt.content), Options{}); err != nil {
+				t.Errorf("ValidateJUnitXML() without MaxTime error = %v, want the check off", err)
+			}
+		})
+	}
+
+	t.Run("long lists are capped", func(t *testing.T) {
+		content := "<testsuite>" + strings.Repeat(`<testcase name="x" time="-1"/>`, 12) + "</testsuite>"
+		err := ValidateJUnitXML(strings.NewReader(content), Options{MaxTime: 10})
+		if err == nil || !strings.Contains(err.Error(), "12 time attribute(s)") || !strings.Contains(err.Error(), "and 2 more") {
+			t.Errorf("error = %v, want 12 offenders with 2 not listed", err)
+		}
+	})
+}
+
+func TestUTF8ReaderSplitsRunes(t *testing.T) {
+	content := strings.Repeat("café 世界 ", 100)
+	r := &utf8Reader{r: iotest.OneByteReader(strings.NewReader(content))}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("utf8Reader changed the content")
+	}
+
+	r = &utf8Reader{r: iotest.OneByteReader(strings.NewReader("ok \xe4\xb8 bad"))}
+	_, err = io.ReadAll(r)
+	var invalid *invalidUTF8Error
+	if !errors.As(err, &invalid) || invalid.offset != 3 {
+		t.Errorf("ReadAll() error = %v, want invalid UTF-8 at byte 3", err)
+	}
+}
+
+func TestValidateJUnitXMLFileParseErrorSnippet(t *testing.T) {
+	content := "<?xml version=\"1.0\"?>\n<root>\n\t<testcase name=\"a\"><failure></testcase>\n</root>\n"
+	path := t.TempDir() + "/broken.xml"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	err := ValidateJUnitXMLFile(path)
+	if got := errcode.Code(err); got != errcode.ValidateMalformed {
+		t.Fatalf("error = %v with code %q, want %s", err, got, errcode.ValidateMalformed)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("error = %q, want the message, the offending line and a caret", err)
+	}
+	if lines[1] != `   <testcase name="a"><failure></testcase>` {
+		t.Errorf("snippet line = %q, want the offending line with tabs as spaces", lines[1])
+	}
+	if caret := strings.Index(lines[2], "^"); caret != len(lines[1]) || strings.TrimSpace(lines[2]) != "^" {
+		t.Errorf("caret line = %q, want a caret after </testcase>", lines[2])
+	}
+
+	t.Run("gzipped", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(content))
+		zw.Close()
+		gzPath := t.TempDir() + "/broken.xml.gz"
+		os.WriteFile(gzPath, buf.Bytes(), 0o644)
+
+		if err := ValidateJUnitXMLFile(gzPath); err == nil || !strings.Contains(err.Error(), "<failure></testcase>") {
+			t.Errorf("error = %v, want a snippet of the decompressed content", err)
+		}
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		err := ValidateJUnitXML(strings.NewReader(content), Options{})
+		if err == nil || strings.Contains(err.Error(), "\n") {
+			t.Errorf("error = %q, want a single line without a snippet", err)
+		}
+	})
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name   string
+		window string
+		pos    int
+		want   string
+	}{
+		{"middle of a line", "<a>\n<b></c>\n<d>", 10, "  <b></c>\n        ^"},
+		{"end of the window", "<a><b>", 6, "  <a><b>\n        ^"},
+		{"blank line", "<a>\n\n<b>", 4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet([]byte(tt.window), tt.pos); got != tt.want {
+				t.Errorf("snippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r    io.Reader
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestValidateJUnitXMLQuick(t *testing.T) {
+	large := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites><testsuite name="unit">` + strings.Repeat(`<testcase name="a" time="1"/>`, 200000) + `<testsuite name="empty"></testsuite></testsuite></testsuites>`
+
+	t.Run("stops at the root element", func(t *testing.T) {
+		r := &countingReader{r: strings.NewReader(large)}
+		opts := Options{MaxTestcases: 10, MaxTime: 3600, Quick: true, QuickLimit: 64 * 1024}
+		report := ValidateJUnitXMLReport(r, opts)
+		if err := report.Err(); err != nil {
+			t.Fatalf("ValidateJUnitXMLReport() error = %v, want the testcase limit not checked", err)
+		}
+		if len(report.Warnings) != 0 {
+			t.Errorf("Warnings = %v, want none", report.Warnings)
+		}
+		if r.read >= int64(len(large))/10 {
+			t.Errorf("read %d of %d bytes, want validation to stop early", r.read, len(large))
+		}
+	})
+
+	t.Run("scans the whole file without it", func(t *testing.T) {
+		r := &countingReader{r: strings.NewReader(large)}
+		report := ValidateJUnitXMLReport(r, Options{})
+		if r.read != int64(len(large)) {
+			t.Errorf("read %d of %d bytes, want the whole file", r.read, len(large))
+		}
+		if len(report.Warnings) != 1 {
+			t.Errorf("Warnings = %v, want the empty testsuite", report.Warnings)
+		}
+	})
+
+	t.Run("gives up after the limit", func(t *testing.T) {
+		content := "<?xml version=\"1.0\"?>\n<!-- " + strings.Repeat("x", 10000) + " -->\n<testsuite name=\"unit\"/>"
+		err := ValidateJUnitXML(strings.NewReader(content), Options{Quick: true, QuickLimit: 1024})
+		if errcode.Code(err) != errcode.ValidateRoot || !strings.Contains(err.Error(), "first 1024 bytes") {
+			t.Errorf("ValidateJUnitXML() error = %v, want %s for the first 1024 bytes", err, errcode.ValidateRoot)
+		}
+
+		if err := ValidateJUnitXML(strings.NewReader(content), Options{Quick: true}); err != nil {
+			t.Errorf("ValidateJUnitXML() without a limit error = %v, want nil", err)
+		}
+	})
+
+	t.Run("still rejects a malformed header", func(t *testing.T) {
+		err := ValidateJUnitXML(strings.NewReader(`<?xml version="1.0"?><results><testsuite`), Options{Quick: true, QuickLimit: 1024})
+		if err == nil {
+			t.Error("ValidateJUnitXML() error = nil, want an error")
+		}
+	})
+}
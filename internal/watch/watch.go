@@ -0,0 +1,165 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"testnod-uploader/internal/debug"
+)
+
+// DefaultPatterns match the names JUnit XML files are usually written under.
+var DefaultPatterns = []string{"*.xml", "*.junit", "*.junit.xml"}
+
+// Matches reports whether the base name of path matches any of patterns,
+// which use filepath.Match syntax. Matching ignores case, so *.xml also
+// matches RESULTS.XML.
+func Matches(path string, patterns []string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Watcher hands each JUnit XML file written to a directory to Handle once
+// the file has gone Settle without further writes. A file is handled
+// successfully at most once; a failed file is retried the next time it
+// changes.
+type Watcher struct {
+	Settle time.Duration
+	Handle func(path string) error
+
+	// Patterns select the files to handle by name, DefaultPatterns unless
+	// changed.
+	Patterns []string
+
+	// pending holds the generation of the latest event for each unsettled
+	// file, so a timer that fired before a newer write is ignored.
+	pending map[string]int
+	handled map[string]bool
+	ready   chan settled
+	nextGen int
+}
+
+type settled struct {
+	path string
+	gen  int
+}
+
+func New(settle time.Duration, handle func(path string) error) *Watcher {
+	return &Watcher{
+		Settle:   settle,
+		Handle:   handle,
+		Patterns: DefaultPatterns,
+		pending:  make(map[string]int),
+		handled:  make(map[string]bool),
+		ready:    make(chan settled),
+	}
+}
+
+// Run watches dir until ctx is cancelled. A file being handled when ctx is
+// cancelled is finished first; files that haven't settled yet are skipped.
+func (w *Watcher) Run(ctx context.Context, dir string) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	if err := fsw.Add(dir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	events := make(chan string)
+	go func() {
+		for event := range fsw.Events {
+			debug.Log("watch event: %s", event)
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if !Matches(event.Name, w.Patterns) {
+				continue
+			}
+			select {
+			case events <- event.Name:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return w.loop(ctx, events, fsw.Errors)
+}
+
+func (w *Watcher) loop(ctx context.Context, events <-chan string, errs <-chan error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			w.reportUnsettled()
+			return nil
+		case path := <-events:
+			w.schedule(ctx, path)
+		case s := <-w.ready:
+			if w.pending[s.path] != s.gen {
+				continue
+			}
+			delete(w.pending, s.path)
+			w.process(s.path)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			fmt.Printf("Warning: file watcher error: %v\n", err)
+		}
+	}
+}
+
+func (w *Watcher) schedule(ctx context.Context, path string) {
+	if w.handled[path] {
+		fmt.Printf("%s changed after it was processed, ignoring the change\n", path)
+		return
+	}
+
+	w.nextGen++
+	gen := w.nextGen
+	w.pending[path] = gen
+
+	time.AfterFunc(w.Settle, func() {
+		select {
+		case w.ready <- settled{path: path, gen: gen}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (w *Watcher) process(path string) {
+	debug.Log("%s settled, handling", path)
+	if err := w.Handle(path); err != nil {
+		debug.Log("handling %s failed, will retry on the next change: %v", path, err)
+		return
+	}
+	w.handled[path] = true
+}
+
+func (w *Watcher) reportUnsettled() {
+	if len(w.pending) == 0 {
+		return
+	}
+
+	var paths []string
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Printf("Stopped watching with %d file(s) still being written, skipped: %s\n", len(paths), strings.Join(paths, ", "))
+}
@@ -0,0 +1,218 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+const settle = 30 * time.Millisecond
+
+// recorder collects handled paths. Handle is only ever called from the
+// watcher loop, but the test goroutine reads the results.
+type recorder struct {
+	mu    sync.Mutex
+	paths []string
+	fail  map[string]bool
+}
+
+func (r *recorder) handle(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = append(r.paths, path)
+	if r.fail[path] {
+		delete(r.fail, path)
+		return errors.New("upload failed")
+	}
+	return nil
+}
+
+func (r *recorder) handled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.paths...)
+}
+
+func startLoop(t *testing.T, w *Watcher) (chan<- string, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		w.loop(ctx, events, nil)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return events, cancel
+}
+
+func TestWatcherDebouncesWrites(t *testing.T) {
+	rec := &recorder{}
+	events, _ := startLoop(t, New(settle, rec.handle))
+
+	// Writes closer together than the settle time keep pushing the upload
+	// back.
+	for range 5 {
+		events <- "results.xml"
+		time.Sleep(settle / 3)
+	}
+	if got := rec.handled(); len(got) != 0 {
+		t.Fatalf("Expected no uploads while the file is being written, got %v", got)
+	}
+
+	time.Sleep(3 * settle)
+	if got := rec.handled(); len(got) != 1 || got[0] != "results.xml" {
+		t.Fatalf("Expected one upload after the file settled, got %v", got)
+	}
+}
+
+func TestWatcherHandlesFileOnce(t *testing.T) {
+	rec := &recorder{}
+	events, _ := startLoop(t, New(settle, rec.handle))
+
+	events <- "a.xml"
+	events <- "b.xml"
+	time.Sleep(3 * settle)
+
+	events <- "a.xml"
+	time.Sleep(3 * settle)
+
+	got := rec.handled()
+	if len(got) != 2 {
+		t.Fatalf("Expected a.xml and b.xml to be uploaded once each, got %v", got)
+	}
+}
+
+func TestWatcherRetriesFailedFileOnChange(t *testing.T) {
+	rec := &recorder{fail: map[string]bool{"a.xml": true}}
+	events, _ := startLoop(t, New(settle, rec.handle))
+
+	events <- "a.xml"
+	time.Sleep(3 * settle)
+	events <- "a.xml"
+	time.Sleep(3 * settle)
+
+	if got := rec.handled(); len(got) != 2 {
+		t.Fatalf("Expected the failed file to be retried after it changed, got %v", got)
+	}
+}
+
+func TestWatcherSkipsUnsettledFilesOnShutdown(t *testing.T) {
+	rec := &recorder{}
+	w := New(time.Hour, rec.handle)
+	events, cancel := startLoop(t, w)
+
+	events <- "a.xml"
+	cancel()
+	time.Sleep(settle)
+
+	if got := rec.handled(); len(got) != 0 {
+		t.Errorf("Expected unsettled files to be skipped on shutdown, got %v", got)
+	}
+}
+
+func TestRunWatchesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	w := New(settle, rec.handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, dir) }()
+
+	// Give the watcher time to register before writing.
+	time.Sleep(settle)
+	os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(dir, "results.xml"), []byte("<testsuite/>"), 0o644)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.handled()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	got := rec.handled()
+	if len(got) != 1 || got[0] != filepath.Join(dir, "results.xml") {
+		t.Errorf("Expected only results.xml to be handled, got %v", got)
+	}
+}
+
+func TestRunWatchesJUnitExtensions(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	w := New(settle, rec.handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, dir) }()
+
+	time.Sleep(settle)
+	want := []string{"a.xml", "b.junit", "c.junit.xml", "D.JUNIT"}
+	os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("x"), 0o644)
+	for _, name := range want {
+		os.WriteFile(filepath.Join(dir, name), []byte("<testsuite/>"), 0o644)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.handled()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	got := rec.handled()
+	slices.Sort(got)
+	var wantPaths []string
+	for _, name := range want {
+		wantPaths = append(wantPaths, filepath.Join(dir, name))
+	}
+	slices.Sort(wantPaths)
+	if !slices.Equal(got, wantPaths) {
+		t.Errorf("Expected %v to be handled, got %v", wantPaths, got)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		want     bool
+	}{
+		{"results.xml", DefaultPatterns, true},
+		{"out/RESULTS.XML", DefaultPatterns, true},
+		{"results.junit", DefaultPatterns, true},
+		{"results.junit.xml", DefaultPatterns, true},
+		{"results.txt", DefaultPatterns, false},
+		{"results.xml.tmp", DefaultPatterns, false},
+		{"TEST-unit.xml", []string{"TEST-*.xml"}, true},
+		{"results.xml", []string{"TEST-*.xml"}, false},
+		{"results.xml", nil, false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.path, tt.patterns); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.path, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestRunMissingDirectory(t *testing.T) {
+	w := New(settle, func(string) error { return nil })
+	if err := w.Run(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Run() expected error for a missing directory")
+	}
+}
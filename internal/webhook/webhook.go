@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/avast/retry-go/v5"
+
+	"testnod-uploader/internal/debug"
+	"testnod-uploader/internal/jitter"
+	"testnod-uploader/internal/transport"
+)
+
+// StatusUploaded is the payload status sent after a successful upload.
+const StatusUploaded = "uploaded"
+
+// Payload is the JSON posted to the webhook.
+type Payload struct {
+	TestRunID  int    `json:"test_run_id"`
+	TestRunURL string `json:"test_run_url"`
+	Project    string `json:"project"`
+	File       string `json:"file"`
+	Status     string `json:"status"`
+}
+
+// A webhook is a courtesy notification, so it gets a short timeout and a
+// single retry rather than holding up the build.
+const attempts = 2
+
+var (
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+	retryDelay = 1 * time.Second
+)
+
+// SetRetryDelay sets the delay before Send's retry. It returns the previous
+// delay.
+func SetRetryDelay(d time.Duration) time.Duration {
+	previous := retryDelay
+	retryDelay = d
+	return previous
+}
+
+// Send posts payload to url as JSON. Any 2xx response counts as delivered.
+func Send(url string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	return retry.New(
+		retry.Delay(retryDelay),
+		retry.DelayType(jitter.Backoff),
+		retry.Attempts(attempts),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(attempt uint, err error) {
+			debug.Log("webhook retry attempt %d: %v", attempt, err)
+		}),
+	).Do(
+		func() error {
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return fmt.Errorf("failed to create webhook request: %w", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			debug.Log("request: %s %s", req.Method, req.URL)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("failed to call webhook: %w", err)
+			}
+			defer transport.DrainAndClose(resp.Body)
+
+			debug.Log("response: status=%d", resp.StatusCode)
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("webhook returned %s", resp.Status)
+			}
+			return nil
+		},
+	)
+}
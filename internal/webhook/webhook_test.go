@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setShortRetryDelay(t *testing.T) {
+	t.Helper()
+	original := SetRetryDelay(10 * time.Millisecond)
+	t.Cleanup(func() { SetRetryDelay(original) })
+}
+
+func TestSend(t *testing.T) {
+	var got Payload
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	payload := Payload{TestRunID: 17, TestRunURL: "https://testnod.com/runs/17", Project: "app", File: "results.xml", Status: StatusUploaded}
+	if err := Send(server.URL, payload); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got != payload {
+		t.Errorf("Webhook received %+v, want %+v", got, payload)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+}
+
+func TestSendRetriesOnce(t *testing.T) {
+	setShortRetryDelay(t)
+
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  bool
+	}{
+		{name: "recovers on retry", failures: 1},
+		{name: "gives up after one retry", failures: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= tt.failures {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			err := Send(server.URL, Payload{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "502") {
+				t.Errorf("Send() error = %v, want the last status", err)
+			}
+			if want := min(tt.failures+1, attempts); calls != want {
+				t.Errorf("Webhook called %d times, want %d", calls, want)
+			}
+		})
+	}
+}